@@ -0,0 +1,62 @@
+package work
+
+import "errors"
+
+// The sets of jobs waiting for their time to come, as passed to Backend.RequeueDue.
+const (
+	ScheduledSet = "scheduled"
+	RetrySet     = "retry"
+)
+
+// ErrUnsupportedBackend is returned by the features that only work with the Redis backend,
+// such as batches and workflows, when they're used with another backend.
+var ErrUnsupportedBackend = errors.New("work: not supported by the backend")
+
+// Backend stores jobs and the state of the worker pools processing them.
+// Enqueuers and worker pools store them in Redis (see NewRedisBackend) unless
+// they're created with NewEnqueuerWithBackend and NewWorkerPoolWithBackend.
+// NewMemoryBackend returns a backend that keeps them in process.
+// The times jobs are scheduled or retried at are in epoch milliseconds, other times are in epoch seconds.
+// A Backend must be safe for concurrent use.
+type Backend interface {
+	// Enqueue pushes job onto the queue of its job name.
+	Enqueue(job *Job) error
+	// Schedule adds job to the scheduled jobs, to be enqueued at runAt.
+	Schedule(job *Job, runAt int64) error
+	// EnqueueUnique enqueues job as per Enqueue, or schedules it as per Schedule if runAt isn't 0,
+	// unless a job with the same UniqueKey is queued or scheduled already.
+	// In that case, the args of that job are replaced by those of job if replaceArgs is set.
+	// It reports whether job was added.
+	EnqueueUnique(job *Job, runAt int64, replaceArgs bool) (bool, error)
+
+	// RegisterJobTypes records the options of the job types run by the worker pool poolID,
+	// such as their max concurrency. It's called when the pool starts and on every heartbeat.
+	// It returns the priorities that were overridden for the pool's job types, if any.
+	RegisterJobTypes(poolID string, jobOpts map[string]JobOptions) (map[string]uint, error)
+	// Fetch takes the next job off the first queue of jobNames that has one that can be started,
+	// as per the max concurrency of its job type, and marks it in progress for the worker pool poolID.
+	// It returns nil if there's no such job.
+	Fetch(poolID string, jobNames []string) (*Job, error)
+	// Ack removes job, as returned by Fetch, from the jobs in progress once it succeeded.
+	Ack(poolID string, job *Job) error
+	// Retry removes job from the jobs in progress as per Ack, and schedules it to be retried at retryAt.
+	Retry(poolID string, job *Job, retryAt int64) error
+	// Dead removes job from the jobs in progress as per Ack,
+	// and adds it to the dead jobs unless discard is set.
+	Dead(poolID string, job *Job, discard bool) error
+	// Requeue removes job from the jobs in progress as per Ack,
+	// and puts it back at the front of its queue without counting it as failed.
+	Requeue(poolID string, job *Job) error
+	// RequeueDue enqueues the jobs of set (ScheduledSet or RetrySet) whose time has come.
+	// Jobs whose name isn't in jobNames are moved to the dead jobs.
+	// It returns how many jobs were enqueued and how many were moved to the dead jobs.
+	RequeueDue(set string, jobNames []string) (requeued int, dead int, err error)
+
+	// Heartbeat records that the worker pool described by hb is alive.
+	Heartbeat(hb *WorkerPoolHeartbeat) error
+	// RemoveHeartbeat removes the heartbeat of the worker pool poolID once it's stopped.
+	RemoveHeartbeat(poolID string) error
+	// Observe records what the worker obs.WorkerID is doing.
+	// The observation is removed if the worker isn't busy.
+	Observe(obs *WorkerObservation) error
+}
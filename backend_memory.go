@@ -0,0 +1,349 @@
+package work
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// memoryJob is a job in a queue or a set of a memory backend, as serialized.
+type memoryJob struct {
+	at      int64 // when the job is due if it's in a set, in epoch milliseconds except for the dead jobs
+	rawJSON []byte
+}
+
+// memoryJobSet holds jobs by the time they're due, like the sorted sets of the Redis backend.
+type memoryJobSet []memoryJob
+
+func (s *memoryJobSet) add(at int64, rawJSON []byte) {
+	i := sort.Search(len(*s), func(i int) bool { return (*s)[i].at > at })
+	*s = append(*s, memoryJob{})
+	copy((*s)[i+1:], (*s)[i:])
+	(*s)[i] = memoryJob{at: at, rawJSON: rawJSON}
+}
+
+type memoryUniqueJob struct {
+	rawJSON   []byte // nil unless enqueuing the job again replaced its args
+	expiresAt int64
+}
+
+type memoryRateLimit struct {
+	RateLimit
+	tokens    float64
+	updatedAt int64 // in epoch milliseconds
+}
+
+// memoryBackend is the Backend keeping jobs in process.
+type memoryBackend struct {
+	mtx            sync.Mutex
+	queues         map[string][]memoryJob // by job name, oldest first
+	inProgress     map[string]uint        // by job name
+	maxConcurrency map[string]uint
+	rateLimits     map[string]*memoryRateLimit
+	uniqueJobs     map[string]memoryUniqueJob // by unique key
+	scheduled      memoryJobSet
+	retry          memoryJobSet
+	dead           memoryJobSet
+	heartbeats     map[string]WorkerPoolHeartbeat
+	observations   map[string]WorkerObservation
+}
+
+// NewMemoryBackend returns a Backend that keeps jobs in process, eg, for tests or single-binary deployments.
+// It honors the priority, MaxConcurrency and RateLimit of job types, unique jobs and scheduled jobs.
+// Its jobs are lost when the process exits, and can't be inspected with a Client.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{
+		queues:         make(map[string][]memoryJob),
+		inProgress:     make(map[string]uint),
+		maxConcurrency: make(map[string]uint),
+		rateLimits:     make(map[string]*memoryRateLimit),
+		uniqueJobs:     make(map[string]memoryUniqueJob),
+		heartbeats:     make(map[string]WorkerPoolHeartbeat),
+		observations:   make(map[string]WorkerObservation),
+	}
+}
+
+func (b *memoryBackend) Enqueue(job *Job) error {
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.queues[job.Name] = append(b.queues[job.Name], memoryJob{rawJSON: rawJSON})
+	return nil
+}
+
+func (b *memoryBackend) Schedule(job *Job, runAt int64) error {
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.scheduled.add(runAt, rawJSON)
+	return nil
+}
+
+func (b *memoryBackend) EnqueueUnique(job *Job, runAt int64, replaceArgs bool) (bool, error) {
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return false, err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	// Like with Redis, jobs are only unique for their unique TTL after they're enqueued
+	now := nowEpochSeconds()
+	unique := memoryUniqueJob{expiresAt: now + job.uniqueTTL()}
+	if replaceArgs {
+		unique.rawJSON = rawJSON
+	}
+	cur, ok := b.uniqueJobs[job.UniqueKey]
+	b.uniqueJobs[job.UniqueKey] = unique
+	if ok && cur.expiresAt > now {
+		return false, nil
+	}
+
+	if runAt != 0 {
+		b.scheduled.add(runAt, rawJSON)
+	} else {
+		b.queues[job.Name] = append(b.queues[job.Name], memoryJob{rawJSON: rawJSON})
+	}
+	return true, nil
+}
+
+func (b *memoryBackend) RegisterJobTypes(poolID string, jobOpts map[string]JobOptions) (map[string]uint, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for jobName, opts := range jobOpts {
+		b.maxConcurrency[jobName] = opts.MaxConcurrency
+
+		rl := opts.RateLimit
+		if rl.Limit == 0 || rl.Interval <= 0 {
+			delete(b.rateLimits, jobName)
+		} else if cur := b.rateLimits[jobName]; cur == nil || cur.RateLimit != rl {
+			b.rateLimits[jobName] = &memoryRateLimit{RateLimit: rl, tokens: float64(rl.Limit), updatedAt: nowEpochMilliseconds()}
+		}
+	}
+	return nil, nil
+}
+
+func (b *memoryBackend) Fetch(poolID string, jobNames []string) (*Job, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, jobName := range jobNames {
+		queue := b.queues[jobName]
+		if len(queue) == 0 {
+			continue
+		}
+		if max := b.maxConcurrency[jobName]; max > 0 && b.inProgress[jobName] >= max {
+			continue
+		}
+		if !b.takeToken(jobName) {
+			continue
+		}
+
+		b.queues[jobName] = queue[1:]
+		b.inProgress[jobName]++
+		job, err := newJob(queue[0].rawJSON, nil, nil)
+		if err != nil {
+			b.inProgress[jobName]--
+			return nil, err
+		}
+
+		if job.Unique {
+			unique, ok := b.uniqueJobs[job.UniqueKey]
+			if !job.uniqueWhileRunning() {
+				delete(b.uniqueJobs, job.UniqueKey)
+			}
+			if ok && unique.rawJSON != nil {
+				// The job in the queue was just a placeholder, so replace it with the one with the latest args
+				if jobWithArgs, err := newJob(unique.rawJSON, nil, nil); err == nil {
+					if job.UniqueMode != UniqueUntilStarted {
+						// The job can be fetched again once it's retried, so only its args are replaced
+						job.Args = jobWithArgs.Args
+					} else {
+						job = jobWithArgs
+					}
+				}
+			}
+		}
+		return job, nil
+	}
+	return nil, nil
+}
+
+// takeToken reports whether a job named jobName can be started as per its rate limit, if any.
+// See redisLuaFetchJob for how the tokens are counted.
+func (b *memoryBackend) takeToken(jobName string) bool {
+	rl := b.rateLimits[jobName]
+	if rl == nil {
+		return true
+	}
+
+	now := nowEpochMilliseconds()
+	if now > rl.updatedAt {
+		limit := float64(rl.Limit)
+		rl.tokens = math.Min(limit, rl.tokens+float64(now-rl.updatedAt)*limit/float64(rl.intervalMilliseconds()))
+		rl.updatedAt = now
+	}
+	if rl.tokens < 1 {
+		return false
+	}
+	rl.tokens--
+	return true
+}
+
+// done removes job from the jobs in progress.
+func (b *memoryBackend) done(job *Job) {
+	if b.inProgress[job.Name] > 0 {
+		b.inProgress[job.Name]--
+	}
+}
+
+func (b *memoryBackend) Ack(poolID string, job *Job) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.done(job)
+	if job.releasesUniqueKey(false, false) {
+		delete(b.uniqueJobs, job.UniqueKey)
+	}
+	return nil
+}
+
+func (b *memoryBackend) Retry(poolID string, job *Job, retryAt int64) error {
+	rawJSON, err := job.serialize()
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.done(job)
+	if err != nil {
+		return err
+	}
+	b.retry.add(retryAt, rawJSON)
+	if job.Unique && job.UniqueMode == UniqueWhileQueuedOrRetrying {
+		// Take the key back, unless another job with the same key was enqueued while this one ran
+		now := nowEpochSeconds()
+		if cur, ok := b.uniqueJobs[job.UniqueKey]; !ok || cur.expiresAt <= now {
+			b.uniqueJobs[job.UniqueKey] = memoryUniqueJob{expiresAt: now + job.uniqueTTL()}
+		}
+	}
+	return nil
+}
+
+func (b *memoryBackend) Dead(poolID string, job *Job, discard bool) error {
+	var rawJSON []byte
+	var err error
+	if !discard {
+		rawJSON, err = job.serialize()
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.done(job)
+	if job.releasesUniqueKey(true, discard) {
+		delete(b.uniqueJobs, job.UniqueKey)
+	}
+	if discard || err != nil {
+		return err
+	}
+	b.dead.add(nowEpochSeconds(), rawJSON)
+	return nil
+}
+
+func (b *memoryBackend) Requeue(poolID string, job *Job) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.done(job)
+	b.queues[job.Name] = append([]memoryJob{{rawJSON: job.rawJSON}}, b.queues[job.Name]...)
+	return nil
+}
+
+func (b *memoryBackend) RequeueDue(set string, jobNames []string) (requeued int, dead int, err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	var jobs *memoryJobSet
+	switch set {
+	case ScheduledSet:
+		jobs = &b.scheduled
+	case RetrySet:
+		jobs = &b.retry
+	default:
+		return 0, 0, fmt.Errorf("work: unknown set %q", set)
+	}
+
+	known := make(map[string]bool, len(jobNames))
+	for _, jobName := range jobNames {
+		known[jobName] = true
+	}
+
+	now := nowEpochSeconds()
+	for len(*jobs) > 0 && (*jobs)[0].at <= nowEpochMilliseconds() {
+		job, err := newJob((*jobs)[0].rawJSON, nil, nil)
+		*jobs = (*jobs)[1:]
+		if err != nil {
+			return requeued, dead, err
+		}
+
+		if !known[job.Name] {
+			job.LastErr = "unknown job when requeueing"
+			job.FailedAt = now
+			if rawJSON, err := job.serialize(); err == nil {
+				b.dead.add(now, rawJSON)
+			}
+			dead++
+			continue
+		}
+
+		job.EnqueuedAt = now
+		rawJSON, err := job.serialize()
+		if err != nil {
+			return requeued, dead, err
+		}
+		b.queues[job.Name] = append(b.queues[job.Name], memoryJob{rawJSON: rawJSON})
+		requeued++
+	}
+	return requeued, dead, nil
+}
+
+func (b *memoryBackend) Heartbeat(hb *WorkerPoolHeartbeat) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.heartbeats[hb.WorkerPoolID] = *hb
+	return nil
+}
+
+func (b *memoryBackend) RemoveHeartbeat(poolID string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	delete(b.heartbeats, poolID)
+	return nil
+}
+
+func (b *memoryBackend) Observe(obs *WorkerObservation) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if obs.IsBusy {
+		b.observations[obs.WorkerID] = *obs
+	} else {
+		delete(b.observations, obs.WorkerID)
+	}
+	return nil
+}
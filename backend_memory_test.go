@@ -0,0 +1,209 @@
+package work
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBackendWorkerPool(t *testing.T) {
+	backend := NewMemoryBackend()
+	enqueuer := NewEnqueuerWithBackend(backend, EnqueuerOptions{})
+	for i := 0; i < 3; i++ {
+		_, err := enqueuer.Enqueue("wat", Q{"i": i})
+		assert.NoError(t, err)
+	}
+	_, err := enqueuer.Enqueue("broken", nil)
+	assert.NoError(t, err)
+
+	var mtx sync.Mutex
+	var handled []int64
+	wp := NewWorkerPoolWithBackend(TestContext{}, 3, backend, WorkerPoolOptions{})
+	wp.Job("wat", func(job *Job) error {
+		mtx.Lock()
+		handled = append(handled, job.ArgInt64("i"))
+		mtx.Unlock()
+		return nil
+	})
+	wp.JobWithOptions("broken", JobOptions{MaxFails: 1}, func(job *Job) error {
+		return fmt.Errorf("ohno")
+	})
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.ElementsMatch(t, []int64{0, 1, 2}, handled)
+	mb := backend.(*memoryBackend)
+	assert.Equal(t, 0, len(mb.queues["wat"]))
+	assert.EqualValues(t, 0, mb.inProgress["wat"])
+	if assert.Equal(t, 1, len(mb.dead)) {
+		job, err := newJob(mb.dead[0].rawJSON, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "broken", job.Name)
+		assert.Equal(t, "ohno", job.LastErr)
+	}
+	assert.Equal(t, 0, len(mb.heartbeats))
+	assert.Equal(t, 0, len(mb.observations))
+
+	_, err = enqueuer.NewBatch()
+	assert.Equal(t, ErrUnsupportedBackend, err)
+}
+
+func TestMemoryBackendFetch(t *testing.T) {
+	backend := NewMemoryBackend()
+	enqueuer := NewEnqueuerWithBackend(backend, EnqueuerOptions{})
+	_, err := backend.RegisterJobTypes("1", map[string]JobOptions{"wat": {MaxConcurrency: 1}, "foo": {}})
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err := enqueuer.Enqueue("wat", Q{"i": i})
+		assert.NoError(t, err)
+	}
+	_, err = enqueuer.Enqueue("foo", nil)
+	assert.NoError(t, err)
+
+	// Job names are tried in order
+	job, err := backend.Fetch("1", []string{"wat", "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "wat", job.Name)
+	assert.EqualValues(t, 0, job.ArgInt64("i"))
+
+	// wat is at its max concurrency
+	job2, err := backend.Fetch("1", []string{"wat", "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", job2.Name)
+	job2, err = backend.Fetch("1", []string{"wat", "foo"})
+	assert.NoError(t, err)
+	assert.Nil(t, job2)
+
+	// The requeued job is fetched first
+	assert.NoError(t, backend.Requeue("1", job))
+	job, err = backend.Fetch("1", []string{"wat"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, job.ArgInt64("i"))
+	assert.NoError(t, backend.Ack("1", job))
+	job, err = backend.Fetch("1", []string{"wat"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, job.ArgInt64("i"))
+}
+
+func TestMemoryBackendUnique(t *testing.T) {
+	backend := NewMemoryBackend()
+	enqueuer := NewEnqueuerWithBackend(backend, EnqueuerOptions{})
+
+	job, err := enqueuer.EnqueueUnique("wat", Q{"a": 1})
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+	job, err = enqueuer.EnqueueUnique("wat", Q{"a": 1})
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	job, err = enqueuer.EnqueueUniqueByKey("foo", Q{"v": 1}, Q{"key": "k"})
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+	job, err = enqueuer.EnqueueUniqueByKey("foo", Q{"v": 2}, Q{"key": "k"})
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	job, err = backend.Fetch("1", []string{"wat"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, job.ArgInt64("a"))
+	job, err = backend.Fetch("1", []string{"foo"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, job.ArgInt64("v"))
+
+	// Once started, the job can be enqueued again
+	job, err = enqueuer.EnqueueUnique("wat", Q{"a": 1})
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+}
+
+func TestMemoryBackendUniqueModes(t *testing.T) {
+	backend := NewMemoryBackend()
+	enqueuer := NewEnqueuerWithBackend(backend, EnqueuerOptions{})
+
+	opts := UniqueOptions{Mode: UniqueUntilFinished}
+	job, err := enqueuer.EnqueueUniqueWithOptions("wat", Q{"a": 1}, opts)
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+	job, err = backend.Fetch("1", []string{"wat"})
+	assert.NoError(t, err)
+	job.failed(errors.New("oops"))
+	assert.NoError(t, backend.Retry("1", job, nowEpochSeconds()))
+	dup, err := enqueuer.EnqueueUniqueWithOptions("wat", Q{"a": 1}, opts)
+	assert.NoError(t, err)
+	assert.Nil(t, dup)
+	assert.NoError(t, backend.Dead("1", job, false))
+	dup, err = enqueuer.EnqueueUniqueWithOptions("wat", Q{"a": 1}, opts)
+	assert.NoError(t, err)
+	assert.NotNil(t, dup)
+
+	opts = UniqueOptions{Mode: UniqueAcrossDead}
+	job, err = enqueuer.EnqueueUniqueWithOptions("foo", Q{"a": 1}, opts)
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+	job, err = backend.Fetch("1", []string{"foo"})
+	assert.NoError(t, err)
+	assert.NoError(t, backend.Dead("1", job, false))
+	dup, err = enqueuer.EnqueueUniqueWithOptions("foo", Q{"a": 1}, opts)
+	assert.NoError(t, err)
+	assert.Nil(t, dup)
+
+	// The TTL still applies
+	setNowEpochSecondsMock(nowEpochSeconds() + defaultUniqueTTLSeconds)
+	defer resetNowEpochSecondsMock()
+	dup, err = enqueuer.EnqueueUniqueWithOptions("foo", Q{"a": 1}, opts)
+	assert.NoError(t, err)
+	assert.NotNil(t, dup)
+}
+
+func TestMemoryBackendRequeueDue(t *testing.T) {
+	backend := NewMemoryBackend()
+	enqueuer := NewEnqueuerWithBackend(backend, EnqueuerOptions{})
+
+	now := nowEpochSeconds()
+	setNowEpochSecondsMock(now)
+	defer resetNowEpochSecondsMock()
+
+	_, err := enqueuer.EnqueueIn("wat", 10, nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.EnqueueIn("wat", 5, nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.EnqueueIn("foo", 5, nil)
+	assert.NoError(t, err)
+
+	requeued, dead, err := backend.RequeueDue(ScheduledSet, []string{"wat"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, requeued)
+	assert.Equal(t, 0, dead)
+
+	setNowEpochSecondsMock(now + 5)
+	requeued, dead, err = backend.RequeueDue(ScheduledSet, []string{"wat"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requeued)
+	assert.Equal(t, 1, dead)
+
+	job, err := backend.Fetch("1", []string{"wat"})
+	assert.NoError(t, err)
+	assert.Equal(t, now+5, job.EnqueuedAt)
+
+	// Retried jobs are due at their retry time
+	job.failed(fmt.Errorf("ohno"))
+	assert.NoError(t, backend.Retry("1", job, (now+7)*1000))
+	requeued, _, err = backend.RequeueDue(RetrySet, []string{"wat"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, requeued)
+	setNowEpochSecondsMock(now + 7)
+	requeued, _, err = backend.RequeueDue(RetrySet, []string{"wat"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requeued)
+
+	job, err = backend.Fetch("1", []string{"wat"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, job.Fails)
+	assert.Equal(t, now+7, job.EnqueuedAt)
+	assert.Equal(t, now+5, job.FirstEnqueuedAt)
+	assert.Equal(t, 1, len(backend.(*memoryBackend).scheduled))
+}
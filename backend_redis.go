@@ -0,0 +1,674 @@
+package work
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+type terminateOp func(conn redis.Conn)
+
+// RedisBackendOptions can be passed to NewRedisBackendWithOptions.
+type RedisBackendOptions struct {
+	Logger Logger // If not set, errors are printed to stdout
+}
+
+type fetchKeysID struct {
+	poolID  string
+	jobName string
+}
+
+// redisBackend is the Backend storing jobs in Redis under a namespace.
+// The features that aren't part of Backend, such as batches, workflows, the dead pool reaper,
+// periodic jobs and the Client, work straight off the same keys.
+type redisBackend struct {
+	namespace               string
+	pool                    Pool
+	logger                  Logger
+	queuePrefix             string // eg, "myapp-work:jobs:"
+	knownJobs               map[string]int64
+	mtx                     sync.RWMutex
+	fetchKeys               sync.Map // fetchKeysID -> []interface{}
+	fetchScript             *redis.Script
+	enqueueUniqueScript     *redis.Script
+	enqueueUniqueInScript   *redis.Script
+	requeueScript           *redis.Script
+	requeueInFlightScript   *redis.Script
+	batchDoneScript         *redis.Script
+	releaseDependentsScript *redis.Script
+	parentDiedScript        *redis.Script
+	cancelDependentsScript  *redis.Script
+}
+
+// NewRedisBackend returns the Backend storing jobs in Redis under the specified namespace,
+// as used by NewEnqueuer and NewWorkerPool.
+func NewRedisBackend(namespace string, pool Pool) Backend {
+	return NewRedisBackendWithOptions(namespace, pool, RedisBackendOptions{})
+}
+
+// NewRedisBackendWithOptions returns a Redis backend as per NewRedisBackend,
+// but permits you to specify additional options such as a logger.
+func NewRedisBackendWithOptions(namespace string, pool Pool, opts RedisBackendOptions) Backend {
+	if isNilPool(pool) {
+		panic("NewRedisBackend needs a non-nil Pool")
+	}
+	return newRedisBackend(namespace, pool, opts.Logger)
+}
+
+func newRedisBackend(namespace string, pool Pool, logger Logger) *redisBackend {
+	return &redisBackend{
+		namespace:               namespace,
+		pool:                    pool,
+		logger:                  logger,
+		queuePrefix:             redisKeyJobsPrefix(namespace),
+		knownJobs:               make(map[string]int64),
+		fetchScript:             redis.NewScript(-1, redisLuaFetchJob),
+		enqueueUniqueScript:     redis.NewScript(2, redisLuaEnqueueUnique),
+		enqueueUniqueInScript:   redis.NewScript(2, redisLuaEnqueueUniqueIn),
+		requeueScript:           redis.NewScript(-1, redisLuaZremLpushCmd),
+		requeueInFlightScript:   redis.NewScript(4, redisLuaRequeueInFlightJob),
+		batchDoneScript:         redis.NewScript(2, redisLuaBatchJobDone),
+		releaseDependentsScript: redis.NewScript(-1, redisLuaReleaseDependents),
+		parentDiedScript:        redis.NewScript(-1, redisLuaParentDied),
+		cancelDependentsScript:  redis.NewScript(-1, redisLuaCancelDependents),
+	}
+}
+
+func (b *redisBackend) Enqueue(job *Job) error {
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return err
+	}
+
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	sendJobStatus(conn, b.namespace, job, JobQueued)
+	if _, err := conn.Do("LPUSH", b.queuePrefix+job.Name, rawJSON); err != nil {
+		return err
+	}
+	return b.addToKnownJobs(conn, job.Name)
+}
+
+func (b *redisBackend) Schedule(job *Job, runAt int64) error {
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return err
+	}
+
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	sendJobStatus(conn, b.namespace, job, JobQueued)
+	if _, err := conn.Do("ZADD", redisKeyScheduled(b.namespace), runAt, rawJSON); err != nil {
+		return err
+	}
+	return b.addToKnownJobs(conn, job.Name)
+}
+
+func (b *redisBackend) EnqueueUnique(job *Job, runAt int64, replaceArgs bool) (bool, error) {
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return false, err
+	}
+
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	if err := b.addToKnownJobs(conn, job.Name); err != nil {
+		return false, err
+	}
+
+	scriptArgs := []interface{}{}
+	script := b.enqueueUniqueScript
+
+	scriptArgs = append(scriptArgs, b.queuePrefix+job.Name) // KEY[1]
+	scriptArgs = append(scriptArgs, job.UniqueKey)          // KEY[2]
+	scriptArgs = append(scriptArgs, rawJSON)                // ARGV[1]
+	if replaceArgs {
+		// we will use this for updated arguments since the job on the queue
+		// doesn't get updated
+		scriptArgs = append(scriptArgs, rawJSON) // ARGV[2]
+	} else {
+		// keying on arguments so arguments can't be updated
+		// we will just get them off the original job so to save space, make this its ID, telling which job holds the key
+		scriptArgs = append(scriptArgs, job.ID) // ARGV[2]
+	}
+	scriptArgs = append(scriptArgs, job.uniqueTTL()) // ARGV[3]
+
+	if runAt != 0 { // Scheduled job so different job queue with additional arg
+		scriptArgs[0] = redisKeyScheduled(b.namespace) // KEY[1]
+		scriptArgs = append(scriptArgs, runAt)         // ARGV[4]
+
+		script = b.enqueueUniqueInScript
+	}
+
+	// The status is set first so that it can't override the one set when the job is fetched
+	sendJobStatus(conn, b.namespace, job, JobQueued)
+	res, err := redis.String(script.Do(conn, scriptArgs...))
+	if res != "ok" && job.StatusTTL > 0 {
+		conn.Do("DEL", redisKeyJobStatus(b.namespace, job.ID))
+	}
+	return res == "ok", err
+}
+
+func (b *redisBackend) addToKnownJobs(conn redis.Conn, jobName string) error {
+	needSadd := true
+	now := time.Now().Unix()
+
+	b.mtx.RLock()
+	t, ok := b.knownJobs[jobName]
+	b.mtx.RUnlock()
+
+	if ok {
+		if now < t {
+			needSadd = false
+		}
+	}
+
+	if needSadd {
+		if _, err := conn.Do("SADD", redisKeyKnownJobs(b.namespace), jobName); err != nil {
+			logError(b.logger, "enqueuer.add_to_known_jobs", err, "namespace", b.namespace, "job_name", jobName)
+			return err
+		}
+
+		b.mtx.Lock()
+		b.knownJobs[jobName] = now + 300
+		b.mtx.Unlock()
+	}
+	return nil
+}
+
+// unknownJobs returns the distinct names of jobNames
+// that aren't known to have been added to the set of known jobs recently.
+func (b *redisBackend) unknownJobs(jobNames []string) []string {
+	now := time.Now().Unix()
+	seen := make(map[string]bool)
+	var names []string
+
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	for _, jobName := range jobNames {
+		if seen[jobName] {
+			continue
+		}
+		seen[jobName] = true
+		if t, ok := b.knownJobs[jobName]; !ok || now >= t {
+			names = append(names, jobName)
+		}
+	}
+	return names
+}
+
+func (b *redisBackend) addKnownJobs(jobNames []string) {
+	expiresAt := time.Now().Unix() + 300
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, jobName := range jobNames {
+		b.knownJobs[jobName] = expiresAt
+	}
+}
+
+func (b *redisBackend) RegisterJobTypes(poolID string, jobOpts map[string]JobOptions) (map[string]uint, error) {
+	if len(jobOpts) == 0 {
+		return nil, nil
+	}
+
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	priorities, err := writeJobControls(conn, b.namespace, jobOpts)
+	errs := []error{err}
+
+	knownJobs := redis.Args{redisKeyKnownJobs(b.namespace)}
+	for jobName, opts := range jobOpts {
+		rateLimitKey := redisKeyJobsRateLimit(b.namespace, jobName)
+		var err error
+		if rl := opts.RateLimit; rl.Limit > 0 && rl.Interval > 0 {
+			_, err = conn.Do("HSET", rateLimitKey, "limit", rl.Limit, "interval_ms", rl.intervalMilliseconds())
+		} else {
+			_, err = conn.Do("HDEL", rateLimitKey, "limit", "interval_ms")
+		}
+		errs = append(errs, err)
+		knownJobs = knownJobs.Add(jobName)
+	}
+
+	_, err = conn.Do("SADD", knownJobs...)
+	errs = append(errs, err)
+	return priorities, errors.Join(errs...)
+}
+
+// fetchKeysPerJobType is the number of keys returned by keysToFetch.
+const fetchKeysPerJobType = 7
+
+// keysToFetch returns the keys the fetch script needs for jobs named jobName.
+func (b *redisBackend) keysToFetch(poolID, jobName string) []interface{} {
+	id := fetchKeysID{poolID: poolID, jobName: jobName}
+	if keys, ok := b.fetchKeys.Load(id); ok {
+		return keys.([]interface{})
+	}
+
+	keys := []interface{}{
+		redisKeyJobs(b.namespace, jobName),
+		redisKeyJobsInProgress(b.namespace, poolID, jobName),
+		redisKeyJobsPaused(b.namespace, jobName),
+		redisKeyJobsLock(b.namespace, jobName),
+		redisKeyJobsLockInfo(b.namespace, jobName),
+		redisKeyJobsConcurrency(b.namespace, jobName),
+		redisKeyJobsRateLimit(b.namespace, jobName),
+	}
+	b.fetchKeys.Store(id, keys)
+	return keys
+}
+
+func (b *redisBackend) Fetch(poolID string, jobNames []string) (*Job, error) {
+	numKeys := len(jobNames)*fetchKeysPerJobType + 1
+	scriptArgs := make([]interface{}, 0, numKeys+3)
+	scriptArgs = append(scriptArgs, numKeys)
+	scriptArgs = append(scriptArgs, redisKeyCancelledJobs(b.namespace)) // KEYS[1]
+	for _, jobName := range jobNames {
+		scriptArgs = append(scriptArgs, b.keysToFetch(poolID, jobName)...) // KEYS[2-1 + 7 * N]
+	}
+	scriptArgs = append(scriptArgs, poolID, nowEpochMilliseconds()) // ARGV[1], ARGV[2]
+
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.Values(b.fetchScript.Do(conn, scriptArgs...))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(values) != 4 {
+		return nil, fmt.Errorf("need 4 elements back")
+	}
+
+	rawJSON, ok := values[0].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("response message not bytes")
+	}
+
+	dequeuedFrom, ok := values[1].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("response queue not bytes")
+	}
+
+	inProgQueue, ok := values[2].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("response in prog not bytes")
+	}
+
+	job, err := newJob(rawJSON, dequeuedFrom, inProgQueue)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Unique {
+		updatedJob := b.getAndDeleteUniqueJob(conn, poolID, job)
+		// This is to support the old way of doing it, where we used the job off the queue and just deleted the unique key
+		// Going forward the job on the queue will always be just a placeholder, and we will be replacing it with the
+		// updated job extracted here
+		if updatedJob != nil {
+			job = updatedJob
+		}
+	}
+
+	// The job may have been cancelled with Client.CancelJob before it was fetched
+	job.cancelled, _ = redis.Bool(values[3], nil)
+
+	if job.StatusTTL > 0 && !job.cancelled {
+		sendJobStatus(conn, b.namespace, job, JobRunning)
+		if _, err := conn.Do(""); err != nil {
+			logError(b.logger, "worker.fetch.job_status", err, b.jobFields(poolID, job)...)
+		}
+	}
+	return job, nil
+}
+
+func (b *redisBackend) getAndDeleteUniqueJob(conn redis.Conn, poolID string, job *Job) *Job {
+	var uniqueKey string
+	var err error
+	if job.UniqueKey != "" {
+		uniqueKey = job.UniqueKey
+	} else { // For jobs put in queue prior to this change. In the future this can be deleted as there will always be a UniqueKey
+		uniqueKey, err = redisKeyUniqueJob(b.namespace, job.Name, job.Args)
+		if err != nil {
+			logError(b.logger, "worker.delete_unique_job.key", err, b.jobFields(poolID, job)...)
+			return nil
+		}
+	}
+
+	rawJSON, err := redis.Bytes(conn.Do("GET", uniqueKey))
+	if err == redis.ErrNil && job.UniqueMode != UniqueUntilStarted {
+		// The key expired, or the job is being retried and doesn't hold it anymore
+		return nil
+	} else if err != nil {
+		logError(b.logger, "worker.delete_unique_job.get", err, b.jobFields(poolID, job)...)
+		return nil
+	}
+
+	if !job.uniqueWhileRunning() {
+		_, err = conn.Do("DEL", uniqueKey)
+		if err != nil {
+			logError(b.logger, "worker.delete_unique_job.del", err, b.jobFields(poolID, job)...)
+			return nil
+		}
+	}
+
+	// The key holds the ID of the job unless its arguments were updated, or 1 for previous versions, so in these cases we should do nothing.
+	if len(rawJSON) == 0 || rawJSON[0] != '{' {
+		return nil
+	}
+
+	// The job pulled off the queue was just a placeholder with no args, so replace it
+	jobWithArgs, err := newJob(rawJSON, job.dequeuedFrom, job.inProgQueue)
+	if err != nil {
+		logError(b.logger, "worker.delete_unique_job.updated_job", err, b.jobFields(poolID, job)...)
+		return nil
+	}
+	if job.UniqueMode != UniqueUntilStarted {
+		// The job can be fetched again once it's retried, so only its args are replaced
+		job.Args = jobWithArgs.Args
+		return job
+	}
+	return jobWithArgs
+}
+
+// jobFields returns the structured logging fields identifying job, as fetched by poolID.
+func (b *redisBackend) jobFields(poolID string, job *Job) []interface{} {
+	return []interface{}{"namespace", b.namespace, "job_name", job.Name, "job_id", job.ID, "worker_pool_id", poolID}
+}
+
+// terminate removes job from the jobs in progress of poolID along with fate, in a single transaction.
+func (b *redisBackend) terminate(poolID string, job *Job, fate terminateOp) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	conn.Send("LREM", job.inProgQueue, 1, job.rawJSON)
+	conn.Send("DECR", redisKeyJobsLock(b.namespace, job.Name))
+	conn.Send("HINCRBY", redisKeyJobsLockInfo(b.namespace, job.Name), poolID, -1)
+	fate(conn)
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+func (b *redisBackend) Ack(poolID string, job *Job) error {
+	fate := withUniqueKey(job, false, false, withStatus(b.namespace, job, JobSucceeded, terminateOnly))
+	return b.terminate(poolID, job, b.terminateDone(job, false, fate))
+}
+
+func (b *redisBackend) Retry(poolID string, job *Job, retryAt int64) error {
+	rawJSON, err := job.serialize()
+	if err != nil {
+		// it still has to be taken off the jobs in progress
+		return errors.Join(err, b.terminate(poolID, job, terminateOnly))
+	}
+	return b.terminate(poolID, job, withStatus(b.namespace, job, JobRetrying, func(conn redis.Conn) {
+		conn.Send("ZADD", redisKeyRetry(b.namespace), retryAt, rawJSON)
+		if job.Unique && job.UniqueKey != "" && job.UniqueMode == UniqueWhileQueuedOrRetrying {
+			// Take the key back, unless another job with the same key was enqueued while this one ran
+			conn.Send("SET", job.UniqueKey, job.ID, "NX", "EX", job.uniqueTTL())
+		}
+	}))
+}
+
+func (b *redisBackend) Dead(poolID string, job *Job, discard bool) error {
+	fate := terminateOnly
+	var serializeErr error
+	if !discard {
+		if rawJSON, err := job.serialize(); err != nil {
+			serializeErr = err
+		} else {
+			fate = func(conn redis.Conn) {
+				// The dead jobs are pruned by the worker pools with WorkerPoolOptions.MaxDeadJobs or MaxDeadAge,
+				// rather than here, so that the dead queue isn't trimmed each time a job dies
+				conn.Send("ZADD", redisKeyDead(b.namespace), nowEpochSeconds(), rawJSON)
+			}
+		}
+	}
+	fate = withUniqueKey(job, true, discard, withStatus(b.namespace, job, JobDead, fate))
+	err := b.terminate(poolID, job, b.terminateDone(job, true, fate))
+	if err == nil && len(job.Dependents) > 0 {
+		err = b.cancelDependents(job)
+	}
+	return errors.Join(serializeErr, err)
+}
+
+// cancelDependents cancels the dependents of the dead job which are cancelled when a job they depend on dies,
+// then their own dependents, and so on. The dependents are cancelled a level at a time,
+// so that the script is passed the keys of the waiting hashes it accesses.
+func (b *redisBackend) cancelDependents(job *Job) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	errMsg := "cancelled as job " + job.ID + " died"
+	for ids := job.Dependents; len(ids) > 0; {
+		args := redis.Args{len(ids)}
+		for _, id := range ids {
+			args = args.Add(redisKeyWaitingJob(b.namespace, id))
+		}
+		args = args.Add(nowEpochSeconds(), redisKeyJobStatusPrefix(b.namespace), errMsg)
+
+		var err error
+		if ids, err = redis.Strings(b.cancelDependentsScript.Do(conn, args...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *redisBackend) Requeue(poolID string, job *Job) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	sendJobStatus(conn, b.namespace, job, JobQueued)
+	_, err := b.requeueInFlightScript.Do(conn,
+		job.inProgQueue,
+		job.dequeuedFrom,
+		redisKeyJobsLock(b.namespace, job.Name),
+		redisKeyJobsLockInfo(b.namespace, job.Name),
+		job.rawJSON,
+		poolID)
+	return err
+}
+
+func (b *redisBackend) RequeueDue(set string, jobNames []string) (requeued int, dead int, err error) {
+	if set != ScheduledSet && set != RetrySet {
+		return 0, 0, fmt.Errorf("work: unknown set %q", set)
+	}
+
+	args := make([]interface{}, 0, len(jobNames)+7)
+	args = append(args, len(jobNames)+2)
+	args = append(args, redisNamespacePrefix(b.namespace)+set) // KEY[1]
+	args = append(args, redisKeyDead(b.namespace))             // KEY[2]
+	for _, jobName := range jobNames {
+		args = append(args, redisKeyJobs(b.namespace, jobName)) // KEY[3, 4, ...]
+	}
+	args = append(args, b.queuePrefix, nowEpochSeconds(), nowEpochMilliseconds()) // ARGV[1], ARGV[2], ARGV[3]
+	args = append(args, redisKeyJobStatusPrefix(b.namespace))                     // ARGV[4]
+
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	for {
+		res, err := redis.String(b.requeueScript.Do(conn, args...))
+		if err == redis.ErrNil {
+			return requeued, dead, nil
+		} else if err != nil {
+			return requeued, dead, err
+		}
+
+		switch res {
+		case "ok":
+			requeued++
+		case "dead":
+			dead++
+		case "dup": // a unique periodic job dropped as another one holds its key
+		default:
+			return requeued, dead, nil
+		}
+	}
+}
+
+func (b *redisBackend) Heartbeat(hb *WorkerPoolHeartbeat) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	conn.Send("SADD", redisKeyWorkerPools(b.namespace), hb.WorkerPoolID)
+	conn.Send("HMSET", redisKeyHeartbeat(b.namespace, hb.WorkerPoolID),
+		"heartbeat_at", hb.HeartbeatAt,
+		"started_at", hb.StartedAt,
+		"job_names", strings.Join(hb.JobNames, ","),
+		"concurrency", hb.Concurrency,
+		"worker_ids", strings.Join(hb.WorkerIDs, ","),
+		"host", hb.Host,
+		"pid", hb.Pid,
+	)
+	return conn.Flush()
+}
+
+func (b *redisBackend) RemoveHeartbeat(poolID string) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	conn.Send("SREM", redisKeyWorkerPools(b.namespace), poolID)
+	conn.Send("DEL", redisKeyHeartbeat(b.namespace, poolID))
+	return conn.Flush()
+}
+
+func (b *redisBackend) Observe(obs *WorkerObservation) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+	key := redisKeyWorkerObservation(b.namespace, obs.WorkerID)
+
+	if !obs.IsBusy {
+		_, err := conn.Do("DEL", key)
+		return err
+	}
+
+	// hash:
+	// job_name -> obs.JobName
+	// job_id -> obs.JobID
+	// started_at -> obs.StartedAt
+	// args -> obs.ArgsJSON
+	// checkin -> obs.Checkin
+	// checkin_at -> obs.CheckinAt
+	args := make([]interface{}, 0, 13)
+	args = append(args,
+		key,
+		"job_name", obs.JobName,
+		"job_id", obs.JobID,
+		"started_at", obs.StartedAt,
+		"args", obs.ArgsJSON,
+	)
+
+	if (obs.Checkin != "") && (obs.CheckinAt > 0) {
+		args = append(args,
+			"checkin", obs.Checkin,
+			"checkin_at", obs.CheckinAt,
+		)
+	}
+
+	conn.Send("HMSET", args...)
+	conn.Send("EXPIRE", key, 60*60*24)
+	return conn.Flush()
+}
+
+func terminateOnly(_ redis.Conn) {
+	return
+}
+
+// withStatus sets the status of job to state along with fate, if it's tracked.
+func withStatus(namespace string, job *Job, state JobState, fate terminateOp) terminateOp {
+	if job.StatusTTL <= 0 {
+		return fate
+	}
+	return func(conn redis.Conn) {
+		fate(conn)
+		sendJobStatus(conn, namespace, job, state)
+	}
+}
+
+// withUniqueKey releases the unique key of job along with fate,
+// if it does once it succeeded or died as per its UniqueMode.
+func withUniqueKey(job *Job, died, discarded bool, fate terminateOp) terminateOp {
+	if !job.releasesUniqueKey(died, discarded) {
+		return fate
+	}
+	return func(conn redis.Conn) {
+		fate(conn)
+		conn.Send("DEL", job.UniqueKey)
+	}
+}
+
+// sendJobStatus sends the commands setting the status of job to state, if it's tracked,
+// without flushing them. The status expires after the StatusTTL of job.
+func sendJobStatus(conn redis.Conn, namespace string, job *Job, state JobState) {
+	if job.StatusTTL <= 0 {
+		return
+	}
+	key := redisKeyJobStatus(namespace, job.ID)
+	args := redis.Args{key, "state", state, "name", job.Name, "updated_at", nowEpochSeconds(), "fails", job.Fails, "err", job.LastErr}
+	if job.result != nil {
+		args = args.Add("result", job.result)
+	}
+	conn.Send("HSET", args...)
+	conn.Send("EXPIRE", key, job.StatusTTL)
+}
+
+// terminateDone wraps fate with what happens once job is done, ie, it succeeded or died.
+func (b *redisBackend) terminateDone(job *Job, died bool, fate terminateOp) terminateOp {
+	if job.BatchID != "" {
+		fate = b.terminateInBatch(job, died, fate)
+	}
+	if len(job.Dependents) > 0 {
+		fate = b.terminateWithDependents(job, died, fate)
+	}
+	return fate
+}
+
+// terminateInBatch counts job as done in its batch, along with fate.
+// The batch's callbacks are enqueued in the same transaction if job was the last one pending.
+func (b *redisBackend) terminateInBatch(job *Job, died bool, fate terminateOp) terminateOp {
+	diedArg := "0"
+	if died {
+		diedArg = "1"
+	}
+	return func(conn redis.Conn) {
+		fate(conn)
+		b.batchDoneScript.Send(conn, redisKeyBatch(b.namespace, job.BatchID), redisKeyBatchDone(b.namespace, job.BatchID), nowEpochSeconds(), batchKeepSeconds, diedArg, job.ID)
+	}
+}
+
+// terminateWithDependents releases the jobs waiting on job if it succeeded,
+// or parks them if it died, along with fate. The dependents to cancel are cancelled after, with cancelDependents.
+func (b *redisBackend) terminateWithDependents(job *Job, died bool, fate terminateOp) terminateOp {
+	return func(conn redis.Conn) {
+		fate(conn)
+		args := redis.Args{}
+		if died {
+			args = args.Add(len(job.Dependents)+1, redisKeyDead(b.namespace))
+		} else {
+			args = args.Add(len(job.Dependents))
+		}
+		for _, id := range job.Dependents {
+			args = args.Add(redisKeyWaitingJob(b.namespace, id))
+		}
+		args = args.Add(nowEpochSeconds(), job.ID)
+		if died {
+			b.parentDiedScript.Send(conn, args.Add(redisKeyJobStatusPrefix(b.namespace))...)
+		} else {
+			b.releaseDependentsScript.Send(conn, args...)
+		}
+	}
+}
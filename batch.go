@@ -0,0 +1,196 @@
+package work
+
+import (
+	"errors"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// batchKeepSeconds is how long the status of a finished batch is kept.
+const batchKeepSeconds = 7 * 24 * 60 * 60
+
+var (
+	// ErrBatchNotFound is returned when a batch doesn't exist,
+	// or finished too long ago to still be known.
+	ErrBatchNotFound = errors.New("work: batch not found")
+	// ErrBatchClosed is returned when enqueuing a job into a batch that was closed.
+	ErrBatchClosed = errors.New("work: batch is closed")
+)
+
+// BatchCallback is a job enqueued when a batch finishes.
+// The ID of the batch is added to its arguments as "batch_id".
+type BatchCallback struct {
+	JobName string
+	Args    map[string]interface{}
+}
+
+// BatchOptions can be passed to NewBatchWithOptions.
+type BatchOptions struct {
+	OnSuccess  *BatchCallback // Enqueued when the batch finishes if none of its jobs died.
+	OnComplete *BatchCallback // Enqueued when the batch finishes, whether or not any of its jobs died.
+}
+
+// Batch is a group of jobs that is tracked as a whole.
+// A batch finishes once it was closed and each of its jobs either succeeded or died
+// (or failed while its job type has SkipDead set). Jobs being retried are still pending.
+type Batch struct {
+	ID       string
+	enqueuer *Enqueuer
+}
+
+// NewBatch creates a new batch without callbacks.
+func (e *Enqueuer) NewBatch() (*Batch, error) {
+	return e.NewBatchWithOptions(BatchOptions{})
+}
+
+// NewBatchWithOptions creates a new batch as per the NewBatch function,
+// but permits you to specify jobs to enqueue when the batch finishes.
+func (e *Enqueuer) NewBatchWithOptions(batchOpts BatchOptions) (*Batch, error) {
+	if e.redis == nil {
+		return nil, ErrUnsupportedBackend
+	}
+
+	batch := e.Batch(makeIdentifier())
+	args := redis.Args{redisKeyBatch(e.Namespace, batch.ID), "created_at", nowEpochSeconds()}
+	var callbackNames []string
+	for _, cb := range []struct {
+		field    string
+		callback *BatchCallback
+	}{
+		{"on_success", batchOpts.OnSuccess},
+		{"on_complete", batchOpts.OnComplete},
+	} {
+		if cb.callback == nil {
+			continue
+		}
+		job := &Job{
+			Name:       cb.callback.JobName,
+			ID:         makeIdentifier(),
+			EnqueuedAt: nowEpochSeconds(),
+		}
+		for k, v := range cb.callback.Args {
+			job.setArg(k, v)
+		}
+		job.setArg("batch_id", batch.ID)
+
+		rawJSON, err := job.serialize()
+		if err != nil {
+			return nil, err
+		}
+		args = args.Add(cb.field+"_queue", e.queuePrefix+job.Name, cb.field, rawJSON)
+		callbackNames = append(callbackNames, job.Name)
+	}
+
+	conn := e.Pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("HSET", args...); err != nil {
+		return nil, err
+	}
+	for _, jobName := range callbackNames {
+		if err := e.redis.addToKnownJobs(conn, jobName); err != nil {
+			return nil, err
+		}
+	}
+	return batch, nil
+}
+
+// Batch returns the batch with the specified ID, eg, to enqueue jobs into a batch created elsewhere.
+// It doesn't check that the batch exists: that's done when enqueuing jobs into it.
+func (e *Enqueuer) Batch(batchID string) *Batch {
+	return &Batch{ID: batchID, enqueuer: e}
+}
+
+// Enqueue enqueues the specified job name and arguments into the batch.
+// It returns ErrBatchClosed if the batch was closed, and ErrBatchNotFound if it doesn't exist.
+func (b *Batch) Enqueue(jobName string, args map[string]interface{}) (*Job, error) {
+	return b.enqueue(jobName, args, nil)
+}
+
+// EnqueueIn enqueues a job of the batch in the scheduled job queue for execution in secondsFromNow seconds.
+// See Enqueue for the errors returned.
+func (b *Batch) EnqueueIn(jobName string, secondsFromNow int64, args map[string]interface{}) (*ScheduledJob, error) {
+	runAt := nowEpochSeconds() + secondsFromNow
+	job, err := b.enqueue(jobName, args, &runAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ScheduledJob{RunAt: runAt, Job: job}, nil
+}
+
+func (b *Batch) enqueue(jobName string, args map[string]interface{}, runAt *int64) (*Job, error) {
+	e := b.enqueuer
+	if e.redis == nil {
+		return nil, ErrUnsupportedBackend
+	}
+
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		BatchID:    b.ID,
+		StatusTTL:  e.statusTTL,
+	}
+
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := e.Pool.Get()
+	defer conn.Close()
+
+	var queue string
+	var at interface{}
+	if runAt != nil {
+		queue, at = redisKeyScheduled(e.Namespace), *runAt*1000
+	} else {
+		queue, at = e.queuePrefix+jobName, ""
+	}
+
+	// The status is set first so that it can't override the one set when the job is fetched
+	sendJobStatus(conn, e.Namespace, job, JobQueued)
+	res, err := redis.String(e.batchEnqueueScript.Do(conn, redisKeyBatch(e.Namespace, b.ID), queue, rawJSON, at))
+	if err == nil {
+		err = batchScriptError(res)
+	}
+	if err != nil {
+		if job.StatusTTL > 0 {
+			conn.Do("DEL", redisKeyJobStatus(e.Namespace, job.ID))
+		}
+		return nil, err
+	}
+
+	err = e.redis.addToKnownJobs(conn, jobName)
+	return job, err
+}
+
+// Close marks the batch as having all of its jobs enqueued, so that no more jobs can be enqueued into it.
+// The batch can't finish before it is closed, so that it doesn't finish early
+// if its first jobs are done before the last ones are enqueued.
+// If all of the jobs of the batch are already done, the batch finishes right away.
+func (b *Batch) Close() error {
+	if b.enqueuer.redis == nil {
+		return ErrUnsupportedBackend
+	}
+
+	conn := b.enqueuer.Pool.Get()
+	defer conn.Close()
+
+	res, err := redis.String(b.enqueuer.batchCloseScript.Do(conn, redisKeyBatch(b.enqueuer.Namespace, b.ID), redisKeyBatchDone(b.enqueuer.Namespace, b.ID), nowEpochSeconds(), batchKeepSeconds))
+	if err != nil {
+		return err
+	}
+	return batchScriptError(res)
+}
+
+func batchScriptError(res string) error {
+	switch res {
+	case "missing":
+		return ErrBatchNotFound
+	case "closed":
+		return ErrBatchClosed
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package work
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchSuccess(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+	client := NewClient(ns, pool)
+
+	batch, err := enqueuer.NewBatchWithOptions(BatchOptions{
+		OnSuccess:  &BatchCallback{JobName: "on_success", Args: Q{"export": 7}},
+		OnComplete: &BatchCallback{JobName: "on_complete"},
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		job, err := batch.Enqueue("wat", Q{"i": i})
+		assert.NoError(t, err)
+		assert.Equal(t, batch.ID, job.BatchID)
+	}
+	scheduled, err := batch.EnqueueIn("wat", 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, batch.ID, scheduled.BatchID)
+
+	status, err := client.BatchStatus(batch.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, status.Total)
+	assert.EqualValues(t, 4, status.Pending)
+	assert.False(t, status.Closed)
+
+	assert.Equal(t, []string{"on_complete", "on_success", "wat"}, knownJobs(pool, redisKeyKnownJobs(ns)))
+
+	// Work the queued jobs before the batch is closed: it mustn't finish yet
+	jobTypes := map[string]*jobType{
+		"wat": {
+			Name:           "wat",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 3},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { return nil },
+		},
+	}
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	status, err = client.BatchStatus(batch.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, status.Pending)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "on_success")))
+
+	assert.NoError(t, batch.Close())
+	assert.Equal(t, ErrBatchClosed, batch.Close())
+	_, err = batch.Enqueue("wat", nil)
+	assert.Equal(t, ErrBatchClosed, err)
+
+	// Move the scheduled job to its queue and work it
+	_, j := jobOnZset(pool, redisKeyScheduled(ns))
+	conn := pool.Get()
+	_, err = conn.Do("DEL", redisKeyScheduled(ns))
+	assert.NoError(t, err)
+	raw, _ := j.serialize()
+	_, err = conn.Do("LPUSH", redisKeyJobs(ns, "wat"), raw)
+	assert.NoError(t, err)
+	conn.Close()
+
+	w.start()
+	w.drain()
+	w.stop()
+
+	status, err = client.BatchStatus(batch.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, status.Total)
+	assert.EqualValues(t, 0, status.Pending)
+	assert.EqualValues(t, 0, status.Failed)
+	assert.True(t, status.Closed)
+	assert.True(t, status.FinishedAt > 0)
+
+	onSuccess := jobOnQueue(pool, redisKeyJobs(ns, "on_success"))
+	assert.Equal(t, batch.ID, onSuccess.ArgString("batch_id"))
+	assert.EqualValues(t, 7, onSuccess.ArgInt64("export"))
+	assert.Equal(t, "", onSuccess.BatchID)
+	onComplete := jobOnQueue(pool, redisKeyJobs(ns, "on_complete"))
+	assert.Equal(t, batch.ID, onComplete.ArgString("batch_id"))
+}
+
+func TestBatchFailure(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+	client := NewClient(ns, pool)
+
+	batch, err := enqueuer.NewBatchWithOptions(BatchOptions{
+		OnSuccess:  &BatchCallback{JobName: "on_success"},
+		OnComplete: &BatchCallback{JobName: "on_complete"},
+	})
+	assert.NoError(t, err)
+
+	_, err = batch.Enqueue("ok", nil)
+	assert.NoError(t, err)
+	_, err = batch.Enqueue("flaky", nil)
+	assert.NoError(t, err)
+	_, err = batch.Enqueue("broken", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, batch.Close())
+
+	jobTypes := map[string]*jobType{
+		"ok": {
+			Name:           "ok",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 3},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { return nil },
+		},
+		"flaky": {
+			Name:           "flaky",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 3},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { return fmt.Errorf("try again") },
+		},
+		"broken": {
+			Name:           "broken",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 1},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { return fmt.Errorf("ohno") },
+		},
+	}
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	// The flaky job is being retried, so it's still pending
+	status, err := client.BatchStatus(batch.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, status.Total)
+	assert.EqualValues(t, 1, status.Pending)
+	assert.EqualValues(t, 1, status.Failed)
+	assert.EqualValues(t, 0, status.FinishedAt)
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(ns)))
+
+	// Make the flaky job die
+	_, j := jobOnZset(pool, redisKeyRetry(ns))
+	j.Fails = 3
+	conn := pool.Get()
+	_, err = conn.Do("DEL", redisKeyRetry(ns))
+	assert.NoError(t, err)
+	raw, _ := j.serialize()
+	_, err = conn.Do("LPUSH", redisKeyJobs(ns, "flaky"), raw)
+	assert.NoError(t, err)
+	conn.Close()
+
+	w.start()
+	w.drain()
+	w.stop()
+
+	status, err = client.BatchStatus(batch.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, status.Pending)
+	assert.EqualValues(t, 2, status.Failed)
+	assert.True(t, status.FinishedAt > 0)
+
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "on_success")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "on_complete")))
+
+	// Dead jobs retried after the batch finished don't count anymore
+	jobTypes["broken"].GenericHandler = func(job *Job) error { return nil }
+	assert.NoError(t, client.RetryAllDeadJobs())
+	w.start()
+	w.drain()
+	w.stop()
+
+	status, err = client.BatchStatus(batch.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, status.Pending)
+	assert.EqualValues(t, 2, status.Failed)
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "on_success")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "on_complete")))
+}
+
+func TestBatchRetriedDeadJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+	client := NewClient(ns, pool)
+
+	batch, err := enqueuer.NewBatchWithOptions(BatchOptions{
+		OnSuccess: &BatchCallback{JobName: "on_success"},
+	})
+	assert.NoError(t, err)
+	_, err = batch.Enqueue("broken", nil)
+	assert.NoError(t, err)
+	_, err = batch.Enqueue("later", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, batch.Close())
+
+	jobTypes := map[string]*jobType{
+		"broken": {
+			Name:           "broken",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 1},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { return fmt.Errorf("ohno") },
+		},
+	}
+	run := func() {
+		w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+		w.start()
+		w.drain()
+		w.stop()
+	}
+	assertStatus := func(pending, failed int64) {
+		status, err := client.BatchStatus(batch.ID)
+		assert.NoError(t, err)
+		assert.EqualValues(t, pending, status.Pending)
+		assert.EqualValues(t, failed, status.Failed)
+		assert.EqualValues(t, 0, status.FinishedAt)
+	}
+
+	run()
+	assertStatus(1, 1)
+
+	// Dying again after being retried while the batch is open isn't counted twice
+	assert.NoError(t, client.RetryAllDeadJobs())
+	run()
+	assertStatus(1, 1)
+
+	// Succeeding once retried isn't counted as done twice, and isn't failed anymore
+	jobTypes["broken"].GenericHandler = func(job *Job) error { return nil }
+	assert.NoError(t, client.RetryAllDeadJobs())
+	run()
+	assertStatus(1, 0)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "on_success")))
+
+	// So the batch finishes successfully once its last job succeeds
+	jobTypes = map[string]*jobType{
+		"later": {
+			Name:           "later",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 1},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { return nil },
+		},
+	}
+	run()
+	status, err := client.BatchStatus(batch.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, status.Pending)
+	assert.EqualValues(t, 0, status.Failed)
+	assert.True(t, status.FinishedAt > 0)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "on_success")))
+}
+
+func TestBatchNotFound(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	_, err := enqueuer.Batch("nope").Enqueue("wat", nil)
+	assert.Equal(t, ErrBatchNotFound, err)
+	assert.Equal(t, ErrBatchNotFound, enqueuer.Batch("nope").Close())
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "wat")))
+
+	_, err = NewClient(ns, pool).BatchStatus("nope")
+	assert.Equal(t, ErrBatchNotFound, err)
+
+	// An empty batch finishes as soon as it's closed
+	batch, err := enqueuer.NewBatchWithOptions(BatchOptions{OnSuccess: &BatchCallback{JobName: "on_success"}})
+	assert.NoError(t, err)
+	assert.NoError(t, batch.Close())
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "on_success")))
+}
@@ -0,0 +1,100 @@
+package work
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	cancelPollPeriod = time.Second
+	// cancelledJobKeepSeconds is how long a job cancelled with Client.CancelJob stays flagged as cancelled.
+	cancelledJobKeepSeconds = 24 * 60 * 60
+)
+
+// jobCanceller cancels the jobs run by the workers of a pool once they're flagged by Client.CancelJob.
+type jobCanceller struct {
+	namespace        string
+	pool             Pool
+	workers          []*worker
+	logger           Logger
+	pollPeriod       time.Duration
+	stopChan         chan struct{}
+	doneStoppingChan chan struct{}
+}
+
+func newJobCanceller(namespace string, pool Pool, workers []*worker, logger Logger) *jobCanceller {
+	return &jobCanceller{
+		namespace:        namespace,
+		pool:             pool,
+		workers:          workers,
+		logger:           logger,
+		pollPeriod:       cancelPollPeriod,
+		stopChan:         make(chan struct{}),
+		doneStoppingChan: make(chan struct{}),
+	}
+}
+
+func (c *jobCanceller) start() {
+	go c.loop()
+}
+
+func (c *jobCanceller) stop() {
+	c.stopChan <- struct{}{}
+	<-c.doneStoppingChan
+}
+
+func (c *jobCanceller) loop() {
+	ticker := time.NewTicker(c.pollPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			c.doneStoppingChan <- struct{}{}
+			return
+		case <-ticker.C:
+			if err := c.poll(); err != nil {
+				logError(c.logger, "job_canceller.poll", err, "namespace", c.namespace)
+			}
+		}
+	}
+}
+
+// poll cancels the jobs being run which are flagged as cancelled.
+func (c *jobCanceller) poll() error {
+	var jobIDs []string
+	var workers []*worker
+	for _, w := range c.workers {
+		if jobID := w.inFlightJobID(); jobID != "" {
+			jobIDs = append(jobIDs, jobID)
+			workers = append(workers, w)
+		}
+	}
+	if len(jobIDs) == 0 {
+		return nil
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	for _, jobID := range jobIDs {
+		conn.Send("ZSCORE", redisKeyCancelledJobs(c.namespace), jobID)
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	now := nowEpochSeconds()
+	for i, jobID := range jobIDs {
+		flaggedUntil, err := redis.Int64(conn.Receive())
+		if err == redis.ErrNil {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if flaggedUntil > now {
+			workers[i].cancelInFlight(jobID)
+		}
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package work
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -18,11 +22,23 @@ var (
 	// to indicate that although the redis commands were successful,
 	// no object was actually retried by those commmands.
 	ErrNotRetried = errors.New("nothing retried")
+	// ErrJobNotFound is returned when the status of a job isn't known,
+	// because it wasn't enqueued with a StatusTTL or it expired.
+	ErrJobNotFound = errors.New("work: job not found")
+	// ErrPeriodicJobNotFound is returned when managing a periodic job which isn't registered.
+	ErrPeriodicJobNotFound = errors.New("work: periodic job not found")
+)
+
+const (
+	// waitForJobPollPeriod is how often WaitForJob checks the status of the job.
+	waitForJobPollPeriod = 100 * time.Millisecond
+	// zsetScanCount is how many jobs are read at once when looking for the jobs matching a JobFilter.
+	zsetScanCount = 1000
 )
 
 // ScheduledJob represents a job in the scheduled queue.
 type ScheduledJob struct {
-	RunAt int64 `json:"run_at"`
+	RunAt int64 `json:"run_at"` // in epoch seconds
 	*Job
 }
 
@@ -55,17 +71,18 @@ type WorkerObservation struct {
 }
 
 // Queue represents a queue that holds jobs with the same name.
-// It indicates their name, count, and latency (in seconds).
+// It indicates their name, count, latency (in seconds), and whether the queue is paused.
 // Latency is a measurement of how long ago the next job to be processed was enqueued.
 type Queue struct {
 	JobName string `json:"job_name"`
 	Count   int64  `json:"count"`
 	Latency int64  `json:"latency"`
+	Paused  bool   `json:"paused"`
 }
 
 // RetryJob represents a job in the retry queue.
 type RetryJob struct {
-	RetryAt int64 `json:"retry_at"`
+	RetryAt int64 `json:"retry_at"` // in epoch seconds
 	*Job
 }
 
@@ -75,6 +92,121 @@ type DeadJob struct {
 	*Job
 }
 
+// JobFilter selects jobs of the dead, retry or scheduled queue.
+// A job matches if it matches all of the fields that are set, so the zero JobFilter matches all jobs.
+type JobFilter struct {
+	JobName     string                 // The name of the job
+	ErrContains string                 // A substring of the last error of the job
+	Args        map[string]interface{} // Arguments the job has, with values equal once encoded to JSON
+	From        int64                  // The earliest time the job died, is retried or is run at, in epoch seconds
+	To          int64                  // The latest time the job died, is retried or is run at, in epoch seconds
+}
+
+// scoreRange returns the range of the scores of the jobs matching f in a zset.
+// If msScores is set, the scores are in epoch milliseconds, or in epoch seconds for the jobs added by older versions,
+// so the range holds both and is narrowed down by matches.
+func (f *JobFilter) scoreRange(msScores bool) (interface{}, interface{}) {
+	var min, max interface{} = "-inf", "+inf"
+	if f.From != 0 {
+		min = f.From
+	}
+	if f.To != 0 {
+		max = f.To
+		if msScores {
+			max = f.To*1000 + 999
+		}
+	}
+	return min, max
+}
+
+// matches reports whether job, whose time in epoch seconds is at, matches f.
+func (f *JobFilter) matches(job *Job, at int64) bool {
+	if (f.From != 0 && at < f.From) || (f.To != 0 && at > f.To) {
+		return false
+	}
+	if f.JobName != "" && job.Name != f.JobName {
+		return false
+	}
+	if f.ErrContains != "" && !strings.Contains(job.LastErr, f.ErrContains) {
+		return false
+	}
+	for k, want := range f.Args {
+		got, ok := job.Args[k]
+		if !ok {
+			return false
+		}
+		// Compare the JSON encodings, as the args of jobs are decoded from JSON
+		gotJSON, err := json.Marshal(got)
+		if err != nil {
+			return false
+		}
+		wantJSON, err := json.Marshal(want)
+		if err != nil || !bytes.Equal(gotJSON, wantJSON) {
+			return false
+		}
+	}
+	return true
+}
+
+// BatchStatus represents the progress of a batch of jobs.
+// Pending jobs are those that haven't succeeded or died yet, including those being retried.
+// A dead job retried from the dead queue while its batch is open stops counting as failed once it succeeds.
+// A batch is finished once it's closed and has no pending jobs.
+type BatchStatus struct {
+	ID         string `json:"id"`
+	Total      int64  `json:"total"`
+	Pending    int64  `json:"pending"`
+	Failed     int64  `json:"failed"`
+	Closed     bool   `json:"closed"`
+	CreatedAt  int64  `json:"created_at"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+}
+
+// PeriodicJob is a periodic job registered by a worker pool with PeriodicallyEnqueue, or added with Client.AddPeriodicJob.
+// Times are in epoch seconds.
+type PeriodicJob struct {
+	ID           string                 `json:"id"` // jobName:spec for the periodic jobs of worker pools
+	Spec         string                 `json:"spec"`
+	JobName      string                 `json:"job_name"`
+	Args         map[string]interface{} `json:"args,omitempty"`
+	Location     string                 `json:"location,omitempty"` // The name of the time zone of Spec, time.Local if empty
+	Jitter       time.Duration          `json:"jitter,omitempty"`
+	Unique       bool                   `json:"unique,omitempty"`
+	Dynamic      bool                   `json:"dynamic,omitempty"` // Set if added with Client.AddPeriodicJob
+	RegisteredAt int64                  `json:"registered_at"`
+
+	Paused         bool  `json:"paused,omitempty"`
+	NextRunAt      int64 `json:"next_run_at"`                // The time of the next job, not counting the jitter
+	LastEnqueuedAt int64 `json:"last_enqueued_at,omitempty"` // The time of the last job enqueued, if any
+}
+
+// JobState is where a job is in its lifecycle.
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"    // in its queue or the scheduled queue, or waiting for the jobs it depends on
+	JobRunning   JobState = "running"   // being run by a worker
+	JobRetrying  JobState = "retrying"  // in the retry queue after failing
+	JobSucceeded JobState = "succeeded" // its handler returned nil
+	JobDead      JobState = "dead"      // it failed for good, or was cancelled
+)
+
+// JobStatus represents the status of a job enqueued with a StatusTTL (see EnqueuerOptions).
+type JobStatus struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	State     JobState        `json:"state"`
+	UpdatedAt int64           `json:"updated_at"`
+	Fails     int64           `json:"fails,omitempty"`
+	LastErr   string          `json:"err,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"` // As set with Job.SetResult
+}
+
+// Finished reports whether the job succeeded or is dead.
+func (s *JobStatus) Finished() bool {
+	return s.State == JobSucceeded || s.State == JobDead
+}
+
 type jobScore struct {
 	JobBytes []byte
 	Score    int64
@@ -85,14 +217,27 @@ type jobScore struct {
 // It can be used to inspect the status of a running cluster and retry dead jobs.
 type Client struct {
 	namespace string
-	pool      *redis.Pool
+	pool      Pool
+	logger    Logger
+}
+
+// ClientOptions can be passed to NewClientWithOptions.
+type ClientOptions struct {
+	Logger Logger // If not set, errors are printed to stdout
 }
 
 // NewClient creates a new Client with the specified redis namespace and connection pool.
-func NewClient(namespace string, pool *redis.Pool) *Client {
+func NewClient(namespace string, pool Pool) *Client {
+	return NewClientWithOptions(namespace, pool, ClientOptions{})
+}
+
+// NewClientWithOptions creates a new Client as per the NewClient function,
+// but permits you to specify additional options such as a logger.
+func NewClientWithOptions(namespace string, pool Pool, clientOpts ClientOptions) *Client {
 	return &Client{
 		namespace: namespace,
 		pool:      pool,
+		logger:    clientOpts.Logger,
 	}
 }
 
@@ -115,7 +260,7 @@ func (c *Client) WorkerPoolHeartbeats() ([]*WorkerPoolHeartbeat, error) {
 	}
 
 	if err := conn.Flush(); err != nil {
-		logError("worker_pool_statuses.flush", err)
+		logError(c.logger, "worker_pool_statuses.flush", err, "namespace", c.namespace)
 		return nil, err
 	}
 
@@ -123,7 +268,7 @@ func (c *Client) WorkerPoolHeartbeats() ([]*WorkerPoolHeartbeat, error) {
 	for _, wpid := range workerPoolIDs {
 		vals, err := redis.Strings(conn.Receive())
 		if err != nil {
-			logError("worker_pool_statuses.receive", err)
+			logError(c.logger, "worker_pool_statuses.receive", err, "namespace", c.namespace)
 			return nil, err
 		}
 
@@ -159,7 +304,7 @@ func (c *Client) WorkerPoolHeartbeats() ([]*WorkerPoolHeartbeat, error) {
 				sort.Strings(heartbeat.WorkerIDs)
 			}
 			if err != nil {
-				logError("worker_pool_statuses.parse", err)
+				logError(c.logger, "worker_pool_statuses.parse", err, "namespace", c.namespace)
 				return nil, err
 			}
 		}
@@ -175,7 +320,7 @@ func (c *Client) WorkerObservations() ([]*WorkerObservation, error) {
 
 	hbs, err := c.WorkerPoolHeartbeats()
 	if err != nil {
-		logError("worker_observations.worker_pool_heartbeats", err)
+		logError(c.logger, "worker_observations.worker_pool_heartbeats", err, "namespace", c.namespace)
 		return nil, err
 	}
 
@@ -190,7 +335,7 @@ func (c *Client) WorkerObservations() ([]*WorkerObservation, error) {
 	}
 
 	if err := conn.Flush(); err != nil {
-		logError("worker_observations.flush", err)
+		logError(c.logger, "worker_observations.flush", err, "namespace", c.namespace)
 		return nil, err
 	}
 
@@ -199,7 +344,7 @@ func (c *Client) WorkerObservations() ([]*WorkerObservation, error) {
 	for _, wid := range workerIDs {
 		vals, err := redis.Strings(conn.Receive())
 		if err != nil {
-			logError("worker_observations.receive", err)
+			logError(c.logger, "worker_observations.receive", err, "namespace", c.namespace)
 			return nil, err
 		}
 
@@ -228,7 +373,7 @@ func (c *Client) WorkerObservations() ([]*WorkerObservation, error) {
 				ob.CheckinAt, err = strconv.ParseInt(value, 10, 64)
 			}
 			if err != nil {
-				logError("worker_observations.parse", err)
+				logError(c.logger, "worker_observations.parse", err, "namespace", c.namespace)
 				return nil, err
 			}
 		}
@@ -251,10 +396,11 @@ func (c *Client) Queues() ([]*Queue, error) {
 
 	for _, jobName := range jobNames {
 		conn.Send("LLEN", redisKeyJobs(c.namespace, jobName))
+		conn.Send("EXISTS", redisKeyJobsPaused(c.namespace, jobName))
 	}
 
 	if err := conn.Flush(); err != nil {
-		logError("client.queues.flush", err)
+		logError(c.logger, "client.queues.flush", err, "namespace", c.namespace)
 		return nil, err
 	}
 
@@ -263,13 +409,20 @@ func (c *Client) Queues() ([]*Queue, error) {
 	for _, jobName := range jobNames {
 		count, err := redis.Int64(conn.Receive())
 		if err != nil {
-			logError("client.queues.receive", err)
+			logError(c.logger, "client.queues.receive", err, "namespace", c.namespace)
+			return nil, err
+		}
+
+		paused, err := redis.Bool(conn.Receive())
+		if err != nil {
+			logError(c.logger, "client.queues.receive_paused", err, "namespace", c.namespace)
 			return nil, err
 		}
 
 		queue := &Queue{
 			JobName: jobName,
 			Count:   count,
+			Paused:  paused,
 		}
 		queues = append(queues, queue)
 	}
@@ -281,7 +434,7 @@ func (c *Client) Queues() ([]*Queue, error) {
 	}
 
 	if err := conn.Flush(); err != nil {
-		logError("client.queues.flush2", err)
+		logError(c.logger, "client.queues.flush2", err, "namespace", c.namespace)
 		return nil, err
 	}
 
@@ -291,13 +444,13 @@ func (c *Client) Queues() ([]*Queue, error) {
 		if s.Count > 0 {
 			b, err := redis.Bytes(conn.Receive())
 			if err != nil {
-				logError("client.queues.receive2", err)
+				logError(c.logger, "client.queues.receive2", err, "namespace", c.namespace)
 				return nil, err
 			}
 
 			job, err := newJob(b, nil, nil)
 			if err != nil {
-				logError("client.queues.new_job", err)
+				logError(c.logger, "client.queues.new_job", err, "namespace", c.namespace, "job_name", s.JobName)
 			}
 			s.Latency = now - job.EnqueuedAt
 		}
@@ -315,43 +468,172 @@ func (c *Client) getZsetPage(key string, page uint) ([]jobScore, int64, error) {
 
 	values, err := redis.Values(conn.Do("ZRANGEBYSCORE", key, "-inf", "+inf", "WITHSCORES", "LIMIT", (page-1)*20, 20))
 	if err != nil {
-		logError("client.get_zset_page.values", err)
+		logError(c.logger, "client.get_zset_page.values", err, "namespace", c.namespace)
 		return nil, 0, err
 	}
 
 	var jobsWithScores []jobScore
 	if err := redis.ScanSlice(values, &jobsWithScores); err != nil {
-		logError("client.get_zset_page.scan_slice", err)
+		logError(c.logger, "client.get_zset_page.scan_slice", err, "namespace", c.namespace)
 		return nil, 0, err
 	}
 
 	for i, jws := range jobsWithScores {
 		job, err := newJob(jws.JobBytes, nil, nil)
 		if err != nil {
-			logError("client.get_zset_page.new_job", err)
+			logError(c.logger, "client.get_zset_page.new_job", err, "namespace", c.namespace)
 			return nil, 0, err
 		}
 		jobsWithScores[i].job = job
+		jobsWithScores[i].Score = scoreToEpochSeconds(jws.Score)
 	}
 
 	count, err := redis.Int64(conn.Do("ZCARD", key))
 	if err != nil {
-		logError("client.get_zset_page.int64", err)
+		logError(c.logger, "client.get_zset_page.int64", err, "namespace", c.namespace)
 		return nil, 0, err
 	}
 	return jobsWithScores, count, nil
 }
 
+// scanZset calls fn with the jobs of the zset at key matching filter, in score order,
+// with their scores in epoch seconds, until fn returns false. msScores is set for the scheduled and retry queues, as per JobFilter.scoreRange.
+// The zset is read zsetScanCount jobs at a time, each time from the last job read rather than from an offset,
+// so that the jobs added or deleted meanwhile don't make it skip or read again the others.
+func (c *Client) scanZset(key string, msScores bool, filter JobFilter, fn func(jobScore) bool) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	script := redis.NewScript(1, redisLuaZsetAfter)
+	min, max := filter.scoreRange(msScores)
+	var last *jobScore
+	for {
+		var values []interface{}
+		var err error
+		if last == nil {
+			values, err = redis.Values(conn.Do("ZRANGEBYSCORE", key, min, max, "WITHSCORES", "LIMIT", 0, zsetScanCount))
+		} else {
+			values, err = redis.Values(script.Do(conn, key, last.Score, last.JobBytes, max, zsetScanCount))
+		}
+		if err != nil {
+			logError(c.logger, "client.scan_zset.values", err, "namespace", c.namespace)
+			return err
+		}
+
+		var jobsWithScores []jobScore
+		if err := redis.ScanSlice(values, &jobsWithScores); err != nil {
+			logError(c.logger, "client.scan_zset.scan_slice", err, "namespace", c.namespace)
+			return err
+		}
+
+		for _, jws := range jobsWithScores {
+			job, err := newJob(jws.JobBytes, nil, nil)
+			if err != nil {
+				logError(c.logger, "client.scan_zset.new_job", err, "namespace", c.namespace)
+				return err
+			}
+			at := scoreToEpochSeconds(jws.Score)
+			if filter.matches(job, at) && !fn(jobScore{JobBytes: jws.JobBytes, Score: at, job: job}) {
+				return nil
+			}
+		}
+
+		if len(jobsWithScores) < zsetScanCount {
+			return nil
+		}
+		last = &jobsWithScores[len(jobsWithScores)-1]
+	}
+}
+
+// getZsetPageMatching returns a page of the jobs of the zset at key matching filter, as per getZsetPage,
+// reading the zset up to the last job of the page.
+func (c *Client) getZsetPageMatching(key string, msScores bool, filter JobFilter, page uint) ([]jobScore, error) {
+	if page == 0 {
+		page = 1
+	}
+
+	skip := (page - 1) * 20
+	var jobsWithScores []jobScore
+	err := c.scanZset(key, msScores, filter, func(jws jobScore) bool {
+		if skip > 0 {
+			skip--
+			return true
+		}
+		jobsWithScores = append(jobsWithScores, jws)
+		return len(jobsWithScores) < 20
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobsWithScores, nil
+}
+
+// countZsetMatching returns the number of jobs of the zset at key matching filter.
+// If filter only selects jobs by time, they're counted by score rather than read.
+func (c *Client) countZsetMatching(key string, msScores bool, filter JobFilter) (int64, error) {
+	if filter.JobName != "" || filter.ErrContains != "" || len(filter.Args) > 0 {
+		var count int64
+		err := c.scanZset(key, msScores, filter, func(jobScore) bool {
+			count++
+			return true
+		})
+		return count, err
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	min, max := filter.scoreRange(msScores)
+	if !msScores {
+		count, err := redis.Int64(conn.Do("ZCOUNT", key, min, max))
+		if err != nil {
+			logError(c.logger, "client.count_zset_matching.zcount", err, "namespace", c.namespace)
+		}
+		return count, err
+	}
+
+	// The scores of the jobs added by older versions are in epoch seconds, so they're counted apart
+	var secondsMax interface{} = "(" + strconv.FormatInt(minMillisecondsScore, 10)
+	if filter.To != 0 {
+		secondsMax = filter.To
+	}
+	var msMin int64 = minMillisecondsScore
+	if filter.From*1000 > msMin {
+		msMin = filter.From * 1000
+	}
+	conn.Send("ZCOUNT", key, min, secondsMax)
+	conn.Send("ZCOUNT", key, msMin, max)
+	if err := conn.Flush(); err != nil {
+		logError(c.logger, "client.count_zset_matching.flush", err, "namespace", c.namespace)
+		return 0, err
+	}
+	var count int64
+	for i := 0; i < 2; i++ {
+		n, err := redis.Int64(conn.Receive())
+		if err != nil {
+			logError(c.logger, "client.count_zset_matching.zcount", err, "namespace", c.namespace)
+			return 0, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
 // deleteZsetJob deletes the job in the specified zset (dead, retry, or scheduled queue).
 // zsetKey is like "work:dead" or "work:scheduled".
 // The function deletes all jobs with the given jobID with the specified zscore
 // (there should only be one, but in theory there could be bad data).
-func (c *Client) deleteZsetJob(zsetKey string, zscore int64, jobID string) (bool, []byte, error) {
+// If msScores is set, zscore is in epoch seconds but the scores of the zset are in epoch milliseconds,
+// except for the jobs added by older versions, so the jobs with the given jobID during that second are deleted.
+func (c *Client) deleteZsetJob(zsetKey string, msScores bool, zscore int64, jobID string) (bool, []byte, error) {
 	script := redis.NewScript(1, redisLuaDeleteSingleCmd)
-	args := make([]interface{}, 0, 1+2)
+	args := make([]interface{}, 0, 1+4)
 	args = append(args, zsetKey) // KEY[1]
 	args = append(args, zscore)  // ARGV[1]
 	args = append(args, jobID)   // ARGV[2]
+	if msScores {
+		args = append(args, zscore*1000, zscore*1000+999) // ARGV[3], ARGV[4]
+	}
 
 	conn := c.pool.Get()
 	defer conn.Close()
@@ -363,12 +645,45 @@ func (c *Client) deleteZsetJob(zsetKey string, zscore int64, jobID string) (bool
 	cnt, err := redis.Int64(values[0], err)
 	jobBytes, err := redis.Bytes(values[1], err)
 	if err != nil {
-		logError("client.delete_zset_job.do", err)
+		logError(c.logger, "client.delete_zset_job.do", err, "namespace", c.namespace)
 		return false, nil, err
 	}
 	return cnt > 0, jobBytes, nil
 }
 
+// releaseUniqueKey deletes the unique key of the job deleted from zsetKey, the scheduled, retry or dead queue,
+// if the job still held it there as per its UniqueMode, and the key didn't expire since, another job holding it now.
+func (c *Client) releaseUniqueKey(jobBytes []byte, zsetKey string) error {
+	job, err := newJob(jobBytes, nil, nil)
+	if err != nil {
+		logError(c.logger, "client.release_unique_key.new_job", err, "namespace", c.namespace)
+		return err
+	}
+	if !job.Unique || job.UniqueKey == "" {
+		return nil
+	}
+	switch zsetKey {
+	case redisKeyRetry(c.namespace):
+		if job.UniqueMode == UniqueUntilStarted {
+			return nil
+		}
+	case redisKeyDead(c.namespace):
+		if job.UniqueMode != UniqueAcrossDead {
+			return nil
+		}
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	script := redis.NewScript(1, redisLuaReleaseUniqueKeys)
+	if _, err := script.Do(conn, job.UniqueKey, job.ID); err != nil {
+		logError(c.logger, "client.release_unique_key.del", err, "namespace", c.namespace, "job_name", job.Name, "job_id", job.ID)
+		return err
+	}
+	return nil
+}
+
 // ScheduledJobs returns a list of ScheduledJob's.
 // The page param is 1-based; each page is 20 items.
 // The total number of items (not pages) in the list of scheduled jobs is also returned.
@@ -376,7 +691,7 @@ func (c *Client) ScheduledJobs(page uint) ([]*ScheduledJob, int64, error) {
 	key := redisKeyScheduled(c.namespace)
 	jobsWithScores, count, err := c.getZsetPage(key, page)
 	if err != nil {
-		logError("client.scheduled_jobs.get_zset_page", err)
+		logError(c.logger, "client.scheduled_jobs.get_zset_page", err, "namespace", c.namespace)
 		return nil, 0, err
 	}
 
@@ -393,7 +708,7 @@ func (c *Client) RetryJobs(page uint) ([]*RetryJob, int64, error) {
 	key := redisKeyRetry(c.namespace)
 	jobsWithScores, count, err := c.getZsetPage(key, page)
 	if err != nil {
-		logError("client.retry_jobs.get_zset_page", err)
+		logError(c.logger, "client.retry_jobs.get_zset_page", err, "namespace", c.namespace)
 		return nil, 0, err
 	}
 
@@ -411,7 +726,7 @@ func (c *Client) DeadJobs(page uint) ([]*DeadJob, int64, error) {
 	key := redisKeyDead(c.namespace)
 	jobsWithScores, count, err := c.getZsetPage(key, page)
 	if err != nil {
-		logError("client.dead_jobs.get_zset_page", err)
+		logError(c.logger, "client.dead_jobs.get_zset_page", err, "namespace", c.namespace)
 		return nil, 0, err
 	}
 
@@ -422,13 +737,79 @@ func (c *Client) DeadJobs(page uint) ([]*DeadJob, int64, error) {
 	return jobs, count, nil
 }
 
+// ScheduledJobsMatching returns a page of the ScheduledJob's matching filter, as per ScheduledJobs.
+// See CountScheduledJobsMatching for the number of jobs matching filter.
+func (c *Client) ScheduledJobsMatching(filter JobFilter, page uint) ([]*ScheduledJob, error) {
+	jobsWithScores, err := c.getZsetPageMatching(redisKeyScheduled(c.namespace), true, filter, page)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*ScheduledJob, 0, len(jobsWithScores))
+	for _, jws := range jobsWithScores {
+		jobs = append(jobs, &ScheduledJob{RunAt: jws.Score, Job: jws.job})
+	}
+	return jobs, nil
+}
+
+// CountScheduledJobsMatching returns the number of jobs in the scheduled queue matching filter.
+// Unless filter only selects jobs by time, it reads the whole scheduled queue.
+func (c *Client) CountScheduledJobsMatching(filter JobFilter) (int64, error) {
+	return c.countZsetMatching(redisKeyScheduled(c.namespace), true, filter)
+}
+
+// RetryJobsMatching returns a page of the RetryJob's matching filter, as per RetryJobs.
+// See CountRetryJobsMatching for the number of jobs matching filter.
+func (c *Client) RetryJobsMatching(filter JobFilter, page uint) ([]*RetryJob, error) {
+	jobsWithScores, err := c.getZsetPageMatching(redisKeyRetry(c.namespace), true, filter, page)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*RetryJob, 0, len(jobsWithScores))
+	for _, jws := range jobsWithScores {
+		jobs = append(jobs, &RetryJob{RetryAt: jws.Score, Job: jws.job})
+	}
+	return jobs, nil
+}
+
+// CountRetryJobsMatching returns the number of jobs in the retry queue matching filter.
+// Unless filter only selects jobs by time, it reads the whole retry queue.
+func (c *Client) CountRetryJobsMatching(filter JobFilter) (int64, error) {
+	return c.countZsetMatching(redisKeyRetry(c.namespace), true, filter)
+}
+
+// DeadJobsMatching returns a page of the DeadJob's matching filter, as per DeadJobs.
+// See CountDeadJobsMatching for the number of jobs matching filter.
+func (c *Client) DeadJobsMatching(filter JobFilter, page uint) ([]*DeadJob, error) {
+	jobsWithScores, err := c.getZsetPageMatching(redisKeyDead(c.namespace), false, filter, page)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*DeadJob, 0, len(jobsWithScores))
+	for _, jws := range jobsWithScores {
+		jobs = append(jobs, &DeadJob{DiedAt: jws.Score, Job: jws.job})
+	}
+	return jobs, nil
+}
+
+// CountDeadJobsMatching returns the number of jobs in the dead queue matching filter.
+// Unless filter only selects jobs by time, it reads the whole dead queue.
+func (c *Client) CountDeadJobsMatching(filter JobFilter) (int64, error) {
+	return c.countZsetMatching(redisKeyDead(c.namespace), false, filter)
+}
+
 // DeleteDeadJob deletes a dead job from Redis.
 func (c *Client) DeleteDeadJob(diedAt int64, jobID string) error {
-	ok, _, err := c.deleteZsetJob(redisKeyDead(c.namespace), diedAt, jobID)
-	if err == nil && !ok {
-		err = ErrNotDeleted
+	ok, jobBytes, err := c.deleteZsetJob(redisKeyDead(c.namespace), false, diedAt, jobID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotDeleted
 	}
-	return err
+	return c.releaseUniqueKey(jobBytes, redisKeyDead(c.namespace))
 }
 
 // RetryDeadJob retries a dead job.
@@ -437,7 +818,7 @@ func (c *Client) RetryDeadJob(diedAt int64, jobID string) error {
 	// get queues for job names
 	queues, err := c.Queues()
 	if err != nil {
-		logError("client.retry_all_dead_jobs.queues", err)
+		logError(c.logger, "client.retry_all_dead_jobs.queues", err, "namespace", c.namespace)
 		return err
 	}
 
@@ -449,7 +830,7 @@ func (c *Client) RetryDeadJob(diedAt int64, jobID string) error {
 
 	script := redis.NewScript(len(jobNames)+1, redisLuaRequeueSingleDeadCmd)
 
-	args := make([]interface{}, 0, len(jobNames)+1+3)
+	args := make([]interface{}, 0, len(jobNames)+1+5)
 	args = append(args, redisKeyDead(c.namespace)) // KEY[1]
 	for _, jobName := range jobNames {
 		args = append(args, redisKeyJobs(c.namespace, jobName)) // KEY[2, 3, ...]
@@ -458,13 +839,14 @@ func (c *Client) RetryDeadJob(diedAt int64, jobID string) error {
 	args = append(args, nowEpochSeconds())
 	args = append(args, diedAt)
 	args = append(args, jobID)
+	args = append(args, redisKeyJobStatusPrefix(c.namespace))
 
 	conn := c.pool.Get()
 	defer conn.Close()
 
 	cnt, err := redis.Int64(script.Do(conn, args...))
 	if err != nil {
-		logError("client.retry_dead_job.do", err)
+		logError(c.logger, "client.retry_dead_job.do", err, "namespace", c.namespace)
 		return err
 	}
 
@@ -481,7 +863,7 @@ func (c *Client) RetryAllDeadJobs() error {
 	// get queues for job names
 	queues, err := c.Queues()
 	if err != nil {
-		logError("client.retry_all_dead_jobs.queues", err)
+		logError(c.logger, "client.retry_all_dead_jobs.queues", err, "namespace", c.namespace)
 		return err
 	}
 
@@ -493,7 +875,7 @@ func (c *Client) RetryAllDeadJobs() error {
 
 	script := redis.NewScript(len(jobNames)+1, redisLuaRequeueAllDeadCmd)
 
-	args := make([]interface{}, 0, len(jobNames)+1+3)
+	args := make([]interface{}, 0, len(jobNames)+1+4)
 	args = append(args, redisKeyDead(c.namespace)) // KEY[1]
 	for _, jobName := range jobNames {
 		args = append(args, redisKeyJobs(c.namespace, jobName)) // KEY[2, 3, ...]
@@ -501,6 +883,7 @@ func (c *Client) RetryAllDeadJobs() error {
 	args = append(args, redisKeyJobsPrefix(c.namespace)) // ARGV[1]
 	args = append(args, nowEpochSeconds())
 	args = append(args, 1000)
+	args = append(args, redisKeyJobStatusPrefix(c.namespace))
 
 	conn := c.pool.Get()
 	defer conn.Close()
@@ -510,7 +893,7 @@ func (c *Client) RetryAllDeadJobs() error {
 	for i := 0; i < 1000; i++ {
 		res, err := redis.Int64(script.Do(conn, args...))
 		if err != nil {
-			logError("client.retry_all_dead_jobs.do", err)
+			logError(c.logger, "client.retry_all_dead_jobs.do", err, "namespace", c.namespace)
 			return err
 		}
 
@@ -521,37 +904,80 @@ func (c *Client) RetryAllDeadJobs() error {
 	return nil
 }
 
+// RetryDeadJobsMatching requeues the dead jobs matching filter,
+// and returns the number of jobs requeued.
+func (c *Client) RetryDeadJobsMatching(filter JobFilter) (int64, error) {
+	var matches []jobScore
+	if err := c.scanZset(redisKeyDead(c.namespace), false, filter, func(jws jobScore) bool {
+		matches = append(matches, jws)
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	if len(matches) == 0 {
+		return 0, nil
+	}
+
+	// get queues for job names
+	queues, err := c.Queues()
+	if err != nil {
+		logError(c.logger, "client.retry_dead_jobs_matching.queues", err, "namespace", c.namespace)
+		return 0, err
+	}
+
+	script := redis.NewScript(len(queues)+1, redisLuaRequeueSingleDeadCmd)
+
+	keysAndArgs := make([]interface{}, 0, len(queues)+1+2+3)
+	keysAndArgs = append(keysAndArgs, redisKeyDead(c.namespace)) // KEY[1]
+	for _, q := range queues {
+		keysAndArgs = append(keysAndArgs, redisKeyJobs(c.namespace, q.JobName)) // KEY[2, 3, ...]
+	}
+	keysAndArgs = append(keysAndArgs, redisKeyJobsPrefix(c.namespace)) // ARGV[1]
+	keysAndArgs = append(keysAndArgs, nowEpochSeconds())
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	if err := script.Load(conn); err != nil {
+		logError(c.logger, "client.retry_dead_jobs_matching.load", err, "namespace", c.namespace)
+		return 0, err
+	}
+	for _, jws := range matches {
+		args := append(keysAndArgs[:len(keysAndArgs):len(keysAndArgs)], jws.Score, jws.job.ID, redisKeyJobStatusPrefix(c.namespace))
+		if err := script.SendHash(conn, args...); err != nil {
+			logError(c.logger, "client.retry_dead_jobs_matching.send", err, "namespace", c.namespace)
+			return 0, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		logError(c.logger, "client.retry_dead_jobs_matching.flush", err, "namespace", c.namespace)
+		return 0, err
+	}
+
+	var requeued int64
+	for range matches {
+		cnt, err := redis.Int64(conn.Receive())
+		if err != nil {
+			logError(c.logger, "client.retry_dead_jobs_matching.receive", err, "namespace", c.namespace)
+			return requeued, err
+		}
+		requeued += cnt
+	}
+	return requeued, nil
+}
+
 // DeleteScheduledJob deletes a job in the scheduled queue.
 func (c *Client) DeleteScheduledJob(scheduledFor int64, jobID string) error {
-	ok, jobBytes, err := c.deleteZsetJob(redisKeyScheduled(c.namespace), scheduledFor, jobID)
+	ok, jobBytes, err := c.deleteZsetJob(redisKeyScheduled(c.namespace), true, scheduledFor, jobID)
 	if err != nil {
 		return err
 	}
 
-	// If we get a job back, parse it and see if it's a unique job.
-	// If it is, we need to delete the unique key.
+	// If we get a job back and it's a unique job, we need to delete the unique key.
 	if len(jobBytes) > 0 {
-		job, err := newJob(jobBytes, nil, nil)
-		if err != nil {
-			logError("client.delete_scheduled_job.new_job", err)
+		if err := c.releaseUniqueKey(jobBytes, redisKeyScheduled(c.namespace)); err != nil {
 			return err
 		}
-
-		if job.Unique {
-			uniqueKey, err := redisKeyUniqueJob(c.namespace, job.Name, job.Args)
-			if err != nil {
-				logError("client.delete_scheduled_job.redis_key_unique_job", err)
-				return err
-			}
-			conn := c.pool.Get()
-			defer conn.Close()
-
-			_, err = conn.Do("DEL", uniqueKey)
-			if err != nil {
-				logError("worker.delete_unique_job.del", err)
-				return err
-			}
-		}
 	}
 
 	if !ok {
@@ -560,23 +986,532 @@ func (c *Client) DeleteScheduledJob(scheduledFor int64, jobID string) error {
 	return nil
 }
 
-// DeleteAllDeadJobs deletes all dead jobs.
+// DeleteAllDeadJobs deletes all dead jobs, and the unique keys the UniqueAcrossDead ones hold.
 func (c *Client) DeleteAllDeadJobs() error {
 	conn := c.pool.Get()
 	defer conn.Close()
-	_, err := conn.Do("DEL", redisKeyDead(c.namespace))
-	if err != nil {
-		logError("client.delete_all_dead_jobs", err)
+	if _, err := deleteDeadJobs(conn, c.namespace, "+inf", 0); err != nil {
+		logError(c.logger, "client.delete_all_dead_jobs", err, "namespace", c.namespace)
 		return err
 	}
 	return nil
 }
 
+// DeleteDeadJobsMatching deletes the dead jobs matching filter,
+// and returns the number of jobs deleted.
+func (c *Client) DeleteDeadJobsMatching(filter JobFilter) (int64, error) {
+	key := redisKeyDead(c.namespace)
+	var matches []interface{}
+	var uniqueKeys, uniqueKeyOwners []interface{}
+	if err := c.scanZset(key, false, filter, func(jws jobScore) bool {
+		matches = append(matches, jws.JobBytes)
+		if jws.job.Unique && jws.job.UniqueKey != "" && jws.job.UniqueMode == UniqueAcrossDead {
+			uniqueKeys = append(uniqueKeys, jws.job.UniqueKey)
+			uniqueKeyOwners = append(uniqueKeyOwners, jws.job.ID)
+		}
+		return true
+	}); err != nil {
+		return 0, err
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	var deleted int64
+	for len(matches) > 0 {
+		n := len(matches)
+		if n > zsetScanCount {
+			n = zsetScanCount
+		}
+		cnt, err := redis.Int64(conn.Do("ZREM", append([]interface{}{key}, matches[:n]...)...))
+		if err != nil {
+			logError(c.logger, "client.delete_dead_jobs_matching.zrem", err, "namespace", c.namespace)
+			return deleted, err
+		}
+		deleted += cnt
+		matches = matches[n:]
+	}
+
+	if len(uniqueKeys) > 0 {
+		// The keys which expired since the jobs died may be held by other jobs now, so they're left alone
+		script := redis.NewScript(len(uniqueKeys), redisLuaReleaseUniqueKeys)
+		if _, err := script.Do(conn, append(uniqueKeys, uniqueKeyOwners...)...); err != nil {
+			logError(c.logger, "client.delete_dead_jobs_matching.del_unique_keys", err, "namespace", c.namespace)
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// PruneDeadJobs deletes the dead jobs which died over olderThan ago,
+// and the oldest ones over the keepMax most recent ones.
+// A zero olderThan or keepMax means no limit.
+// It returns the number of dead jobs deleted.
+// See WorkerPoolOptions.MaxDeadJobs and MaxDeadAge to prune dead jobs automatically.
+func (c *Client) PruneDeadJobs(olderThan time.Duration, keepMax uint) (int64, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	pruned, err := pruneDeadJobs(conn, c.namespace, olderThan, keepMax)
+	if err != nil {
+		logError(c.logger, "client.prune_dead_jobs", err, "namespace", c.namespace)
+		return 0, err
+	}
+	return pruned, nil
+}
+
 // DeleteRetryJob deletes a job in the retry queue.
 func (c *Client) DeleteRetryJob(retryAt int64, jobID string) error {
-	ok, _, err := c.deleteZsetJob(redisKeyRetry(c.namespace), retryAt, jobID)
-	if err == nil && !ok {
+	ok, jobBytes, err := c.deleteZsetJob(redisKeyRetry(c.namespace), true, retryAt, jobID)
+	if err != nil {
+		return err
+	}
+	if !ok {
 		return ErrNotDeleted
 	}
-	return err
+	return c.releaseUniqueKey(jobBytes, redisKeyRetry(c.namespace))
+}
+
+// CancelJob cancels the job with the specified ID.
+// If the job is waiting on the jobs it depends on, it's deleted, counting as dead in its batch or for the jobs depending on it.
+// Otherwise it's flagged as cancelled for a day: if a worker pool is running it,
+// the context of the job is then cancelled, and the job isn't retried once its handler returns,
+// and if it's in its queue, the retry queue or the scheduled queue, it's discarded once fetched, without being run,
+// its status, if it's tracked, being dead already.
+// Delete the jobs scheduled to run over a day later with DeleteScheduledJob instead.
+func (c *Client) CancelJob(jobID string) error {
+	script := redis.NewScript(3, redisLuaCancelJob)
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	now := nowEpochSeconds()
+	jobBytes, err := redis.Bytes(script.Do(conn,
+		redisKeyCancelledJobs(c.namespace),
+		redisKeyWaitingJob(c.namespace, jobID),
+		redisKeyJobStatus(c.namespace, jobID),
+		jobID,
+		now,
+		now+cancelledJobKeepSeconds,
+		ErrJobCancelled.Error()))
+	if err == redis.ErrNil {
+		return nil
+	} else if err != nil {
+		logError(c.logger, "client.cancel_job.do", err, "namespace", c.namespace, "job_id", jobID)
+		return err
+	}
+
+	job, err := newJob(jobBytes, nil, nil)
+	if err != nil {
+		logError(c.logger, "client.cancel_job.new_job", err, "namespace", c.namespace, "job_id", jobID)
+		return err
+	}
+	if job.BatchID == "" && len(job.Dependents) == 0 && job.StatusTTL == 0 {
+		return nil
+	}
+
+	job.LastErr = ErrJobCancelled.Error()
+	backend := newRedisBackend(c.namespace, c.pool, c.logger)
+	fate := withStatus(c.namespace, job, JobDead, terminateOnly)
+	fate = backend.terminateDone(job, true, fate)
+	conn.Send("MULTI")
+	fate(conn)
+	if _, err := conn.Do("EXEC"); err != nil {
+		logError(c.logger, "client.cancel_job.terminate", err, "namespace", c.namespace, "job_id", jobID)
+		return err
+	}
+	if len(job.Dependents) > 0 {
+		if err := backend.cancelDependents(job); err != nil {
+			logError(c.logger, "client.cancel_job.cancel_dependents", err, "namespace", c.namespace, "job_id", jobID)
+			return err
+		}
+	}
+	return nil
+}
+
+// PauseQueue pauses the queue of jobName.
+// Worker pools stop fetching jobs from a paused queue,
+// jobs that are already running are not affected.
+// The queue remains paused until ResumeQueue is called.
+func (c *Client) PauseQueue(jobName string) error {
+	return c.PauseQueueFor(jobName, 0)
+}
+
+// PauseQueueFor pauses the queue of jobName for the duration d,
+// after which it is resumed automatically.
+// A non-positive d pauses the queue until ResumeQueue is called.
+func (c *Client) PauseQueueFor(jobName string, d time.Duration) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{redisKeyJobsPaused(c.namespace, jobName), "1"}
+	if d > 0 {
+		ms := d.Milliseconds()
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, "PX", ms)
+	}
+
+	if _, err := conn.Do("SET", args...); err != nil {
+		logError(c.logger, "client.pause_queue", err, "namespace", c.namespace)
+		return err
+	}
+	return nil
+}
+
+// ResumeQueue resumes a queue previously paused with PauseQueue or PauseQueueFor.
+func (c *Client) ResumeQueue(jobName string) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", redisKeyJobsPaused(c.namespace, jobName)); err != nil {
+		logError(c.logger, "client.resume_queue", err, "namespace", c.namespace)
+		return err
+	}
+	return nil
+}
+
+// BatchStatus returns the status of the batch with the specified ID.
+// It returns ErrBatchNotFound if the batch doesn't exist.
+func (c *Client) BatchStatus(batchID string) (*BatchStatus, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.Values(conn.Do("HMGET", redisKeyBatch(c.namespace, batchID), "created_at", "total", "pending", "failed", "closed", "finished_at"))
+	if err != nil {
+		logError(c.logger, "client.batch_status", err, "namespace", c.namespace)
+		return nil, err
+	}
+	if values[0] == nil {
+		return nil, ErrBatchNotFound
+	}
+
+	status := &BatchStatus{ID: batchID}
+	var closed int
+	if _, err := redis.Scan(values, &status.CreatedAt, &status.Total, &status.Pending, &status.Failed, &closed, &status.FinishedAt); err != nil {
+		logError(c.logger, "client.batch_status.scan", err, "namespace", c.namespace)
+		return nil, err
+	}
+	status.Closed = closed == 1
+	return status, nil
+}
+
+// JobStatus returns the status of the job with the specified ID, as returned when it was enqueued.
+// It returns ErrJobNotFound unless the job was enqueued with a StatusTTL (see EnqueuerOptions)
+// and its status changed within that TTL.
+func (c *Client) JobStatus(jobID string) (*JobStatus, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.Values(conn.Do("HMGET", redisKeyJobStatus(c.namespace, jobID), "state", "name", "updated_at", "fails", "err", "result"))
+	if err != nil {
+		logError(c.logger, "client.job_status", err, "namespace", c.namespace, "job_id", jobID)
+		return nil, err
+	}
+	if values[0] == nil {
+		return nil, ErrJobNotFound
+	}
+
+	status := &JobStatus{ID: jobID}
+	var result []byte
+	if _, err := redis.Scan(values, &status.State, &status.Name, &status.UpdatedAt, &status.Fails, &status.LastErr, &result); err != nil {
+		logError(c.logger, "client.job_status.scan", err, "namespace", c.namespace, "job_id", jobID)
+		return nil, err
+	}
+	if len(result) > 0 {
+		status.Result = result
+	}
+	return status, nil
+}
+
+// WaitForJob waits until the job with the specified ID has finished, ie, it succeeded or is dead,
+// and returns its status as per JobStatus. It returns ctx.Err() if ctx is done first.
+func (c *Client) WaitForJob(ctx context.Context, jobID string) (*JobStatus, error) {
+	ticker := time.NewTicker(waitForJobPollPeriod)
+	defer ticker.Stop()
+
+	for {
+		status, err := c.JobStatus(jobID)
+		if err != nil {
+			return nil, err
+		}
+		if status.Finished() {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// PeriodicJobs returns the periodic jobs registered by all worker pools and added with AddPeriodicJob, sorted by ID.
+// The periodic jobs of worker pools stay registered after they're removed from them, until RemovePeriodicJob is called.
+// The registrations which can't be loaded are logged and skipped, as the worker pools do.
+func (c *Client) PeriodicJobs() ([]*PeriodicJob, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	conn.Send("HGETALL", redisKeyPeriodicJobs(c.namespace))
+	conn.Send("HGETALL", redisKeyPeriodicJobsLastEnqueued(c.namespace))
+	conn.Send("SMEMBERS", redisKeyPeriodicJobsPaused(c.namespace))
+	if err := conn.Flush(); err != nil {
+		logError(c.logger, "client.periodic_jobs.flush", err, "namespace", c.namespace)
+		return nil, err
+	}
+	registrations, err := redis.StringMap(conn.Receive())
+	if err != nil {
+		logError(c.logger, "client.periodic_jobs.receive", err, "namespace", c.namespace)
+		return nil, err
+	}
+	lastEnqueued, err := redis.Int64Map(conn.Receive())
+	if err != nil {
+		logError(c.logger, "client.periodic_jobs.receive", err, "namespace", c.namespace)
+		return nil, err
+	}
+	pausedIDs, err := redis.Strings(conn.Receive())
+	if err != nil {
+		logError(c.logger, "client.periodic_jobs.receive", err, "namespace", c.namespace)
+		return nil, err
+	}
+
+	paused := make(map[string]bool, len(pausedIDs))
+	for _, id := range pausedIDs {
+		paused[id] = true
+	}
+
+	now := time.Unix(nowEpochSeconds(), 0)
+	periodicJobs := make([]*PeriodicJob, 0, len(registrations))
+	for id, rawJSON := range registrations {
+		var periodicJob PeriodicJob
+		if err := json.Unmarshal([]byte(rawJSON), &periodicJob); err != nil {
+			logError(c.logger, "client.periodic_jobs.unmarshal", err, "namespace", c.namespace, "periodic_job_id", id)
+			continue
+		}
+		periodicJob.ID = id
+		periodicJob.Paused = paused[id]
+		periodicJob.LastEnqueuedAt = lastEnqueued[id]
+
+		pj, err := periodicJob.periodicJob()
+		if err != nil {
+			logError(c.logger, "client.periodic_jobs.periodic_job", err, "namespace", c.namespace, "periodic_job_id", id)
+			continue
+		}
+		if next := pj.next(now); !next.IsZero() {
+			periodicJob.NextRunAt = next.Unix()
+		}
+		periodicJobs = append(periodicJobs, &periodicJob)
+	}
+
+	sort.Slice(periodicJobs, func(i, j int) bool {
+		return periodicJobs[i].ID < periodicJobs[j].ID
+	})
+	return periodicJobs, nil
+}
+
+// AddPeriodicJob adds a periodic job with the specified ID,
+// enqueuing jobName with args according to the cron-based spec as per WorkerPool.PeriodicallyEnqueue.
+// It's enqueued by the worker pools using the Redis backend until RemovePeriodicJob is called, without restarting them.
+// They pick it up the next time they enqueue periodic jobs, within a few minutes.
+// Adding a periodic job with the ID of an existing one replaces it,
+// but IDs of the form jobName:spec are reserved for the periodic jobs of worker pools.
+func (c *Client) AddPeriodicJob(id, spec, jobName string, args map[string]interface{}) error {
+	return c.AddPeriodicJobWithOptions(id, spec, jobName, PeriodicJobOptions{Args: args})
+}
+
+// AddPeriodicJobWithOptions adds a periodic job as per AddPeriodicJob, with the specified options.
+// The Location of opts must be loadable with time.LoadLocation by the worker pools.
+func (c *Client) AddPeriodicJobWithOptions(id, spec, jobName string, opts PeriodicJobOptions) error {
+	if id == "" {
+		return errors.New("work: periodic job ID must not be empty")
+	}
+	if isPoolPeriodicID(id) {
+		// The worker pools would overwrite it when registering their own periodic jobs
+		return errors.New("work: periodic job ID must not have the form jobName:spec of the periodic jobs of worker pools")
+	}
+	pj, err := newPeriodicJob(spec, jobName, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Location != nil {
+		if _, err := time.LoadLocation(opts.Location.String()); err != nil {
+			return err
+		}
+	}
+
+	pj.id = id
+	registration := pj.registration()
+	registration.Dynamic = true
+	rawJSON, err := json.Marshal(registration)
+	if err != nil {
+		return err
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("HSET", redisKeyPeriodicJobs(c.namespace), id, rawJSON); err != nil {
+		logError(c.logger, "client.add_periodic_job", err, "namespace", c.namespace, "periodic_job_id", id)
+		return err
+	}
+	return nil
+}
+
+// RemovePeriodicJob removes the periodic job id, and deletes its jobs in the scheduled queue.
+// The periodic jobs of worker pools are still enqueued by them,
+// and registered again when they start; see PausePeriodicJob to stop enqueuing them.
+func (c *Client) RemovePeriodicJob(id string) error {
+	periodicJob, err := c.periodicJob(id)
+	if err != nil {
+		return err
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	conn.Send("HDEL", redisKeyPeriodicJobs(c.namespace), id)
+	conn.Send("HDEL", redisKeyPeriodicJobsLastEnqueued(c.namespace), id)
+	conn.Send("SREM", redisKeyPeriodicJobsPaused(c.namespace), id)
+	if _, err := conn.Do("EXEC"); err != nil {
+		logError(c.logger, "client.remove_periodic_job", err, "namespace", c.namespace, "periodic_job_id", id)
+		return err
+	}
+	return c.deleteScheduledPeriodicJobs(periodicJob)
+}
+
+// PausePeriodicJob stops enqueuing the periodic job id until ResumePeriodicJob is called,
+// and deletes its jobs in the scheduled queue.
+// It applies to the periodic jobs of worker pools as well as the ones added with AddPeriodicJob.
+func (c *Client) PausePeriodicJob(id string) error {
+	periodicJob, err := c.periodicJob(id)
+	if err != nil {
+		return err
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SADD", redisKeyPeriodicJobsPaused(c.namespace), id); err != nil {
+		logError(c.logger, "client.pause_periodic_job", err, "namespace", c.namespace, "periodic_job_id", id)
+		return err
+	}
+	return c.deleteScheduledPeriodicJobs(periodicJob)
+}
+
+// ResumePeriodicJob resumes enqueuing the periodic job id paused with PausePeriodicJob.
+// The worker pools pick it up the next time they enqueue periodic jobs, within a few minutes.
+func (c *Client) ResumePeriodicJob(id string) error {
+	if _, err := c.periodicJob(id); err != nil {
+		return err
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SREM", redisKeyPeriodicJobsPaused(c.namespace), id); err != nil {
+		logError(c.logger, "client.resume_periodic_job", err, "namespace", c.namespace, "periodic_job_id", id)
+		return err
+	}
+	return nil
+}
+
+// periodicJob returns the registration of the periodic job id, or ErrPeriodicJobNotFound.
+func (c *Client) periodicJob(id string) (*PeriodicJob, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	rawJSON, err := redis.Bytes(conn.Do("HGET", redisKeyPeriodicJobs(c.namespace), id))
+	if err == redis.ErrNil {
+		return nil, ErrPeriodicJobNotFound
+	} else if err != nil {
+		logError(c.logger, "client.periodic_job.hget", err, "namespace", c.namespace, "periodic_job_id", id)
+		return nil, err
+	}
+
+	var periodicJob PeriodicJob
+	if err := json.Unmarshal(rawJSON, &periodicJob); err != nil {
+		logError(c.logger, "client.periodic_job.unmarshal", err, "namespace", c.namespace, "periodic_job_id", id)
+		return nil, err
+	}
+	periodicJob.ID = id
+	return &periodicJob, nil
+}
+
+// deleteScheduledPeriodicJobs deletes the jobs of periodicJob in the scheduled queue.
+// The unique ones don't hold their unique key until due, so it's left to the job holding it, if any.
+func (c *Client) deleteScheduledPeriodicJobs(periodicJob *PeriodicJob) error {
+	key := redisKeyScheduled(c.namespace)
+	var matches []interface{}
+	if err := c.scanZset(key, true, JobFilter{JobName: periodicJob.JobName}, func(jws jobScore) bool {
+		if isPeriodicInstanceID(jws.job.ID, periodicJob.ID) {
+			matches = append(matches, jws.JobBytes)
+		}
+		return true
+	}); err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("ZREM", append([]interface{}{key}, matches...)...); err != nil {
+		logError(c.logger, "client.delete_scheduled_periodic_jobs.zrem", err, "namespace", c.namespace, "periodic_job_id", periodicJob.ID)
+		return err
+	}
+	return nil
+}
+
+// SetJobConcurrency overrides the MaxConcurrency of jobName jobs in all worker pools, 0 meaning no max.
+// It takes effect right away and lasts until ResetJobOverrides is called,
+// including across worker pool restarts.
+func (c *Client) SetJobConcurrency(jobName string, maxConcurrency uint) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	conn.Send("HSET", redisKeyJobsOverrides(c.namespace, jobName), "max_concurrency", maxConcurrency)
+	conn.Send("SET", redisKeyJobsConcurrency(c.namespace, jobName), maxConcurrency)
+	if _, err := conn.Do("EXEC"); err != nil {
+		logError(c.logger, "client.set_job_concurrency", err, "namespace", c.namespace, "job_name", jobName)
+		return err
+	}
+	return nil
+}
+
+// SetJobPriority overrides the Priority of jobName jobs in all worker pools.
+// Running worker pools pick it up on their next heartbeat.
+// It lasts until ResetJobOverrides is called, including across worker pool restarts.
+func (c *Client) SetJobPriority(jobName string, priority uint) error {
+	if priority < 1 || priority > 100000 {
+		return errors.New("work: priority must be between 1 and 100000")
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("HSET", redisKeyJobsOverrides(c.namespace, jobName), "priority", priority); err != nil {
+		logError(c.logger, "client.set_job_priority", err, "namespace", c.namespace, "job_name", jobName)
+		return err
+	}
+	return nil
+}
+
+// ResetJobOverrides removes the overrides set with SetJobConcurrency and SetJobPriority.
+// Running worker pools go back to the JobOptions of jobName on their next heartbeat.
+func (c *Client) ResetJobOverrides(jobName string) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", redisKeyJobsOverrides(c.namespace, jobName)); err != nil {
+		logError(c.logger, "client.reset_job_overrides", err, "namespace", c.namespace, "job_name", jobName)
+		return err
+	}
+	return nil
 }
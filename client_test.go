@@ -1,6 +1,7 @@
 package work
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -469,6 +470,317 @@ func TestClientDeleteAllDeadJobs(t *testing.T) {
 	assert.EqualValues(t, 0, count)
 }
 
+func TestClientPruneDeadJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	now := nowEpochSeconds()
+	for i := int64(0); i < 4; i++ {
+		insertDeadJob(ns, pool, "wat", now-100, now-i*3600)
+	}
+
+	client := NewClient(ns, pool)
+	pruned, err := client.PruneDeadJobs(0, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, pruned)
+
+	pruned, err = client.PruneDeadJobs(150*time.Minute, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, pruned)
+
+	pruned, err = client.PruneDeadJobs(0, 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, pruned)
+	jobs, count, err := client.DeadJobs(1)
+	assert.NoError(t, err)
+	if assert.EqualValues(t, 1, count) {
+		assert.Equal(t, now, jobs[0].DiedAt)
+	}
+}
+
+func TestClientDeleteDeadJobsUniqueKeys(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	now := nowEpochSeconds()
+	insertUniqueDeadJob := func(key string, mode UniqueMode, failAt int64) *Job {
+		job := &Job{Name: "wat", ID: makeIdentifier(), Unique: true, UniqueKey: key, UniqueMode: mode, FailedAt: failAt}
+		rawJSON, _ := job.serialize()
+		_, err := conn.Do("ZADD", redisKeyDead(ns), failAt, rawJSON)
+		assert.NoError(t, err)
+		_, err = conn.Do("SET", key, job.ID)
+		assert.NoError(t, err)
+		return job
+	}
+	// The key of a dead job may expire, and another job hold it then
+	retakeUniqueKey := func(key string) {
+		_, err := conn.Do("SET", key, makeIdentifier())
+		assert.NoError(t, err)
+	}
+
+	// Only the jobs unique across dead still hold their keys in the dead queue
+	insertUniqueDeadJob("testwork:unique:a", UniqueAcrossDead, now-7200)
+	insertUniqueDeadJob("testwork:unique:b", UniqueUntilFinished, now-7200)
+	insertUniqueDeadJob("testwork:unique:c", UniqueAcrossDead, now-60)
+	insertUniqueDeadJob("testwork:unique:d", UniqueAcrossDead, now)
+
+	client := NewClient(ns, pool)
+	pruned, err := client.PruneDeadJobs(time.Hour, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, pruned)
+	assert.False(t, exists(pool, "testwork:unique:a"))
+	assert.True(t, exists(pool, "testwork:unique:b"))
+	assert.True(t, exists(pool, "testwork:unique:c"))
+
+	pruned, err = client.PruneDeadJobs(0, 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, pruned)
+	assert.False(t, exists(pool, "testwork:unique:c"))
+	assert.True(t, exists(pool, "testwork:unique:d"))
+
+	assert.NoError(t, client.DeleteAllDeadJobs())
+	assert.False(t, exists(pool, "testwork:unique:d"))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
+
+	// The worker pools prune the dead jobs the same way
+	insertUniqueDeadJob("testwork:unique:e", UniqueAcrossDead, now-7200)
+	p := newDeadPruner(ns, pool, time.Hour, 0, nil)
+	p.pruneIfDue()
+	assert.False(t, exists(pool, "testwork:unique:e"))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
+
+	// The keys held by other jobs are left alone, unlike the ones holding the job itself,
+	// as once enqueuing it again replaced its args, or "1" as set by older versions
+	insertUniqueDeadJob("testwork:unique:f", UniqueAcrossDead, now-7200)
+	retakeUniqueKey("testwork:unique:f")
+	g := insertUniqueDeadJob("testwork:unique:g", UniqueAcrossDead, now-7200)
+	_, err = conn.Do("SET", "testwork:unique:g", `{"id":"`+g.ID+`","name":"wat","args":{"a":1}}`)
+	assert.NoError(t, err)
+	insertUniqueDeadJob("testwork:unique:h", UniqueAcrossDead, now-7200)
+	_, err = conn.Do("SET", "testwork:unique:h", "1")
+	assert.NoError(t, err)
+	pruned, err = client.PruneDeadJobs(time.Hour, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, pruned)
+	assert.True(t, exists(pool, "testwork:unique:f"))
+	assert.False(t, exists(pool, "testwork:unique:g"))
+	assert.False(t, exists(pool, "testwork:unique:h"))
+
+	i := insertUniqueDeadJob("testwork:unique:i", UniqueAcrossDead, now)
+	retakeUniqueKey("testwork:unique:i")
+	assert.NoError(t, client.DeleteDeadJob(i.FailedAt, i.ID))
+	assert.True(t, exists(pool, "testwork:unique:i"))
+
+	insertUniqueDeadJob("testwork:unique:j", UniqueAcrossDead, now)
+	retakeUniqueKey("testwork:unique:j")
+	insertUniqueDeadJob("testwork:unique:k", UniqueAcrossDead, now)
+	deleted, err := client.DeleteDeadJobsMatching(JobFilter{JobName: "wat"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, deleted)
+	assert.True(t, exists(pool, "testwork:unique:j"))
+	assert.False(t, exists(pool, "testwork:unique:k"))
+}
+
+func TestClientJobsMatching(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	deadJobs := []*Job{
+		{Name: "wat", ID: makeIdentifier(), Args: map[string]interface{}{"user": 1}, LastErr: "timeout talking to api", FailedAt: 100},
+		{Name: "wat", ID: makeIdentifier(), Args: map[string]interface{}{"user": 2}, LastErr: "bad input", FailedAt: 200},
+		{Name: "wat", ID: makeIdentifier(), Args: map[string]interface{}{"user": 1}, LastErr: "timeout talking to db", FailedAt: 300},
+		{Name: "foo", ID: makeIdentifier(), LastErr: "timeout", FailedAt: 400},
+	}
+	for _, job := range deadJobs {
+		rawJSON, _ := job.serialize()
+		_, err := conn.Do("ZADD", redisKeyDead(ns), job.FailedAt, rawJSON)
+		assert.NoError(t, err)
+	}
+	_, err := conn.Do("SADD", redisKeyKnownJobs(ns), "wat", "foo")
+	assert.NoError(t, err)
+
+	client := NewClient(ns, pool)
+	jobs, err := client.DeadJobsMatching(JobFilter{}, 1)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 4)
+	count, err := client.CountDeadJobsMatching(JobFilter{})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, count)
+
+	filter := JobFilter{JobName: "wat", ErrContains: "timeout"}
+	jobs, err = client.DeadJobsMatching(filter, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 2) {
+		assert.Equal(t, deadJobs[0].ID, jobs[0].ID)
+		assert.EqualValues(t, 100, jobs[0].DiedAt)
+		assert.Equal(t, deadJobs[2].ID, jobs[1].ID)
+	}
+	count, err = client.CountDeadJobsMatching(filter)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	filter = JobFilter{Args: map[string]interface{}{"user": 1}, From: 200}
+	jobs, err = client.DeadJobsMatching(filter, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, deadJobs[2].ID, jobs[0].ID)
+	}
+	count, err = client.CountDeadJobsMatching(filter)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+
+	count, err = client.CountDeadJobsMatching(JobFilter{From: 200, To: 300})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	jobs, err = client.DeadJobsMatching(JobFilter{}, 2)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 0)
+
+	// Retry and scheduled jobs
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err = enqueuer.EnqueueIn("wat", 100, Q{"user": 1})
+	assert.NoError(t, err)
+	_, err = enqueuer.EnqueueIn("foo", 100, nil)
+	assert.NoError(t, err)
+	scheduledJobs, err := client.ScheduledJobsMatching(JobFilter{JobName: "foo"}, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, scheduledJobs, 1) {
+		assert.Equal(t, "foo", scheduledJobs[0].Name)
+	}
+	count, err = client.CountScheduledJobsMatching(JobFilter{JobName: "foo"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+
+	rawJSON, _ := (&Job{Name: "wat", ID: makeIdentifier(), LastErr: "oops"}).serialize()
+	_, err = conn.Do("ZADD", redisKeyRetry(ns), 500, rawJSON)
+	assert.NoError(t, err)
+	retryJobs, err := client.RetryJobsMatching(JobFilter{ErrContains: "oops"}, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, retryJobs, 1) {
+		assert.EqualValues(t, 500, retryJobs[0].RetryAt)
+	}
+	count, err = client.CountRetryJobsMatching(JobFilter{ErrContains: "timeout"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, count)
+}
+
+func TestClientScanZset(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	// More jobs die in the same second than are read at once
+	var ids []string
+	args := redis.Args{redisKeyDead(ns)}
+	for i := 0; i < 2*zsetScanCount+500; i++ {
+		failedAt := int64(100)
+		if i >= 2*zsetScanCount {
+			failedAt = 200
+		}
+		job := &Job{Name: "wat", ID: makeIdentifier(), FailedAt: failedAt}
+		rawJSON, _ := job.serialize()
+		args = args.Add(failedAt, rawJSON)
+		ids = append(ids, job.ID)
+	}
+	_, err := conn.Do("ZADD", args...)
+	assert.NoError(t, err)
+
+	// Each job is read once even if the ones read are deleted meanwhile
+	client := NewClient(ns, pool)
+	read := map[string]int{}
+	err = client.scanZset(redisKeyDead(ns), false, JobFilter{}, func(jws jobScore) bool {
+		read[jws.job.ID]++
+		_, err := conn.Do("ZREM", redisKeyDead(ns), jws.JobBytes)
+		assert.NoError(t, err)
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Len(t, read, len(ids))
+	for _, id := range ids {
+		assert.Equal(t, 1, read[id], id)
+	}
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
+
+	// The pages are read up to their last job only
+	_, err = conn.Do("ZADD", args...)
+	assert.NoError(t, err)
+	var ordered []string
+	err = client.scanZset(redisKeyDead(ns), false, JobFilter{}, func(jws jobScore) bool {
+		ordered = append(ordered, jws.job.ID)
+		return len(ordered) < 40
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ordered, 40)
+
+	jobs, err := client.DeadJobsMatching(JobFilter{}, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 20) {
+		for i, job := range jobs {
+			assert.Equal(t, ordered[20+i], job.ID)
+		}
+	}
+	jobs, err = client.DeadJobsMatching(JobFilter{From: 200}, 500/20)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 20)
+	count, err := client.CountDeadJobsMatching(JobFilter{From: 200})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 500, count)
+}
+
+func TestClientRetryAndDeleteDeadJobsMatching(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	insertDeadJob(ns, pool, "wat1", 12345, 12347)
+	insertDeadJob(ns, pool, "wat1", 12345, 12348)
+	insertDeadJob(ns, pool, "wat2", 12345, 12349)
+	insertDeadJob(ns, pool, "wat3", 12345, 12350)
+
+	client := NewClient(ns, pool)
+	retried, err := client.RetryDeadJobsMatching(JobFilter{JobName: "wat1"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, retried)
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(ns, "wat1")))
+	assert.EqualValues(t, 2, zsetSize(pool, redisKeyDead(ns)))
+
+	job := getQueuedJob(ns, pool, "wat1")
+	if assert.NotNil(t, job) {
+		assert.EqualValues(t, 0, job.Fails)
+		assert.Equal(t, "", job.LastErr)
+		assert.EqualValues(t, 1425263409, job.EnqueuedAt)
+	}
+
+	retried, err = client.RetryDeadJobsMatching(JobFilter{JobName: "wat1"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, retried)
+
+	deleted, err := client.DeleteDeadJobsMatching(JobFilter{From: 12350})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+	jobs, count, err := client.DeadJobs(1)
+	assert.NoError(t, err)
+	if assert.EqualValues(t, 1, count) {
+		assert.Equal(t, "wat2", jobs[0].Name)
+	}
+}
+
 func TestClientRetryAllDeadJobs(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "testwork"
@@ -616,6 +928,62 @@ func TestClientDeleteScheduledJob(t *testing.T) {
 	err = client.DeleteScheduledJob(j.RunAt, j.ID)
 	assert.NoError(t, err)
 	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(ns)))
+
+	// schedule a job unique by key. Delete it, which releases its key.
+	j, err = enq.EnqueueUniqueInByKey("foo", 10, Q{"a": 1}, Q{"k": 1})
+	assert.NoError(t, err)
+	if assert.NotNil(t, j) {
+		assert.True(t, exists(pool, j.UniqueKey))
+		err = client.DeleteScheduledJob(j.RunAt, j.ID)
+		assert.NoError(t, err)
+		assert.False(t, exists(pool, j.UniqueKey))
+	}
+}
+
+func TestClientScheduledJobsSecondScores(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	now := nowEpochSeconds()
+	setNowEpochSecondsMock(now)
+	defer resetNowEpochSecondsMock()
+
+	// Jobs scheduled by older versions are scored in epoch seconds
+	oldJob := &Job{Name: "wat", ID: makeIdentifier(), EnqueuedAt: now}
+	rawJSON, _ := oldJob.serialize()
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("ZADD", redisKeyScheduled(ns), now+30, rawJSON)
+	assert.NoError(t, err)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	newJob, err := enqueuer.EnqueueAfter("wat", 20500*time.Millisecond, nil)
+	assert.NoError(t, err)
+
+	client := NewClient(ns, pool)
+	jobs, count, err := client.ScheduledJobs(1)
+	assert.NoError(t, err)
+	if assert.EqualValues(t, 2, count) {
+		assert.EqualValues(t, now+30, jobs[0].RunAt)
+		assert.EqualValues(t, now+20, jobs[1].RunAt)
+	}
+
+	jobs, err = client.ScheduledJobsMatching(JobFilter{From: now + 15, To: now + 20}, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, newJob.ID, jobs[0].ID)
+	}
+	count, err = client.CountScheduledJobsMatching(JobFilter{From: now + 15, To: now + 20})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+	count, err = client.CountScheduledJobsMatching(JobFilter{From: now + 25})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+
+	assert.NoError(t, client.DeleteScheduledJob(now+30, oldJob.ID))
+	assert.NoError(t, client.DeleteScheduledJob(now+20, newJob.ID))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(ns)))
 }
 
 func TestClientDeleteScheduledUniqueJob(t *testing.T) {
@@ -674,6 +1042,353 @@ func TestClientDeleteRetryJob(t *testing.T) {
 	}
 }
 
+func TestClientCancelJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	now := nowEpochSeconds()
+	setNowEpochSecondsMock(now)
+	defer resetNowEpochSecondsMock()
+
+	enq := NewEnqueuerWithOptions(ns, pool, EnqueuerOptions{StatusTTL: time.Hour})
+	client := NewClient(ns, pool)
+
+	// queued, scheduled and batch jobs are flagged, and discarded once fetched
+	queued, err := enq.Enqueue("wat", Q{"a": 1})
+	assert.NoError(t, err)
+	unique, err := enq.EnqueueUnique("wat", Q{"a": 2})
+	assert.NoError(t, err)
+	scheduled, err := enq.EnqueueIn("wat", 10, nil)
+	assert.NoError(t, err)
+	b, err := enq.NewBatch()
+	assert.NoError(t, err)
+	batched, err := b.Enqueue("wat", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, b.Close())
+	// jobs aren't mistaken for the ones whose ID is in their args
+	kept, err := enq.Enqueue("wat", Q{"id": queued.ID})
+	assert.NoError(t, err)
+
+	cancelledIDs := []string{queued.ID, unique.ID, scheduled.ID, batched.ID}
+	for _, id := range cancelledIDs {
+		assert.NoError(t, client.CancelJob(id))
+	}
+	assert.EqualValues(t, 4, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(ns)))
+
+	var ran []string
+	jobTypes := map[string]*jobType{
+		"wat": {
+			Name:           "wat",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 3},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { ran = append(ran, job.ID); return nil },
+		},
+	}
+	backend := newRedisBackend(ns, pool, nil)
+	run := func() {
+		w := newWorker(ns, "1", backend, tstCtxType, nil, jobTypes, nil, nil, nil)
+		w.start()
+		w.drain()
+		w.stop()
+	}
+	run()
+	setNowEpochSecondsMock(now + 10)
+	_, _, err = backend.RequeueDue(ScheduledSet, []string{"wat"})
+	assert.NoError(t, err)
+	run()
+
+	assert.Equal(t, []string{kept.ID}, ran)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
+	for _, id := range cancelledIDs {
+		status, err := client.JobStatus(id)
+		assert.NoError(t, err)
+		if assert.NotNil(t, status) {
+			assert.Equal(t, JobDead, status.State)
+			assert.Equal(t, ErrJobCancelled.Error(), status.LastErr)
+		}
+	}
+
+	// the jobs in a batch count as dead, and the unique ones can be enqueued again
+	status, err := client.BatchStatus(b.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, status.Pending)
+	assert.EqualValues(t, 1, status.Failed)
+	assert.NotZero(t, status.FinishedAt)
+	j, err := enq.EnqueueUnique("wat", Q{"a": 2})
+	assert.NoError(t, err)
+	assert.NotNil(t, j)
+
+	// the jobs are flagged for a day, and the expired flags are pruned
+	conn := pool.Get()
+	defer conn.Close()
+	flaggedUntil, err := redis.Int64(conn.Do("ZSCORE", redisKeyCancelledJobs(ns), queued.ID))
+	assert.NoError(t, err)
+	assert.EqualValues(t, now+cancelledJobKeepSeconds, flaggedUntil)
+	setNowEpochSecondsMock(now + cancelledJobKeepSeconds + 1)
+	assert.NoError(t, client.CancelJob("nope"))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyCancelledJobs(ns)))
+}
+
+func TestClientCancelJobNotQueued(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	enq := NewEnqueuerWithOptions(ns, pool, EnqueuerOptions{StatusTTL: time.Hour})
+	client := NewClient(ns, pool)
+
+	// jobs waiting on the jobs they depend on are deleted along with their dependents
+	jobs, err := enq.EnqueueChain(
+		WorkflowJob{JobName: "wat", Args: Q{"step": 1}},
+		WorkflowJob{JobName: "wat", Args: Q{"step": 2}},
+		WorkflowJob{JobName: "wat", Args: Q{"step": 3}},
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, client.CancelJob(jobs[1].ID))
+	assert.False(t, exists(pool, redisKeyWaitingJob(ns, jobs[1].ID)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyCancelledJobs(ns)))
+	status, err := client.JobStatus(jobs[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobDead, status.State)
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(ns))) // the next job is parked
+
+	// flagged jobs fetched later on are discarded without being run
+	j, err := enq.Enqueue("wat", Q{"step": 4})
+	assert.NoError(t, err)
+	assert.NoError(t, client.CancelJob(j.ID))
+
+	var steps []int64
+	jobTypes := map[string]*jobType{
+		"wat": {
+			Name:           "wat",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 3},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { steps = append(steps, job.ArgInt64("step")); return nil },
+		},
+	}
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.Equal(t, []int64{1}, steps)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(ns)))
+	status, err = client.JobStatus(j.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobDead, status.State)
+	assert.Equal(t, ErrJobCancelled.Error(), status.LastErr)
+}
+
+func TestClientJobStatus(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	client := NewClient(ns, pool)
+	job, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	assert.NoError(t, err)
+	_, err = client.JobStatus(job.ID)
+	assert.Equal(t, ErrJobNotFound, err)
+
+	enq := NewEnqueuerWithOptions(ns, pool, EnqueuerOptions{StatusTTL: time.Hour})
+	job, err = enq.Enqueue("wat", Q{"a": 2})
+	assert.NoError(t, err)
+	status, err := client.JobStatus(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &JobStatus{ID: job.ID, Name: "wat", State: JobQueued, UpdatedAt: status.UpdatedAt}, status)
+	assert.False(t, status.Finished())
+	conn := pool.Get()
+	defer conn.Close()
+	ttl, err := redis.Int64(conn.Do("TTL", redisKeyJobStatus(ns, job.ID)))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 3500 && ttl <= 3600, ttl)
+
+	// Unique jobs that aren't enqueued aren't tracked
+	_, err = enq.EnqueueUnique("wat", Q{"a": 3})
+	assert.NoError(t, err)
+	dup, err := enq.EnqueueUnique("wat", Q{"a": 3})
+	assert.NoError(t, err)
+	assert.Nil(t, dup)
+	results, err := enq.EnqueueBatch([]BatchItem{{JobName: "broken"}})
+	assert.NoError(t, err)
+	broken := results[0].Job
+	statusKeys, err := redis.Strings(conn.Do("KEYS", redisKeyJobStatus(ns, "*")))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(statusKeys))
+	status, err = client.JobStatus(broken.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobQueued, status.State)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.WaitForJob(ctx, job.ID)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	running := make(chan struct{})
+	release := make(chan struct{})
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool)
+	wp.Job("wat", func(job *Job) error {
+		if job.ArgInt64("a") == 2 {
+			close(running)
+			<-release
+		}
+		return job.SetResult(Q{"b": job.ArgInt64("a") * 2})
+	})
+	wp.JobWithOptions("broken", JobOptions{MaxFails: 2, Backoff: func(job *Job) int64 { return 0 }}, func(job *Job) error {
+		return errors.New("ohno")
+	})
+	wp.Start()
+	defer wp.Stop()
+
+	<-running
+	status, err = client.JobStatus(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobRunning, status.State)
+	close(release)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status, err = client.WaitForJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobSucceeded, status.State)
+	assert.True(t, status.Finished())
+	assert.JSONEq(t, `{"b":4}`, string(status.Result))
+
+	status, err = client.WaitForJob(ctx, broken.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobDead, status.State)
+	assert.EqualValues(t, 2, status.Fails)
+	assert.Equal(t, "ohno", status.LastErr)
+	assert.Nil(t, status.Result)
+
+	// Cancelled jobs are dead
+	sj, err := enq.EnqueueIn("wat", 100, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, client.CancelJob(sj.ID))
+	status, err = client.JobStatus(sj.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobDead, status.State)
+	assert.Equal(t, ErrJobCancelled.Error(), status.LastErr)
+}
+
+func TestClientJobStatusRequeued(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	client := NewClient(ns, pool)
+	enq := NewEnqueuerWithOptions(ns, pool, EnqueuerOptions{StatusTTL: time.Hour})
+	job, err := enq.Enqueue("broken", nil)
+	assert.NoError(t, err)
+
+	backend := newRedisBackend(ns, pool, nil)
+	fail := func() *Job {
+		fetched, err := backend.Fetch("1", []string{"broken"})
+		assert.NoError(t, err)
+		if !assert.NotNil(t, fetched) {
+			t.FailNow()
+		}
+		fetched.failed(errors.New("ohno"))
+		return fetched
+	}
+	assertStatus := func(state JobState, fails int64, lastErr string) {
+		status, err := client.JobStatus(job.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, state, status.State)
+		assert.Equal(t, fails, status.Fails)
+		assert.Equal(t, lastErr, status.LastErr)
+	}
+
+	// Retry jobs are queued again once they're requeued
+	assert.NoError(t, backend.Retry("1", fail(), nowEpochMilliseconds()-1000))
+	assertStatus(JobRetrying, 1, "ohno")
+	requeued, _, err := backend.RequeueDue(RetrySet, []string{"broken"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requeued)
+	assertStatus(JobQueued, 1, "ohno")
+
+	// So are dead jobs once they're retried, however they are
+	for _, retry := range []func() error{
+		func() error {
+			deadJobs, _, err := client.DeadJobs(1)
+			assert.NoError(t, err)
+			return client.RetryDeadJob(deadJobs[0].DiedAt, job.ID)
+		},
+		client.RetryAllDeadJobs,
+		func() error {
+			_, err := client.RetryDeadJobsMatching(JobFilter{JobName: "broken"})
+			return err
+		},
+	} {
+		dead := fail()
+		assert.NoError(t, backend.Dead("1", dead, false))
+		assertStatus(JobDead, dead.Fails, "ohno")
+		assert.NoError(t, retry())
+		assertStatus(JobQueued, 0, "")
+		assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "broken")))
+	}
+}
+
+func TestClientPauseResumeQueue(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue("wat", nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue("foo", nil)
+	assert.NoError(t, err)
+
+	client := NewClient(ns, pool)
+	err = client.PauseQueue("wat")
+	assert.NoError(t, err)
+
+	queues, err := client.Queues()
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(queues)) {
+		assert.Equal(t, "foo", queues[0].JobName)
+		assert.False(t, queues[0].Paused)
+		assert.Equal(t, "wat", queues[1].JobName)
+		assert.True(t, queues[1].Paused)
+	}
+
+	// paused queues aren't fetched from
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool)
+	wp.Job("wat", func(job *Job) error { return nil })
+	wp.Job("foo", func(job *Job) error { return nil })
+	wp.Start()
+	time.Sleep(20 * time.Millisecond)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "foo")))
+
+	err = client.ResumeQueue("wat")
+	assert.NoError(t, err)
+	wp.Drain()
+	wp.Stop()
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "wat")))
+
+	queues, err = client.Queues()
+	assert.NoError(t, err)
+	for _, q := range queues {
+		assert.False(t, q.Paused)
+	}
+
+	// pausing for a duration sets an expiry on the pause key
+	err = client.PauseQueueFor("wat", time.Minute)
+	assert.NoError(t, err)
+	conn := pool.Get()
+	defer conn.Close()
+	ttl, err := redis.Int64(conn.Do("PTTL", redisKeyJobsPaused(ns, "wat")))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute.Milliseconds())
+}
+
 func insertDeadJob(ns string, pool *redis.Pool, name string, encAt, failAt int64) *Job {
 	job := &Job{
 		Name:       name,
@@ -714,3 +1429,246 @@ func getQueuedJob(ns string, pool *redis.Pool, name string) *Job {
 	}
 	return job
 }
+
+func TestClientJobOverrides(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+	client := NewClient(ns, pool)
+
+	assert.NoError(t, client.SetJobConcurrency("wat", 1))
+	assert.NoError(t, client.SetJobPriority("wat", 7))
+	assert.Error(t, client.SetJobPriority("wat", 0))
+	assert.EqualValues(t, 1, getInt64(pool, redisKeyJobsConcurrency(ns, "wat")))
+
+	// Starting a pool doesn't undo the overrides
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool)
+	wp.JobWithOptions("wat", JobOptions{Priority: 3, MaxConcurrency: 5}, func(job *Job) error { return nil })
+	wp.JobWithOptions("foo", JobOptions{Priority: 2, MaxConcurrency: 4}, func(job *Job) error { return nil })
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+	assert.EqualValues(t, 1, getInt64(pool, redisKeyJobsConcurrency(ns, "wat")))
+	assert.EqualValues(t, 4, getInt64(pool, redisKeyJobsConcurrency(ns, "foo")))
+	for _, w := range wp.workers {
+		assert.Equal(t, map[string]uint{"wat": 7, "foo": 2}, samplerPriorities(w))
+	}
+
+	// The heartbeat picks up changes
+	assert.NoError(t, client.SetJobConcurrency("foo", 0))
+	assert.NoError(t, client.ResetJobOverrides("wat"))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsConcurrency(ns, "foo")))
+	wp.heartbeater.heartbeat()
+	assert.EqualValues(t, 5, getInt64(pool, redisKeyJobsConcurrency(ns, "wat")))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsConcurrency(ns, "foo")))
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+	for _, w := range wp.workers {
+		assert.Equal(t, map[string]uint{"wat": 3, "foo": 2}, samplerPriorities(w))
+	}
+}
+
+func TestClientPeriodicJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	assert.NoError(t, err)
+
+	wp := NewWorkerPool(TestContext{}, 10, ns, pool)
+	assert.NoError(t, wp.PeriodicallyEnqueueWithOptions("0/29 * * * * *", "foo", PeriodicJobOptions{Args: Q{"a": "b"}, Unique: true}))
+	assert.NoError(t, wp.PeriodicallyEnqueueWithOptions("0 8 3 * * *", "bar", PeriodicJobOptions{Location: kolkata, Jitter: time.Minute}))
+
+	setNowEpochSecondsMock(1468359453) // 2016-07-12 21:37:33 UTC
+	defer resetNowEpochSecondsMock()
+
+	client := NewClient(ns, pool)
+	periodicJobs, err := client.PeriodicJobs()
+	assert.NoError(t, err)
+	assert.Empty(t, periodicJobs)
+
+	pe := newPeriodicEnqueuer(ns, pool, wp.periodicJobs, nil)
+	assert.NoError(t, pe.register())
+	assert.NoError(t, pe.enqueue())
+
+	periodicJobs, err = client.PeriodicJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, []*PeriodicJob{
+		{
+			ID:           "bar:0 8 3 * * *",
+			Spec:         "0 8 3 * * *",
+			JobName:      "bar",
+			Location:     "Asia/Kolkata",
+			Jitter:       time.Minute,
+			RegisteredAt: 1468359453,
+			NextRunAt:    1468359480,
+		},
+		{
+			ID:           "foo:0/29 * * * * *",
+			Spec:         "0/29 * * * * *",
+			JobName:      "foo",
+			Args:         map[string]interface{}{"a": "b"},
+			Unique:       true,
+			RegisteredAt: 1468359453,
+			NextRunAt:    1468359478,
+		},
+	}, periodicJobs)
+
+	// The runs due since the previous enqueue are the last ones enqueued
+	setNowEpochSecondsMock(1468359603)
+	assert.NoError(t, pe.enqueue())
+
+	periodicJobs, err = client.PeriodicJobs()
+	assert.NoError(t, err)
+	if assert.Len(t, periodicJobs, 2) {
+		assert.EqualValues(t, 1468359480+24*60*60, periodicJobs[0].NextRunAt)
+		assert.EqualValues(t, 1468359480, periodicJobs[0].LastEnqueuedAt)
+		assert.EqualValues(t, 1468359629, periodicJobs[1].NextRunAt)
+		assert.EqualValues(t, 1468359600, periodicJobs[1].LastEnqueuedAt)
+	}
+}
+
+func TestClientManagePeriodicJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1468359453)
+	defer resetNowEpochSecondsMock()
+
+	client := NewClient(ns, pool)
+	assert.Error(t, client.AddPeriodicJob("", "0/29 * * * * *", "report", nil))
+	assert.Error(t, client.AddPeriodicJob("customer-42", "bad spec", "report", nil))
+	assert.Error(t, client.AddPeriodicJobWithOptions("customer-42", "0/29 * * * * *", "report", PeriodicJobOptions{Location: time.FixedZone("nowhere", 3600)}))
+	assert.NoError(t, client.AddPeriodicJob("customer-42", "0/29 * * * * *", "report", Q{"customer": 42}))
+	assert.NoError(t, client.AddPeriodicJobWithOptions("customer-7", "0/29 * * * * *", "report", PeriodicJobOptions{Args: Q{"customer": 7}, Unique: true}))
+	// The IDs of the periodic jobs of worker pools are reserved, as they'd overwrite the ones added with them
+	assert.Error(t, client.AddPeriodicJob("foo:0/29 * * * * *", "0/29 * * * * *", "report", nil))
+	assert.Error(t, client.AddPeriodicJob("work:foo:@daily", "0/29 * * * * *", "report", nil))
+	assert.NoError(t, client.AddPeriodicJob("customer:42", "0/29 * * * * *", "report", nil))
+	assert.NoError(t, client.RemovePeriodicJob("customer:42"))
+
+	var pjs []*periodicJob
+	pjs = appendPeriodicJob(pjs, "0/29 * * * * *", "foo")
+	pe := newPeriodicEnqueuer(ns, pool, pjs, nil)
+	assert.NoError(t, pe.register())
+	assert.NoError(t, pe.enqueue())
+
+	scheduledIDs := func(jobName string) []string {
+		var ids []string
+		for page := uint(1); ; page++ {
+			jobs, err := client.ScheduledJobsMatching(JobFilter{JobName: jobName}, page)
+			assert.NoError(t, err)
+			for _, j := range jobs {
+				ids = append(ids, j.ID)
+			}
+			if len(jobs) < 20 {
+				return ids
+			}
+		}
+	}
+	customerIDs := func(customer string) []string {
+		var ids []string
+		for _, id := range scheduledIDs("report") {
+			if isPeriodicInstanceID(id, customer) {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	reportIDs := scheduledIDs("report")
+	assert.Len(t, reportIDs, 24)
+	assert.Contains(t, reportIDs, "periodic:customer-42:1468359478")
+	assert.Contains(t, reportIDs, "periodic:customer-7:1468359478")
+	assert.Len(t, scheduledIDs("foo"), 12)
+
+	// The registrations which can't be loaded are skipped
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("HSET", redisKeyPeriodicJobs(ns), "broken", "{", "nowhere", `{"spec":"0/29 * * * * *","job_name":"report","location":"Nowhere/Else","dynamic":true}`)
+	assert.NoError(t, err)
+	periodicJobs, err := client.PeriodicJobs()
+	assert.NoError(t, err)
+	_, err = conn.Do("HDEL", redisKeyPeriodicJobs(ns), "broken", "nowhere")
+	assert.NoError(t, err)
+	if assert.Len(t, periodicJobs, 3) {
+		assert.Equal(t, "customer-42", periodicJobs[0].ID)
+		assert.Equal(t, map[string]interface{}{"customer": float64(42)}, periodicJobs[0].Args)
+		assert.True(t, periodicJobs[0].Dynamic)
+		assert.EqualValues(t, 1468359478, periodicJobs[0].NextRunAt)
+		assert.Equal(t, "customer-7", periodicJobs[1].ID)
+		assert.True(t, periodicJobs[1].Unique)
+		assert.Equal(t, "foo:0/29 * * * * *", periodicJobs[2].ID)
+		assert.False(t, periodicJobs[2].Dynamic)
+	}
+
+	// Paused periodic jobs are unscheduled and not enqueued until they're resumed
+	assert.Equal(t, ErrPeriodicJobNotFound, client.PausePeriodicJob("customer-1"))
+	assert.NoError(t, client.PausePeriodicJob("customer-42"))
+	assert.NoError(t, client.PausePeriodicJob("foo:0/29 * * * * *"))
+	assert.Len(t, scheduledIDs("report"), 12)
+	assert.Len(t, customerIDs("customer-7"), 12)
+	assert.Empty(t, scheduledIDs("foo"))
+
+	setNowEpochSecondsMock(1468359463)
+	assert.NoError(t, pe.enqueue())
+	assert.Len(t, scheduledIDs("report"), 12)
+	assert.Len(t, customerIDs("customer-7"), 12)
+	assert.Empty(t, scheduledIDs("foo"))
+
+	periodicJobs, err = client.PeriodicJobs()
+	assert.NoError(t, err)
+	if assert.Len(t, periodicJobs, 3) {
+		assert.True(t, periodicJobs[0].Paused)
+		assert.False(t, periodicJobs[1].Paused)
+		assert.True(t, periodicJobs[2].Paused)
+	}
+
+	assert.Equal(t, ErrPeriodicJobNotFound, client.ResumePeriodicJob("customer-1"))
+	assert.NoError(t, client.ResumePeriodicJob("customer-42"))
+	assert.NoError(t, client.ResumePeriodicJob("foo:0/29 * * * * *"))
+	setNowEpochSecondsMock(1468359473)
+	assert.NoError(t, pe.enqueue())
+	assert.Len(t, scheduledIDs("report"), 24)
+	assert.Len(t, scheduledIDs("foo"), 12)
+
+	// Removed periodic jobs are unscheduled and aren't enqueued anymore,
+	// leaving the unique key to the job already queued which holds it
+	uniqueKey, err := redisKeyUniqueJob(ns, "report", nil)
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", uniqueKey, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, ErrPeriodicJobNotFound, client.RemovePeriodicJob("customer-1"))
+	assert.NoError(t, client.RemovePeriodicJob("customer-7"))
+	assert.Equal(t, ErrPeriodicJobNotFound, client.RemovePeriodicJob("customer-7"))
+	exists, err := redis.Bool(conn.Do("EXISTS", uniqueKey))
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.Len(t, scheduledIDs("report"), 12)
+	assert.Empty(t, customerIDs("customer-7"))
+
+	setNowEpochSecondsMock(1468359483)
+	assert.NoError(t, pe.enqueue())
+	for _, id := range scheduledIDs("report") {
+		assert.True(t, isPeriodicInstanceID(id, "customer-42"), id)
+	}
+
+	periodicJobs, err = client.PeriodicJobs()
+	assert.NoError(t, err)
+	if assert.Len(t, periodicJobs, 2) {
+		assert.Equal(t, "customer-42", periodicJobs[0].ID)
+		assert.Equal(t, "foo:0/29 * * * * *", periodicJobs[1].ID)
+	}
+}
+
+func samplerPriorities(w *worker) map[string]uint {
+	priorities := make(map[string]uint)
+	for _, s := range w.sampler.samples {
+		priorities[s.jobName] = s.priority
+	}
+	return priorities
+}
@@ -0,0 +1,475 @@
+// Command work operates the jobs of a namespace from the command line.
+//
+// Usage:
+//
+//	work [flags] queues
+//	work [flags] workers
+//	work [flags] pause <job> [--for 10m]
+//	work [flags] resume <job>
+//	work [flags] enqueue <job> [--args JSON] [--in 30s] [--unique]
+//	work [flags] dead list [--page N]
+//	work [flags] dead retry (<died_at> <job_id> | --all)
+//	work [flags] dead delete (<died_at> <job_id> | --all)
+//	work [flags] retry list [--page N]
+//	work [flags] scheduled list [--page N]
+//	work [flags] scheduled delete <run_at> <job_id>
+//
+// Flags, which may appear anywhere on the command line:
+//
+//	--redis     redis hostport (default ":6379")
+//	--database  redis database (default 0)
+//	--ns        redis namespace (default "work")
+//	--json      print JSON instead of tables
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pchchv/work"
+)
+
+const usage = `usage:
+  work [flags] queues
+  work [flags] workers
+  work [flags] pause <job> [--for 10m]
+  work [flags] resume <job>
+  work [flags] enqueue <job> [--args JSON] [--in 30s] [--unique]
+  work [flags] dead list [--page N]
+  work [flags] dead retry (<died_at> <job_id> | --all)
+  work [flags] dead delete (<died_at> <job_id> | --all)
+  work [flags] retry list [--page N]
+  work [flags] scheduled list [--page N]
+  work [flags] scheduled delete <run_at> <job_id>
+
+flags:
+  --redis     redis hostport (default ":6379")
+  --database  redis database (default 0)
+  --ns        redis namespace (default "work")
+  --json      print JSON instead of tables
+`
+
+var errUsage = errors.New("invalid usage")
+
+type cli struct {
+	out io.Writer
+	// global flags
+	redisHostPort string
+	database      int
+	namespace     string
+	json          bool
+	// command flags
+	page     uint
+	all      bool
+	args     string
+	in       time.Duration
+	unique   bool
+	pauseFor time.Duration
+	// set up after parsing
+	pool     *redis.Pool
+	client   *work.Client
+	enqueuer *work.Enqueuer
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "work:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	c := &cli{out: out}
+	fs := flag.NewFlagSet("work", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&c.redisHostPort, "redis", ":6379", "")
+	fs.IntVar(&c.database, "database", 0, "")
+	fs.StringVar(&c.namespace, "ns", "work", "")
+	fs.BoolVar(&c.json, "json", false, "")
+	fs.UintVar(&c.page, "page", 1, "")
+	fs.BoolVar(&c.all, "all", false, "")
+	fs.StringVar(&c.args, "args", "", "")
+	fs.DurationVar(&c.in, "in", 0, "")
+	fs.BoolVar(&c.unique, "unique", false, "")
+	fs.DurationVar(&c.pauseFor, "for", 0, "")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if len(positional) == 0 {
+		return errUsage
+	}
+
+	c.pool = newPool(c.redisHostPort, c.database)
+	defer c.pool.Close()
+	c.client = work.NewClient(c.namespace, c.pool)
+	c.enqueuer = work.NewEnqueuer(c.namespace, c.pool)
+
+	cmd, rest := positional[0], positional[1:]
+	switch cmd {
+	case "queues":
+		return c.queues(rest)
+	case "workers":
+		return c.workers(rest)
+	case "pause":
+		return c.pause(rest)
+	case "resume":
+		return c.resume(rest)
+	case "enqueue":
+		return c.enqueue(rest)
+	case "dead":
+		return c.dead(rest)
+	case "retry":
+		return c.retry(rest)
+	case "scheduled":
+		return c.scheduled(rest)
+	}
+	return errUsage
+}
+
+// parseInterspersed parses args with fs,
+// allowing flags to appear before, between and after positional arguments.
+// It returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (c *cli) queues(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	queues, err := c.client.Queues()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(queues)
+	}
+
+	return c.printTable([]string{"JOB", "COUNT", "LATENCY", "PAUSED"}, len(queues), func(i int) []interface{} {
+		q := queues[i]
+		return []interface{}{q.JobName, q.Count, time.Duration(q.Latency) * time.Second, q.Paused}
+	})
+}
+
+func (c *cli) workers(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	heartbeats, err := c.client.WorkerPoolHeartbeats()
+	if err != nil {
+		return err
+	}
+
+	observations, err := c.client.WorkerObservations()
+	if err != nil {
+		return err
+	}
+
+	busy := make([]*work.WorkerObservation, 0, len(observations))
+	for _, ob := range observations {
+		if ob.IsBusy {
+			busy = append(busy, ob)
+		}
+	}
+
+	if c.json {
+		return c.printJSON(map[string]interface{}{"worker_pools": heartbeats, "busy_workers": busy})
+	}
+
+	err = c.printTable([]string{"WORKER_POOL", "HOST", "PID", "CONCURRENCY", "JOBS", "STARTED", "HEARTBEAT"}, len(heartbeats), func(i int) []interface{} {
+		hb := heartbeats[i]
+		return []interface{}{hb.WorkerPoolID, hb.Host, hb.Pid, hb.Concurrency, strings.Join(hb.JobNames, ","), formatEpoch(hb.StartedAt), formatEpoch(hb.HeartbeatAt)}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.out)
+	return c.printTable([]string{"WORKER", "JOB", "JOB_ID", "STARTED", "ARGS", "CHECKIN"}, len(busy), func(i int) []interface{} {
+		ob := busy[i]
+		return []interface{}{ob.WorkerID, ob.JobName, ob.JobID, formatEpoch(ob.StartedAt), ob.ArgsJSON, ob.Checkin}
+	})
+}
+
+func (c *cli) pause(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if err := c.client.PauseQueueFor(args[0], c.pauseFor); err != nil {
+		return err
+	}
+	return c.printStatus("paused " + args[0])
+}
+
+func (c *cli) resume(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if err := c.client.ResumeQueue(args[0]); err != nil {
+		return err
+	}
+	return c.printStatus("resumed " + args[0])
+}
+
+func (c *cli) enqueue(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	jobName := args[0]
+	var jobArgs map[string]interface{}
+	if c.args != "" {
+		if err := json.Unmarshal([]byte(c.args), &jobArgs); err != nil {
+			return fmt.Errorf("invalid --args: %w", err)
+		}
+	}
+
+	var job interface{}
+	var err error
+	switch {
+	case c.in > 0 && c.unique:
+		var sj *work.ScheduledJob
+		if sj, err = c.enqueuer.EnqueueUniqueAfter(jobName, c.in, jobArgs); sj != nil {
+			job = sj
+		}
+	case c.in > 0:
+		job, err = c.enqueuer.EnqueueAfter(jobName, c.in, jobArgs)
+	case c.unique:
+		var j *work.Job
+		if j, err = c.enqueuer.EnqueueUnique(jobName, jobArgs); j != nil {
+			job = j
+		}
+	default:
+		job, err = c.enqueuer.Enqueue(jobName, jobArgs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if job == nil {
+		return c.printStatus("not enqueued: a job with the same name and arguments is already enqueued")
+	}
+	if c.json {
+		return c.printJSON(job)
+	}
+	switch j := job.(type) {
+	case *work.ScheduledJob:
+		fmt.Fprintf(c.out, "enqueued %s %s to run at %s\n", j.Name, j.ID, formatEpoch(j.RunAt))
+	case *work.Job:
+		fmt.Fprintf(c.out, "enqueued %s %s\n", j.Name, j.ID)
+	}
+	return nil
+}
+
+func (c *cli) dead(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		jobs, count, err := c.client.DeadJobs(c.page)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.printJSON(map[string]interface{}{"count": count, "jobs": jobs})
+		}
+
+		return c.printJobs(count, []string{"DIED_AT", "ID", "JOB", "FAILS", "ERROR", "ARGS"}, len(jobs), func(i int) []interface{} {
+			j := jobs[i]
+			return []interface{}{j.DiedAt, j.ID, j.Name, j.Fails, j.LastErr, formatArgs(j.Args)}
+		})
+	case "retry":
+		if c.all {
+			if len(args) != 1 {
+				return errUsage
+			}
+			if err := c.client.RetryAllDeadJobs(); err != nil {
+				return err
+			}
+			return c.printStatus("retried all dead jobs")
+		}
+		return c.zsetJobAction(args[1:], c.client.RetryDeadJob, "retried")
+	case "delete":
+		if c.all {
+			if len(args) != 1 {
+				return errUsage
+			}
+			if err := c.client.DeleteAllDeadJobs(); err != nil {
+				return err
+			}
+			return c.printStatus("deleted all dead jobs")
+		}
+		return c.zsetJobAction(args[1:], c.client.DeleteDeadJob, "deleted")
+	}
+	return errUsage
+}
+
+func (c *cli) retry(args []string) error {
+	if len(args) != 1 || args[0] != "list" {
+		return errUsage
+	}
+
+	jobs, count, err := c.client.RetryJobs(c.page)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(map[string]interface{}{"count": count, "jobs": jobs})
+	}
+
+	return c.printJobs(count, []string{"RETRY_AT", "ID", "JOB", "FAILS", "ERROR", "ARGS"}, len(jobs), func(i int) []interface{} {
+		j := jobs[i]
+		return []interface{}{j.RetryAt, j.ID, j.Name, j.Fails, j.LastErr, formatArgs(j.Args)}
+	})
+}
+
+func (c *cli) scheduled(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		jobs, count, err := c.client.ScheduledJobs(c.page)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.printJSON(map[string]interface{}{"count": count, "jobs": jobs})
+		}
+
+		return c.printJobs(count, []string{"RUN_AT", "ID", "JOB", "ARGS"}, len(jobs), func(i int) []interface{} {
+			j := jobs[i]
+			return []interface{}{j.RunAt, j.ID, j.Name, formatArgs(j.Args)}
+		})
+	case "delete":
+		return c.zsetJobAction(args[1:], c.client.DeleteScheduledJob, "deleted")
+	}
+	return errUsage
+}
+
+// zsetJobAction calls fn with the score and job ID given in args.
+func (c *cli) zsetJobAction(args []string, fn func(int64, string) error, done string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	score, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	if err := fn(score, args[1]); err != nil {
+		return err
+	}
+	return c.printStatus(done + " " + args[1])
+}
+
+func (c *cli) printJobs(count int64, header []string, n int, row func(int) []interface{}) error {
+	if err := c.printTable(header, n, row); err != nil {
+		return err
+	}
+
+	pages := (count + 19) / 20
+	if pages == 0 {
+		pages = 1
+	}
+	_, err := fmt.Fprintf(c.out, "page %d of %d (%d jobs)\n", c.page, pages, count)
+	return err
+}
+
+func (c *cli) printTable(header []string, n int, row func(int) []interface{}) error {
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for i := 0; i < n; i++ {
+		cells := row(i)
+		strs := make([]string, len(cells))
+		for j, cell := range cells {
+			strs[j] = fmt.Sprint(cell)
+		}
+		fmt.Fprintln(tw, strings.Join(strs, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (c *cli) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (c *cli) printStatus(msg string) error {
+	if c.json {
+		return c.printJSON(map[string]string{"status": msg})
+	}
+	_, err := fmt.Fprintln(c.out, msg)
+	return err
+}
+
+func formatEpoch(t int64) string {
+	if t == 0 {
+		return "-"
+	}
+	return time.Unix(t, 0).Format(time.RFC3339)
+}
+
+func formatArgs(args map[string]interface{}) string {
+	if len(args) == 0 {
+		return "-"
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+func newPool(addr string, database int) *redis.Pool {
+	return &redis.Pool{
+		MaxActive:   3,
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, redis.DialDatabase(database))
+		},
+		Wait: true,
+	}
+}
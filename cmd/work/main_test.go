@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pchchv/work"
+	"github.com/stretchr/testify/assert"
+)
+
+const testNamespace = "work_cli"
+
+func TestCLIEnqueueAndQueues(t *testing.T) {
+	pool := newPool(":6379", 0)
+	cleanKeyspace(testNamespace, pool)
+
+	out, err := runCLI("enqueue", "send_email", "--args", `{"addr":"a@b.c"}`)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "enqueued send_email "))
+
+	out, err = runCLI("enqueue", "send_email", "--unique", "--json")
+	assert.NoError(t, err)
+	var job work.Job
+	assert.NoError(t, json.Unmarshal([]byte(out), &job))
+	assert.Equal(t, "send_email", job.Name)
+	assert.True(t, job.Unique)
+
+	out, err = runCLI("enqueue", "send_email", "--unique")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "not enqueued"))
+
+	out, err = runCLI("enqueue", "send_email", "--in", "30s")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "to run at")
+
+	out, err = runCLI("pause", "send_email")
+	assert.NoError(t, err)
+	assert.Equal(t, "paused send_email\n", out)
+
+	out, err = runCLI("--json", "queues")
+	assert.NoError(t, err)
+	var queues []*work.Queue
+	assert.NoError(t, json.Unmarshal([]byte(out), &queues))
+	if assert.Equal(t, 1, len(queues)) {
+		assert.EqualValues(t, 2, queues[0].Count)
+		assert.True(t, queues[0].Paused)
+	}
+
+	out, err = runCLI("queues")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, []string{"JOB", "COUNT", "LATENCY", "PAUSED"}, strings.Fields(lines[0]))
+	assert.Equal(t, "send_email", strings.Fields(lines[1])[0])
+
+	_, err = runCLI("resume", "send_email")
+	assert.NoError(t, err)
+
+	out, err = runCLI("scheduled", "list")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "page 1 of 1 (1 jobs)")
+
+	// --in isn't truncated to seconds
+	before := time.Now().UnixMilli()
+	_, err = runCLI("enqueue", "send_email", "--in", "1500ms")
+	assert.NoError(t, err)
+	conn := pool.Get()
+	defer conn.Close()
+	values, err := redis.Values(conn.Do("ZRANGE", testNamespace+":scheduled", 0, 0, "WITHSCORES"))
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(values)) {
+		runAt, err := redis.Int64(values[1], nil)
+		assert.NoError(t, err)
+		assert.True(t, runAt >= before+1500 && runAt <= time.Now().UnixMilli()+1500)
+	}
+}
+
+func TestCLIDeadJobs(t *testing.T) {
+	pool := newPool(":6379", 0)
+	cleanKeyspace(testNamespace, pool)
+
+	job1 := insertDeadJob(pool, "wat", 1425263409)
+	job2 := insertDeadJob(pool, "wat", 1425263410)
+	insertDeadJob(pool, "wat", 1425263411)
+	addKnownJob(pool, "wat")
+
+	out, err := runCLI("dead", "list", "--json")
+	assert.NoError(t, err)
+	var page struct {
+		Count int64           `json:"count"`
+		Jobs  []*work.DeadJob `json:"jobs"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(out), &page))
+	assert.EqualValues(t, 3, page.Count)
+
+	out, err = runCLI("dead", "delete", "1425263409", job1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "deleted "+job1.ID+"\n", out)
+
+	_, err = runCLI("dead", "delete", "1425263409", job1.ID)
+	assert.Equal(t, work.ErrNotDeleted, err)
+
+	_, err = runCLI("dead", "retry", "1425263410", job2.ID)
+	assert.NoError(t, err)
+
+	_, err = runCLI("dead", "retry", "--all")
+	assert.NoError(t, err)
+
+	out, err = runCLI("dead", "list")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "page 1 of 1 (0 jobs)")
+
+	out, err = runCLI("--json", "queues")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"count": 2`)
+}
+
+func TestCLIUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"bogus"},
+		{"dead"},
+		{"dead", "delete", "notanumber", "id"},
+		{"enqueue"},
+		{"queues", "--nope"},
+	} {
+		_, err := runCLI(args...)
+		assert.ErrorIs(t, err, errUsage, "%v", args)
+	}
+}
+
+func runCLI(args ...string) (string, error) {
+	var buf bytes.Buffer
+	err := run(append([]string{"--ns", testNamespace}, args...), &buf)
+	return buf.String(), err
+}
+
+func insertDeadJob(pool *redis.Pool, name string, failAt int64) *work.Job {
+	job := &work.Job{
+		Name:       name,
+		ID:         strings.Repeat("a", 8) + time.Unix(failAt, 0).Format("150405"),
+		EnqueuedAt: failAt - 10,
+		Fails:      3,
+		LastErr:    "sorry",
+		FailedAt:   failAt,
+	}
+
+	rawJSON, err := json.Marshal(job)
+	if err != nil {
+		panic(err)
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("ZADD", testNamespace+":dead", failAt, rawJSON); err != nil {
+		panic(err)
+	}
+	return job
+}
+
+func addKnownJob(pool *redis.Pool, name string) {
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("SADD", testNamespace+":known_jobs", name); err != nil {
+		panic(err)
+	}
+}
+
+func cleanKeyspace(namespace string, pool *redis.Pool) {
+	conn := pool.Get()
+	defer conn.Close()
+
+	keys, err := redis.Strings(conn.Do("KEYS", namespace+"*"))
+	if err != nil {
+		panic("could not get keys: " + err.Error())
+	}
+	for _, k := range keys {
+		if _, err := conn.Do("DEL", k); err != nil {
+			panic("could not del: " + err.Error())
+		}
+	}
+}
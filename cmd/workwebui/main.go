@@ -0,0 +1,57 @@
+// Command workwebui serves the web UI and JSON API of the webui package.
+//
+// Usage:
+//
+//	workwebui -redis="redis:6379" -ns="myapp-work" -listen=":5040"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pchchv/work/webui"
+)
+
+var (
+	redisHostPort  = flag.String("redis", ":6379", "redis hostport")
+	redisDatabase  = flag.Int("database", 0, "redis database")
+	redisNamespace = flag.String("ns", "work", "redis namespace")
+	webHostPort    = flag.String("listen", ":5040", "hostport to listen for HTTP JSON API")
+)
+
+func main() {
+	flag.Parse()
+
+	pool := newPool(*redisHostPort, *redisDatabase)
+	server := webui.NewServer(*redisNamespace, pool, *webHostPort)
+	if err := server.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, "workwebui:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Serving namespace %q on %s\n", *redisNamespace, *webHostPort)
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+
+	if err := server.Stop(); err != nil {
+		fmt.Fprintln(os.Stderr, "workwebui:", err)
+	}
+}
+
+func newPool(addr string, database int) *redis.Pool {
+	return &redis.Pool{
+		MaxActive:   3,
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, redis.DialDatabase(database))
+		},
+		Wait: true,
+	}
+}
@@ -18,7 +18,9 @@ const (
 
 type deadPoolReaper struct {
 	namespace        string
-	pool             *redis.Pool
+	pool             Pool
+	logger           Logger
+	metrics          Metrics
 	deadTime         time.Duration
 	reapPeriod       time.Duration
 	curJobTypes      []string
@@ -26,10 +28,16 @@ type deadPoolReaper struct {
 	doneStoppingChan chan struct{}
 }
 
-func newDeadPoolReaper(namespace string, pool *redis.Pool, curJobTypes []string) *deadPoolReaper {
+func newDeadPoolReaper(namespace string, pool Pool, curJobTypes []string, logger Logger, metrics Metrics) *deadPoolReaper {
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+
 	return &deadPoolReaper{
 		namespace:        namespace,
 		pool:             pool,
+		logger:           logger,
+		metrics:          metrics,
 		deadTime:         deadTime,
 		reapPeriod:       reapPeriod,
 		curJobTypes:      curJobTypes,
@@ -107,6 +115,12 @@ func (r *deadPoolReaper) requeueInProgressJobs(poolID string, jobTypes []string)
 		if len(values) != 3 {
 			return fmt.Errorf("need 3 elements back")
 		}
+
+		jobQueue, err := redis.String(values[2], nil)
+		if err != nil {
+			return err
+		}
+		r.metrics.DeadPoolJobRecovered(strings.TrimPrefix(jobQueue, redisKeyJobsPrefix(r.namespace)))
 	}
 }
 
@@ -146,7 +160,9 @@ func (r *deadPoolReaper) reap() error {
 		lockJobTypes := jobTypes
 		// if we found jobs from the heartbeat, requeue them and remove the heartbeat
 		if len(jobTypes) > 0 {
-			r.requeueInProgressJobs(deadPoolID, jobTypes)
+			if err := r.requeueInProgressJobs(deadPoolID, jobTypes); err != nil {
+				logError(r.logger, "dead_pool_reaper.requeue", err, "namespace", r.namespace, "worker_pool_id", deadPoolID)
+			}
 			if _, err = conn.Do("DEL", redisKeyHeartbeat(r.namespace, deadPoolID)); err != nil {
 				return err
 			}
@@ -182,7 +198,7 @@ func (r *deadPoolReaper) loop() {
 
 			// Reap
 			if err := r.reap(); err != nil {
-				logError("dead_pool_reaper.reap", err)
+				logError(r.logger, "dead_pool_reaper.reap", err, "namespace", r.namespace)
 			}
 		}
 	}
@@ -0,0 +1,129 @@
+package work
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const deadPrunerSleep = 5 * time.Minute
+
+// deadPruner deletes the dead jobs over the retention limits of a worker pool.
+// Like with the periodic enqueuer, the time it last ran at is kept in Redis,
+// so that a single one of the worker pools of a namespace prunes the dead jobs at a time.
+type deadPruner struct {
+	namespace        string
+	pool             Pool
+	logger           Logger
+	maxAge           time.Duration
+	maxJobs          uint
+	sleep            time.Duration
+	stopChan         chan struct{}
+	doneStoppingChan chan struct{}
+}
+
+func newDeadPruner(namespace string, pool Pool, maxAge time.Duration, maxJobs uint, logger Logger) *deadPruner {
+	return &deadPruner{
+		namespace:        namespace,
+		pool:             pool,
+		logger:           logger,
+		maxAge:           maxAge,
+		maxJobs:          maxJobs,
+		sleep:            deadPrunerSleep,
+		stopChan:         make(chan struct{}),
+		doneStoppingChan: make(chan struct{}),
+	}
+}
+
+func (p *deadPruner) start() {
+	go p.loop()
+}
+
+func (p *deadPruner) stop() {
+	p.stopChan <- struct{}{}
+	<-p.doneStoppingChan
+}
+
+func (p *deadPruner) loop() {
+	timer := time.NewTimer(p.sleep + time.Duration(rand.Intn(30))*time.Second)
+	defer timer.Stop()
+
+	p.pruneIfDue()
+	for {
+		select {
+		case <-p.stopChan:
+			p.doneStoppingChan <- struct{}{}
+			return
+		case <-timer.C:
+			timer.Reset(p.sleep + time.Duration(rand.Intn(30))*time.Second)
+			p.pruneIfDue()
+		}
+	}
+}
+
+func (p *deadPruner) shouldPrune() bool {
+	conn := p.pool.Get()
+	defer conn.Close()
+
+	lastPrune, err := redis.Int64(conn.Do("GET", redisKeyLastDeadPrune(p.namespace)))
+	if err == redis.ErrNil {
+		return true
+	} else if err != nil {
+		logError(p.logger, "dead_pruner.should_prune", err, "namespace", p.namespace)
+		return true
+	}
+
+	return lastPrune < nowEpochSeconds()-int64(p.sleep/time.Second)
+}
+
+func (p *deadPruner) pruneIfDue() {
+	if !p.shouldPrune() {
+		return
+	}
+
+	conn := p.pool.Get()
+	defer conn.Close()
+
+	if _, err := pruneDeadJobs(conn, p.namespace, p.maxAge, p.maxJobs); err != nil {
+		logError(p.logger, "dead_pruner.prune", err, "namespace", p.namespace)
+		return
+	}
+	if _, err := conn.Do("SET", redisKeyLastDeadPrune(p.namespace), nowEpochSeconds()); err != nil {
+		logError(p.logger, "dead_pruner.set_last_prune", err, "namespace", p.namespace)
+	}
+}
+
+// pruneDeadJobs deletes the dead jobs which died over olderThan ago,
+// and the oldest ones over the keepMax most recent ones, and returns the number of jobs deleted.
+// A zero olderThan or keepMax means no limit.
+func pruneDeadJobs(conn redis.Conn, namespace string, olderThan time.Duration, keepMax uint) (int64, error) {
+	if olderThan <= 0 && keepMax == 0 {
+		return 0, nil
+	}
+
+	maxDiedAt := "-inf"
+	if olderThan > 0 {
+		maxDiedAt = "(" + strconv.FormatInt(nowEpochSeconds()-int64(olderThan/time.Second), 10)
+	}
+	return deleteDeadJobs(conn, namespace, maxDiedAt, keepMax)
+}
+
+// deleteDeadJobs deletes the dead jobs which died before maxDiedAt, a ZCOUNT bound,
+// and the oldest ones over the keepMax most recent ones, in chunks of zsetScanCount jobs,
+// releasing the unique keys of the UniqueAcrossDead jobs, and returns the number of jobs deleted.
+func deleteDeadJobs(conn redis.Conn, namespace, maxDiedAt string, keepMax uint) (int64, error) {
+	script := redis.NewScript(1, redisLuaDeleteDeadJobs)
+	var deleted int64
+	for {
+		n, err := redis.Int64(script.Do(conn, redisKeyDead(namespace), maxDiedAt, keepMax, zsetScanCount, int(UniqueAcrossDead)))
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+		if n < zsetScanCount {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package work
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadPruner(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	now := nowEpochSeconds()
+	setNowEpochSecondsMock(now)
+	defer resetNowEpochSecondsMock()
+
+	for i := int64(0); i < 5; i++ {
+		insertDeadJob(ns, pool, "wat", now-100, now-i*60)
+	}
+
+	// The jobs over a day old are pruned first, then the oldest ones over the limit
+	insertDeadJob(ns, pool, "wat", now-100000, now-90000)
+	p := newDeadPruner(ns, pool, 24*time.Hour, 3, nil)
+	assert.True(t, p.shouldPrune())
+	p.pruneIfDue()
+	assert.EqualValues(t, 3, zsetSize(pool, redisKeyDead(ns)))
+	ts, _ := jobOnZset(pool, redisKeyDead(ns))
+	assert.Equal(t, now-120, ts)
+
+	// Another pool doesn't prune again until it's due
+	assert.EqualValues(t, now, getInt64(pool, redisKeyLastDeadPrune(ns)))
+	p = newDeadPruner(ns, pool, 0, 1, nil)
+	assert.False(t, p.shouldPrune())
+	p.pruneIfDue()
+	assert.EqualValues(t, 3, zsetSize(pool, redisKeyDead(ns)))
+
+	setNowEpochSecondsMock(now + int64(deadPrunerSleep/time.Second) + 1)
+	assert.True(t, p.shouldPrune())
+	p.pruneIfDue()
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(ns)))
+	ts, _ = jobOnZset(pool, redisKeyDead(ns))
+	assert.Equal(t, now, ts)
+}
+
+func TestWorkerPoolDeadPruner(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	now := nowEpochSeconds()
+	insertDeadJob(ns, pool, "wat", now-100, now-7200)
+	insertDeadJob(ns, pool, "wat", now-100, now)
+
+	wp := NewWorkerPoolWithOptions(TestContext{}, 1, ns, pool, WorkerPoolOptions{MaxDeadAge: time.Hour})
+	wp.Job("wat", func(job *Job) error { return nil })
+	wp.Start()
+	wp.Stop()
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(ns)))
+}
@@ -0,0 +1,136 @@
+package work
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// debounceKeepSeconds is how long the job last scheduled for a debounce key is remembered for once it's due,
+// in case the scheduled jobs are requeued late.
+const debounceKeepSeconds = 24 * 60 * 60
+
+// EnqueueDebounced enqueues a job in the scheduled job queue for execution after delay,
+// replacing the job scheduled by a previous call with the same name and key unless it's due already.
+// So a burst of calls runs a single job, delay after the last call, with the args of the last call.
+func (e *Enqueuer) EnqueueDebounced(jobName, key string, delay time.Duration, args map[string]interface{}) (*ScheduledJob, error) {
+	if e.redis == nil {
+		return nil, ErrUnsupportedBackend
+	}
+
+	runAt := nowEpochMilliseconds() + ceilMilliseconds(delay)
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		StatusTTL:  e.statusTTL,
+	}
+	scheduledJob := &ScheduledJob{
+		RunAt: runAt / 1000,
+		Job:   job,
+	}
+
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := e.Pool.Get()
+	defer conn.Close()
+
+	if err := e.redis.addToKnownJobs(conn, jobName); err != nil {
+		return nil, err
+	}
+
+	sendJobStatus(conn, e.Namespace, job, JobQueued)
+	replaced, err := redis.Bytes(e.debounceScript.Do(conn,
+		redisKeyScheduled(e.Namespace),
+		redisKeyDebounce(e.Namespace, jobName, key),
+		rawJSON,
+		runAt,
+		ceilSeconds(delay)+debounceKeepSeconds,
+	))
+	if err != nil && err != redis.ErrNil {
+		return nil, err
+	}
+	e.deleteReplacedStatus(conn, replaced)
+	return scheduledJob, nil
+}
+
+// EnqueueThrottled enqueues a job unless a job with the same name and key
+// was enqueued by a previous call less than window ago.
+// Then it's scheduled for the end of the window instead, replacing the job scheduled by a previous call if any.
+// So at most one job runs per window, and the args of the last call aren't lost.
+// The RunAt of the job returned is now if it was enqueued right away.
+func (e *Enqueuer) EnqueueThrottled(jobName, key string, window time.Duration, args map[string]interface{}) (*ScheduledJob, error) {
+	if e.redis == nil {
+		return nil, ErrUnsupportedBackend
+	}
+
+	windowMilliseconds := ceilMilliseconds(window)
+	if windowMilliseconds <= 0 {
+		windowMilliseconds = 1
+	}
+
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		StatusTTL:  e.statusTTL,
+	}
+
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := e.Pool.Get()
+	defer conn.Close()
+
+	if err := e.redis.addToKnownJobs(conn, jobName); err != nil {
+		return nil, err
+	}
+
+	sendJobStatus(conn, e.Namespace, job, JobQueued)
+	values, err := redis.Values(e.throttleScript.Do(conn,
+		e.queuePrefix+jobName,
+		redisKeyScheduled(e.Namespace),
+		redisKeyThrottle(e.Namespace, jobName, key),
+		rawJSON,
+		nowEpochMilliseconds(),
+		windowMilliseconds,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var runAt int64
+	var replaced []byte
+	if _, err := redis.Scan(values, &runAt, &replaced); err != nil {
+		return nil, err
+	}
+	e.deleteReplacedStatus(conn, replaced)
+	return &ScheduledJob{RunAt: runAt / 1000, Job: job}, nil
+}
+
+// deleteReplacedStatus deletes the status of the job replaced by a debounced or throttled one, if it's tracked,
+// as it won't run.
+func (e *Enqueuer) deleteReplacedStatus(conn redis.Conn, replaced []byte) {
+	if replaced == nil {
+		return
+	}
+
+	job, err := newJob(replaced, nil, nil)
+	if err != nil {
+		logError(e.logger, "enqueuer.delete_replaced_status.new_job", err, "namespace", e.Namespace)
+		return
+	}
+	if job.StatusTTL <= 0 {
+		return
+	}
+	if _, err := conn.Do("DEL", redisKeyJobStatus(e.Namespace, job.ID)); err != nil {
+		logError(e.logger, "enqueuer.delete_replaced_status.del", err, "namespace", e.Namespace, "job_name", job.Name, "job_id", job.ID)
+	}
+}
@@ -0,0 +1,105 @@
+package work
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnqueueDebounced(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuerWithOptions(ns, pool, EnqueuerOptions{StatusTTL: time.Hour})
+
+	now := nowEpochSeconds()
+	setNowEpochSecondsMock(now)
+	defer resetNowEpochSecondsMock()
+
+	first, err := enqueuer.EnqueueDebounced("wat", "k", 10*time.Second, Q{"v": 1})
+	assert.NoError(t, err)
+	assert.EqualValues(t, now+10, first.RunAt)
+
+	// Each call pushes the job back, with the latest args
+	setNowEpochSecondsMock(now + 5)
+	job, err := enqueuer.EnqueueDebounced("wat", "k", 10*time.Second, Q{"v": 2})
+	assert.NoError(t, err)
+	assert.EqualValues(t, now+15, job.RunAt)
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(ns)))
+	score, j := jobOnZset(pool, redisKeyScheduled(ns))
+	assert.EqualValues(t, now+15, score)
+	assert.Equal(t, job.ID, j.ID)
+	assert.EqualValues(t, 2, j.ArgInt64("v"))
+
+	client := NewClient(ns, pool)
+	_, err = client.JobStatus(first.ID)
+	assert.Equal(t, ErrJobNotFound, err)
+
+	// Other keys are debounced separately
+	_, err = enqueuer.EnqueueDebounced("wat", "other", 20*time.Second, nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, zsetSize(pool, redisKeyScheduled(ns)))
+
+	// Once the job is due, the next call schedules another one
+	setNowEpochSecondsMock(now + 15)
+	_, _, err = enqueuer.redis.RequeueDue(ScheduledSet, []string{"wat"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "wat")))
+	_, err = enqueuer.EnqueueDebounced("wat", "k", 10*time.Second, Q{"v": 3})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 2, zsetSize(pool, redisKeyScheduled(ns)))
+
+	_, err = NewEnqueuerWithBackend(NewMemoryBackend(), EnqueuerOptions{}).EnqueueDebounced("wat", "k", time.Second, nil)
+	assert.Equal(t, ErrUnsupportedBackend, err)
+}
+
+func TestEnqueueThrottled(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	now := nowEpochSeconds()
+	setNowEpochSecondsMock(now)
+	defer resetNowEpochSecondsMock()
+
+	// The first job runs right away
+	job, err := enqueuer.EnqueueThrottled("wat", "k", time.Minute, Q{"v": 1})
+	assert.NoError(t, err)
+	assert.EqualValues(t, now, job.RunAt)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "wat")))
+
+	// The next ones in the window are scheduled for its end, with the latest args
+	setNowEpochSecondsMock(now + 10)
+	job, err = enqueuer.EnqueueThrottled("wat", "k", time.Minute, Q{"v": 2})
+	assert.NoError(t, err)
+	assert.EqualValues(t, now+60, job.RunAt)
+	job, err = enqueuer.EnqueueThrottled("wat", "k", time.Minute, Q{"v": 3})
+	assert.NoError(t, err)
+	assert.EqualValues(t, now+60, job.RunAt)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(ns)))
+	score, j := jobOnZset(pool, redisKeyScheduled(ns))
+	assert.EqualValues(t, now+60, score)
+	assert.EqualValues(t, 3, j.ArgInt64("v"))
+
+	// Once it ran, the next job is scheduled for the end of the following window
+	setNowEpochSecondsMock(now + 60)
+	_, _, err = enqueuer.redis.RequeueDue(ScheduledSet, []string{"wat"})
+	assert.NoError(t, err)
+	job, err = enqueuer.EnqueueThrottled("wat", "k", time.Minute, Q{"v": 4})
+	assert.NoError(t, err)
+	assert.EqualValues(t, now+120, job.RunAt)
+
+	// After a quiet window, jobs run right away again
+	setNowEpochSecondsMock(now + 200)
+	_, _, err = enqueuer.redis.RequeueDue(ScheduledSet, []string{"wat"})
+	assert.NoError(t, err)
+	job, err = enqueuer.EnqueueThrottled("wat", "k", time.Minute, Q{"v": 5})
+	assert.NoError(t, err)
+	assert.EqualValues(t, now+200, job.RunAt)
+	assert.EqualValues(t, 4, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(ns)))
+}
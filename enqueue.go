@@ -1,65 +1,77 @@
 package work
 
 import (
-	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
 
-type enqueueFnType func(*int64) (string, error)
-
 // Enqueuer can enqueue jobs.
 type Enqueuer struct {
-	Namespace             string // eg, "myapp-work"
-	Pool                  *redis.Pool
-	queuePrefix           string // eg, "myapp-work:jobs:"
-	knownJobs             map[string]int64
-	enqueueUniqueScript   *redis.Script
-	enqueueUniqueInScript *redis.Script
-	mtx                   sync.RWMutex
+	Namespace          string // eg, "myapp-work"
+	Pool               Pool   // nil unless the enqueuer uses the Redis backend
+	backend            Backend
+	redis              *redisBackend // nil unless backend is the Redis one
+	queuePrefix        string        // eg, "myapp-work:jobs:"
+	batchEnqueueScript *redis.Script
+	batchCloseScript   *redis.Script
+	debounceScript     *redis.Script
+	throttleScript     *redis.Script
+	statusTTL          int64 // in seconds, 0 unless the status of jobs is tracked
+	logger             Logger
+}
+
+// EnqueuerOptions can be passed to NewEnqueuerWithOptions.
+type EnqueuerOptions struct {
+	Logger    Logger        // If not set, errors are printed to stdout
+	StatusTTL time.Duration // If set, the status of jobs is tracked for Client.JobStatus, and kept this long after it last changes (needs Redis)
 }
 
 // NewEnqueuer creates a new enqueuer with
 // the specified Redis namespace and Redis pool.
-func NewEnqueuer(namespace string, pool *redis.Pool) *Enqueuer {
-	if pool == nil {
-		panic("NewEnqueuer needs a non-nil *redis.Pool")
-	}
-	return &Enqueuer{
-		Namespace:             namespace,
-		Pool:                  pool,
-		queuePrefix:           redisKeyJobsPrefix(namespace),
-		knownJobs:             make(map[string]int64),
-		enqueueUniqueScript:   redis.NewScript(2, redisLuaEnqueueUnique),
-		enqueueUniqueInScript: redis.NewScript(2, redisLuaEnqueueUniqueIn),
-	}
+func NewEnqueuer(namespace string, pool Pool) *Enqueuer {
+	return NewEnqueuerWithOptions(namespace, pool, EnqueuerOptions{})
 }
 
-func (e *Enqueuer) addToKnownJobs(conn redis.Conn, jobName string) error {
-	needSadd := true
-	now := time.Now().Unix()
-
-	e.mtx.RLock()
-	t, ok := e.knownJobs[jobName]
-	e.mtx.RUnlock()
-
-	if ok {
-		if now < t {
-			needSadd = false
-		}
+// NewEnqueuerWithOptions creates a new enqueuer as per the NewEnqueuer function,
+// but permits you to specify additional options such as a logger.
+func NewEnqueuerWithOptions(namespace string, pool Pool, enqueuerOpts EnqueuerOptions) *Enqueuer {
+	if isNilPool(pool) {
+		panic("NewEnqueuer needs a non-nil Pool")
 	}
+	return newEnqueuer(newRedisBackend(namespace, pool, enqueuerOpts.Logger), enqueuerOpts)
+}
 
-	if needSadd {
-		if _, err := conn.Do("SADD", redisKeyKnownJobs(e.Namespace), jobName); err != nil {
-			return err
-		}
+// NewEnqueuerWithBackend creates a new enqueuer as per NewEnqueuerWithOptions,
+// enqueuing jobs in the specified backend, eg, one returned by NewMemoryBackend.
+// Batches, workflows, and debounced and throttled jobs need Redis, so they return ErrUnsupportedBackend with other backends.
+func NewEnqueuerWithBackend(backend Backend, enqueuerOpts EnqueuerOptions) *Enqueuer {
+	if backend == nil {
+		panic("NewEnqueuerWithBackend needs a non-nil Backend")
+	}
+	return newEnqueuer(backend, enqueuerOpts)
+}
 
-		e.mtx.Lock()
-		e.knownJobs[jobName] = now + 300
-		e.mtx.Unlock()
+func newEnqueuer(backend Backend, enqueuerOpts EnqueuerOptions) *Enqueuer {
+	e := &Enqueuer{
+		backend:            backend,
+		batchEnqueueScript: redis.NewScript(2, redisLuaBatchEnqueue),
+		batchCloseScript:   redis.NewScript(2, redisLuaBatchClose),
+		debounceScript:     redis.NewScript(2, redisLuaEnqueueDebounced),
+		throttleScript:     redis.NewScript(3, redisLuaEnqueueThrottled),
+		logger:             enqueuerOpts.Logger,
 	}
-	return nil
+	if ttl := enqueuerOpts.StatusTTL; ttl > 0 {
+		// Round up, so that a TTL under a second doesn't turn the tracking off
+		e.statusTTL = ceilSeconds(ttl)
+	}
+	if rb, ok := backend.(*redisBackend); ok {
+		e.Namespace = rb.namespace
+		e.Pool = rb.pool
+		e.redis = rb
+		e.queuePrefix = rb.queuePrefix
+	}
+	return e
 }
 
 // Enqueue will enqueue the specified job name and arguments.
@@ -71,65 +83,89 @@ func (e *Enqueuer) Enqueue(jobName string, args map[string]interface{}) (*Job, e
 		ID:         makeIdentifier(),
 		EnqueuedAt: nowEpochSeconds(),
 		Args:       args,
+		StatusTTL:  e.statusTTL,
 	}
 
-	rawJSON, err := job.serialize()
-	if err != nil {
+	if err := e.backend.Enqueue(job); err != nil {
 		return nil, err
 	}
+	return job, nil
+}
 
-	conn := e.Pool.Get()
-	defer conn.Close()
+// EnqueueIn enqueues a job in the scheduled job queue for execution in secondsFromNow seconds.
+func (e *Enqueuer) EnqueueIn(jobName string, secondsFromNow int64, args map[string]interface{}) (*ScheduledJob, error) {
+	return e.enqueueAt(jobName, nowEpochMilliseconds()+secondsFromNow*1000, args)
+}
 
-	if _, err := conn.Do("LPUSH", e.queuePrefix+jobName, rawJSON); err != nil {
-		return nil, err
-	}
+// EnqueueAt enqueues a job in the scheduled job queue for execution at t, to the millisecond.
+func (e *Enqueuer) EnqueueAt(jobName string, t time.Time, args map[string]interface{}) (*ScheduledJob, error) {
+	return e.enqueueAt(jobName, t.UnixMilli(), args)
+}
 
-	err = e.addToKnownJobs(conn, jobName)
-	return job, err
+// EnqueueAfter enqueues a job in the scheduled job queue for execution after d, to the millisecond.
+func (e *Enqueuer) EnqueueAfter(jobName string, d time.Duration, args map[string]interface{}) (*ScheduledJob, error) {
+	return e.enqueueAt(jobName, nowEpochMilliseconds()+ceilMilliseconds(d), args)
 }
 
-// EnqueueIn enqueues a job in the scheduled job queue for execution in secondsFromNow seconds.
-func (e *Enqueuer) EnqueueIn(jobName string, secondsFromNow int64, args map[string]interface{}) (*ScheduledJob, error) {
+// enqueueAt enqueues a job in the scheduled job queue for execution at runAt, in epoch milliseconds.
+func (e *Enqueuer) enqueueAt(jobName string, runAt int64, args map[string]interface{}) (*ScheduledJob, error) {
 	job := &Job{
 		Name:       jobName,
 		ID:         makeIdentifier(),
 		EnqueuedAt: nowEpochSeconds(),
 		Args:       args,
+		StatusTTL:  e.statusTTL,
 	}
 
-	rawJSON, err := job.serialize()
-	if err != nil {
-		return nil, err
-	}
-
-	conn := e.Pool.Get()
-	defer conn.Close()
-
 	scheduledJob := &ScheduledJob{
-		RunAt: nowEpochSeconds() + secondsFromNow,
+		RunAt: runAt / 1000,
 		Job:   job,
 	}
 
-	_, err = conn.Do("ZADD", redisKeyScheduled(e.Namespace), scheduledJob.RunAt, rawJSON)
-	if err != nil {
+	if err := e.backend.Schedule(job, runAt); err != nil {
 		return nil, err
 	}
+	return scheduledJob, nil
+}
+
+// UniqueMode is when a unique job stops keeping jobs with the same name and key from being enqueued.
+type UniqueMode int
+
+const (
+	// UniqueUntilStarted makes a job unique until a worker starts it, as with EnqueueUnique.
+	UniqueUntilStarted UniqueMode = iota
+	// UniqueUntilFinished makes a job unique until it succeeds or dies, so also while it runs and waits to be retried.
+	UniqueUntilFinished
+	// UniqueWhileQueuedOrRetrying makes a job unique while it's queued or scheduled, and again while it waits to be retried,
+	// but not while a worker runs it.
+	UniqueWhileQueuedOrRetrying
+	// UniqueAcrossDead makes a job unique until it succeeds, so also while it's in the dead queue,
+	// until it's deleted from there with Client.DeleteDeadJob or Client.DeleteDeadJobsMatching.
+	UniqueAcrossDead
+)
+
+// defaultUniqueTTLSeconds is how long jobs are unique for at most unless UniqueOptions.TTL is set.
+const defaultUniqueTTLSeconds = 24 * 60 * 60
 
-	err = e.addToKnownJobs(conn, jobName)
-	return scheduledJob, err
+// UniqueOptions can be passed to EnqueueUniqueWithOptions and EnqueueUniqueInWithOptions.
+type UniqueOptions struct {
+	KeyMap map[string]interface{} // If set, jobs are unique on KeyMap rather than on their args, and enqueuing a job again updates its args
+	TTL    time.Duration          // How long jobs are unique for at most, from when a job with the same key was last enqueued. If not set, 24 hours.
+	Mode   UniqueMode             // When jobs stop being unique. If not set, once a worker starts them.
 }
 
-func (e *Enqueuer) uniqueJobHelper(jobName string, args map[string]interface{}, keyMap map[string]interface{}) (enqueueFnType, *Job, error) {
-	useDefaultKeys := false
+// uniqueJob returns a job that's unique as per opts, and whether enqueuing it again replaces its args.
+func (e *Enqueuer) uniqueJob(jobName string, args map[string]interface{}, opts UniqueOptions) (*Job, bool, error) {
+	replaceArgs := true
+	keyMap := opts.KeyMap
 	if keyMap == nil {
-		useDefaultKeys = true
+		replaceArgs = false
 		keyMap = args
 	}
 
 	uniqueKey, err := redisKeyUniqueJob(e.Namespace, jobName, keyMap)
 	if err != nil {
-		return nil, nil, err
+		return nil, false, err
 	}
 
 	job := &Job{
@@ -139,46 +175,13 @@ func (e *Enqueuer) uniqueJobHelper(jobName string, args map[string]interface{},
 		Args:       args,
 		Unique:     true,
 		UniqueKey:  uniqueKey,
+		UniqueMode: opts.Mode,
+		StatusTTL:  e.statusTTL,
 	}
-
-	rawJSON, err := job.serialize()
-	if err != nil {
-		return nil, nil, err
-	}
-
-	enqueueFn := func(runAt *int64) (string, error) {
-		conn := e.Pool.Get()
-		defer conn.Close()
-
-		if err := e.addToKnownJobs(conn, jobName); err != nil {
-			return "", err
-		}
-
-		scriptArgs := []interface{}{}
-		script := e.enqueueUniqueScript
-
-		scriptArgs = append(scriptArgs, e.queuePrefix+jobName) // KEY[1]
-		scriptArgs = append(scriptArgs, uniqueKey)             // KEY[2]
-		scriptArgs = append(scriptArgs, rawJSON)               // ARGV[1]
-		if useDefaultKeys {
-			// keying on arguments so arguments can't be updated
-			// we will just get them off the original job so to save space, make this "1"
-			scriptArgs = append(scriptArgs, "1") // ARGV[2]
-		} else {
-			// we will use this for updated arguments since the job on the queue
-			// doesn't get updated
-			scriptArgs = append(scriptArgs, rawJSON) // ARGV[2]
-		}
-
-		if runAt != nil { // Scheduled job so different job queue with additional arg
-			scriptArgs[0] = redisKeyScheduled(e.Namespace) // KEY[1]
-			scriptArgs = append(scriptArgs, *runAt)        // ARGV[3]
-
-			script = e.enqueueUniqueInScript
-		}
-		return redis.String(script.Do(conn, scriptArgs...))
+	if opts.TTL > 0 {
+		job.UniqueTTL = ceilSeconds(opts.TTL)
 	}
-	return enqueueFn, job, nil
+	return job, replaceArgs, nil
 }
 
 // EnqueueUniqueByKey enqueues a job unless a job is already enqueued with the same name and key, updating arguments.
@@ -191,13 +194,23 @@ func (e *Enqueuer) uniqueJobHelper(jobName string, args map[string]interface{},
 // This is mostly relevant for scheduled jobs.
 // EnqueueUniqueByKey returns the job if it was enqueued and nil if it wasn't
 func (e *Enqueuer) EnqueueUniqueByKey(jobName string, args map[string]interface{}, keyMap map[string]interface{}) (*Job, error) {
-	enqueue, job, err := e.uniqueJobHelper(jobName, args, keyMap)
+	return e.EnqueueUniqueWithOptions(jobName, args, UniqueOptions{KeyMap: keyMap})
+}
+
+// EnqueueUniqueWithOptions enqueues a job as per EnqueueUnique,
+// or EnqueueUniqueByKey if opts.KeyMap is set,
+// but permits you to specify how long and until when the job is unique for.
+// For instance, with UniqueUntilFinished, no job with the same name and key can be enqueued
+// while the job is being retried.
+// EnqueueUniqueWithOptions returns the job if it was enqueued and nil if it wasn't
+func (e *Enqueuer) EnqueueUniqueWithOptions(jobName string, args map[string]interface{}, opts UniqueOptions) (*Job, error) {
+	job, replaceArgs, err := e.uniqueJob(jobName, args, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := enqueue(nil)
-	if res != "ok" || err != nil {
+	ok, err := e.backend.EnqueueUnique(job, 0, replaceArgs)
+	if !ok || err != nil {
 		return nil, err
 	}
 	return job, nil
@@ -210,6 +223,7 @@ func (e *Enqueuer) EnqueueUniqueByKey(jobName string, args map[string]interface{
 // two unique jobs with the same name and arguments can be enqueued at once.
 // In order to add robustness to the system, jobs are only unique for 24 hours after they're enqueued.
 // This is mostly relevant for scheduled jobs.
+// See EnqueueUniqueWithOptions to change either.
 // EnqueueUnique returns the job if it was enqueued and nil if it wasn't
 func (e *Enqueuer) EnqueueUnique(jobName string, args map[string]interface{}) (*Job, error) {
 	return e.EnqueueUniqueByKey(jobName, args, nil)
@@ -224,25 +238,223 @@ func (e *Enqueuer) EnqueueUniqueInByKey(
 	secondsFromNow int64,
 	args map[string]interface{},
 	keyMap map[string]interface{}) (*ScheduledJob, error) {
-	enqueue, job, err := e.uniqueJobHelper(jobName, args, keyMap)
+	return e.EnqueueUniqueInWithOptions(jobName, secondsFromNow, args, UniqueOptions{KeyMap: keyMap})
+}
+
+// EnqueueUniqueInWithOptions enqueues a job in the scheduled job queue for execution in secondsFromNow seconds,
+// unique as per opts. See EnqueueUniqueWithOptions.
+func (e *Enqueuer) EnqueueUniqueInWithOptions(
+	jobName string,
+	secondsFromNow int64,
+	args map[string]interface{},
+	opts UniqueOptions) (*ScheduledJob, error) {
+	return e.enqueueUniqueAt(jobName, nowEpochMilliseconds()+secondsFromNow*1000, args, opts)
+}
+
+// EnqueueUniqueIn enqueues a unique job in the scheduled job queue for execution in secondsFromNow seconds.
+// See EnqueueUnique for the semantics of unique jobs.
+func (e *Enqueuer) EnqueueUniqueIn(jobName string, secondsFromNow int64, args map[string]interface{}) (*ScheduledJob, error) {
+	return e.EnqueueUniqueInByKey(jobName, secondsFromNow, args, nil)
+}
+
+// EnqueueUniqueAt enqueues a unique job in the scheduled job queue for execution at t, to the millisecond.
+// See EnqueueUnique for the semantics of unique jobs.
+func (e *Enqueuer) EnqueueUniqueAt(jobName string, t time.Time, args map[string]interface{}) (*ScheduledJob, error) {
+	return e.enqueueUniqueAt(jobName, t.UnixMilli(), args, UniqueOptions{})
+}
+
+// EnqueueUniqueAfter enqueues a unique job in the scheduled job queue for execution after d, to the millisecond.
+// See EnqueueUnique for the semantics of unique jobs.
+func (e *Enqueuer) EnqueueUniqueAfter(jobName string, d time.Duration, args map[string]interface{}) (*ScheduledJob, error) {
+	return e.enqueueUniqueAt(jobName, nowEpochMilliseconds()+ceilMilliseconds(d), args, UniqueOptions{})
+}
+
+// EnqueueUniqueAtWithOptions enqueues a job in the scheduled job queue for execution at t, to the millisecond,
+// unique as per opts. See EnqueueUniqueWithOptions.
+func (e *Enqueuer) EnqueueUniqueAtWithOptions(
+	jobName string,
+	t time.Time,
+	args map[string]interface{},
+	opts UniqueOptions) (*ScheduledJob, error) {
+	return e.enqueueUniqueAt(jobName, t.UnixMilli(), args, opts)
+}
+
+// enqueueUniqueAt enqueues a job in the scheduled job queue for execution at runAt, in epoch milliseconds,
+// unique as per opts.
+func (e *Enqueuer) enqueueUniqueAt(jobName string, runAt int64, args map[string]interface{}, opts UniqueOptions) (*ScheduledJob, error) {
+	job, replaceArgs, err := e.uniqueJob(jobName, args, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	scheduledJob := &ScheduledJob{
-		RunAt: nowEpochSeconds() + secondsFromNow,
+		RunAt: runAt / 1000,
 		Job:   job,
 	}
 
-	res, err := enqueue(&scheduledJob.RunAt)
-	if res != "ok" || err != nil {
+	ok, err := e.backend.EnqueueUnique(job, runAt, replaceArgs)
+	if !ok || err != nil {
 		return nil, err
 	}
 	return scheduledJob, nil
 }
 
-// EnqueueUniqueIn enqueues a unique job in the scheduled job queue for execution in secondsFromNow seconds.
-// See EnqueueUnique for the semantics of unique jobs.
-func (e *Enqueuer) EnqueueUniqueIn(jobName string, secondsFromNow int64, args map[string]interface{}) (*ScheduledJob, error) {
-	return e.EnqueueUniqueInByKey(jobName, secondsFromNow, args, nil)
+// BatchItem is a job to enqueue with EnqueueBatch or EnqueueInBatch.
+type BatchItem struct {
+	JobName        string
+	Args           map[string]interface{}
+	SecondsFromNow int64 // If > 0, the job is put in the scheduled job queue for execution in SecondsFromNow seconds.
+}
+
+// BatchResult is the outcome of enqueuing a single BatchItem.
+// Job is set even if Err is, so the ID of a job that couldn't be enqueued is still known.
+type BatchResult struct {
+	*Job
+	RunAt int64 // Set if the job was put in the scheduled job queue.
+	Err   error // Set if the job couldn't be enqueued.
+}
+
+// EnqueueBatch enqueues all of items in a single round trip to Redis.
+// Items can have different job names and scheduled times.
+// The returned results are in the same order as items.
+// An item that can't be enqueued has its result's Err set,
+// but doesn't prevent the other items from being enqueued.
+// The error is set if the batch couldn't be written to or read back from Redis,
+// in which case the results of the unfinished items have it as their Err.
+// With backends other than Redis, the items are enqueued one at a time.
+func (e *Enqueuer) EnqueueBatch(items []BatchItem) ([]BatchResult, error) {
+	return e.enqueueBatch(items, false, 0)
+}
+
+// EnqueueInBatch enqueues all of items in the scheduled job queue in a single round trip to Redis,
+// for execution in secondsFromNow seconds plus the SecondsFromNow of each item.
+// See EnqueueBatch for the semantics of the results.
+func (e *Enqueuer) EnqueueInBatch(secondsFromNow int64, items []BatchItem) ([]BatchResult, error) {
+	return e.enqueueBatch(items, true, secondsFromNow)
+}
+
+func (e *Enqueuer) enqueueBatch(items []BatchItem, scheduled bool, secondsFromNow int64) ([]BatchResult, error) {
+	results := make([]BatchResult, len(items))
+	rawJSONs := make([][]byte, len(items))
+	now := nowEpochSeconds()
+	var jobNames []string
+	for i, item := range items {
+		job := &Job{
+			Name:       item.JobName,
+			ID:         makeIdentifier(),
+			EnqueuedAt: now,
+			Args:       item.Args,
+			StatusTTL:  e.statusTTL,
+		}
+		results[i].Job = job
+		if scheduled || item.SecondsFromNow > 0 {
+			results[i].RunAt = now + secondsFromNow + item.SecondsFromNow
+		}
+
+		rawJSON, err := job.serialize()
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		rawJSONs[i] = rawJSON
+		jobNames = append(jobNames, item.JobName)
+	}
+
+	if len(jobNames) == 0 {
+		return results, nil
+	}
+
+	if e.redis == nil {
+		for i, result := range results {
+			if rawJSONs[i] == nil {
+				continue
+			}
+			if result.RunAt != 0 {
+				results[i].Err = e.backend.Schedule(result.Job, result.RunAt*1000)
+			} else {
+				results[i].Err = e.backend.Enqueue(result.Job)
+			}
+		}
+		return results, nil
+	}
+
+	unknownJobs := e.redis.unknownJobs(jobNames)
+
+	conn := e.Pool.Get()
+	defer conn.Close()
+
+	// The statuses are set first so that they can't override the ones set when the jobs are fetched
+	var statusReplies int
+	for i, rawJSON := range rawJSONs {
+		if rawJSON != nil && e.statusTTL > 0 {
+			sendJobStatus(conn, e.Namespace, results[i].Job, JobQueued)
+			statusReplies += 2
+		}
+	}
+
+	for i, rawJSON := range rawJSONs {
+		if rawJSON == nil {
+			continue
+		}
+		if results[i].RunAt != 0 {
+			conn.Send("ZADD", redisKeyScheduled(e.Namespace), results[i].RunAt*1000, rawJSON)
+		} else {
+			conn.Send("LPUSH", e.queuePrefix+items[i].JobName, rawJSON)
+		}
+	}
+
+	if len(unknownJobs) > 0 {
+		conn.Send("SADD", redis.Args{redisKeyKnownJobs(e.Namespace)}.AddFlat(unknownJobs)...)
+	}
+
+	if err := conn.Flush(); err != nil {
+		for i, rawJSON := range rawJSONs {
+			if rawJSON != nil {
+				results[i].Err = err
+			}
+		}
+		return results, err
+	}
+
+	for i := 0; i < statusReplies; i++ {
+		if _, err := conn.Receive(); err != nil {
+			if _, ok := err.(redis.Error); ok {
+				logError(e.logger, "enqueuer.enqueue_batch.job_status", err, "namespace", e.Namespace)
+				continue
+			}
+			for j, rawJSON := range rawJSONs {
+				if rawJSON != nil {
+					results[j].Err = err
+				}
+			}
+			return results, err
+		}
+	}
+
+	for i, rawJSON := range rawJSONs {
+		if rawJSON == nil {
+			continue
+		}
+		if _, err := conn.Receive(); err != nil {
+			results[i].Err = err
+			if _, ok := err.(redis.Error); !ok {
+				// The connection is broken, so nothing more can be read from it.
+				for j := i + 1; j < len(rawJSONs); j++ {
+					if rawJSONs[j] != nil {
+						results[j].Err = err
+					}
+				}
+				return results, err
+			}
+		}
+	}
+
+	if len(unknownJobs) > 0 {
+		if _, err := conn.Receive(); err != nil {
+			logError(e.logger, "enqueuer.add_to_known_jobs", err, "namespace", e.Namespace)
+			return results, err
+		}
+		e.redis.addKnownJobs(unknownJobs)
+	}
+	return results, nil
 }
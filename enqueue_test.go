@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,7 +29,7 @@ func TestEnqueue(t *testing.T) {
 	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(ns)))
 
 	// Make sure the cache is set
-	expiresAt := enqueuer.knownJobs["wat"]
+	expiresAt := enqueuer.redis.knownJobs["wat"]
 	assert.True(t, expiresAt > (time.Now().Unix()+290))
 
 	// Make sure the length of the queue is 1
@@ -58,7 +59,7 @@ func TestEnqueueIn(t *testing.T) {
 	enqueuer := NewEnqueuer(ns, pool)
 
 	// Set to expired value to make sure we update the set of known jobs
-	enqueuer.knownJobs["wat"] = 4
+	enqueuer.redis.knownJobs["wat"] = 4
 
 	job, err := enqueuer.EnqueueIn("wat", 300, Q{"a": 1, "b": "cool"})
 	assert.Nil(t, err)
@@ -77,7 +78,7 @@ func TestEnqueueIn(t *testing.T) {
 	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(ns)))
 
 	// Make sure the cache is set
-	expiresAt := enqueuer.knownJobs["wat"]
+	expiresAt := enqueuer.redis.knownJobs["wat"]
 	assert.True(t, expiresAt > (time.Now().Unix()+290))
 
 	// Make sure the length of the scheduled job queue is 1
@@ -98,6 +99,63 @@ func TestEnqueueIn(t *testing.T) {
 	assert.NoError(t, j.ArgError())
 }
 
+func TestEnqueueAtAndAfter(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	conn := pool.Get()
+	defer conn.Close()
+	score := func(job *Job) int64 {
+		rawJSON, err := job.serialize()
+		assert.NoError(t, err)
+		v, err := redis.Int64(conn.Do("ZSCORE", redisKeyScheduled(ns), rawJSON))
+		assert.NoError(t, err)
+		return v
+	}
+
+	now := nowEpochSeconds()
+	setNowEpochSecondsMock(now)
+	defer resetNowEpochSecondsMock()
+
+	job, err := enqueuer.EnqueueAfter("wat", 1500*time.Millisecond, Q{"a": 1})
+	assert.NoError(t, err)
+	assert.EqualValues(t, now+1, job.RunAt)
+	assert.EqualValues(t, now*1000+1500, score(job.Job))
+
+	at := time.UnixMilli(now*1000 + 90250)
+	job, err = enqueuer.EnqueueAt("wat", at, Q{"a": 2})
+	assert.NoError(t, err)
+	assert.EqualValues(t, now+90, job.RunAt)
+	assert.EqualValues(t, at.UnixMilli(), score(job.Job))
+
+	job, err = enqueuer.EnqueueUniqueAfter("foo", 200*time.Millisecond, nil)
+	assert.NoError(t, err)
+	if assert.NotNil(t, job) {
+		assert.EqualValues(t, now*1000+200, score(job.Job))
+	}
+	job, err = enqueuer.EnqueueUniqueAt("foo", at, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	job, err = enqueuer.EnqueueUniqueAtWithOptions("foo", at, Q{"a": 1}, UniqueOptions{KeyMap: Q{"key": 1}})
+	assert.NoError(t, err)
+	if assert.NotNil(t, job) {
+		assert.EqualValues(t, at.UnixMilli(), score(job.Job))
+	}
+
+	// The jobs are due to the millisecond
+	setNowEpochSecondsMock(now + 1)
+	requeued, _, err := enqueuer.redis.RequeueDue(ScheduledSet, []string{"wat", "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requeued)
+	setNowEpochSecondsMock(now + 2)
+	requeued, _, err = enqueuer.redis.RequeueDue(ScheduledSet, []string{"wat", "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requeued)
+}
+
 func TestEnqueueUnique(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -251,10 +309,24 @@ func TestEnqueueUniqueByKey(t *testing.T) {
 		assert.NoError(t, job.ArgError())
 	}
 
+	first := job
+
 	job, err = enqueuer.EnqueueUniqueByKey("wat", Q{"a": 3, "b": "bar"}, Q{"key": "123"})
 	assert.NoError(t, err)
 	assert.Nil(t, job)
 
+	// The key is still held by the first job, its args being replaced
+	conn := pool.Get()
+	defer conn.Close()
+	uniqueKey, err := redisKeyUniqueJob(ns, "wat", Q{"key": "123"})
+	assert.NoError(t, err)
+	held, err := redis.Bytes(conn.Do("GET", uniqueKey))
+	assert.NoError(t, err)
+	if heldJob, err := newJob(held, nil, nil); assert.NoError(t, err) && assert.NotNil(t, first) {
+		assert.Equal(t, first.ID, heldJob.ID)
+		assert.Equal(t, "bar", heldJob.ArgString("b"))
+	}
+
 	job, err = enqueuer.EnqueueUniqueByKey("wat", Q{"a": 4, "b": "baz"}, Q{"key": "124"})
 	assert.NoError(t, err)
 	assert.NotNil(t, job)
@@ -353,3 +425,178 @@ func TestEnqueueUniqueInByKey(t *testing.T) {
 	assert.NoError(t, j.ArgError())
 	assert.True(t, j.Unique)
 }
+
+func TestEnqueueUniqueWithOptions(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+	backend := enqueuer.redis
+
+	conn := pool.Get()
+	defer conn.Close()
+	exists := func(key string) bool {
+		ok, err := redis.Bool(conn.Do("EXISTS", key))
+		assert.NoError(t, err)
+		return ok
+	}
+
+	// TTL
+	job, err := enqueuer.EnqueueUniqueWithOptions("wat", Q{"a": 1}, UniqueOptions{TTL: 90 * time.Second})
+	assert.NoError(t, err)
+	if assert.NotNil(t, job) {
+		ttl, err := redis.Int64(conn.Do("TTL", job.UniqueKey))
+		assert.NoError(t, err)
+		assert.True(t, ttl > 80 && ttl <= 90, ttl)
+	}
+	scheduledJob, err := enqueuer.EnqueueUniqueInWithOptions("wat", 300, Q{"a": 2}, UniqueOptions{TTL: time.Hour})
+	assert.NoError(t, err)
+	if assert.NotNil(t, scheduledJob) {
+		ttl, err := redis.Int64(conn.Do("TTL", scheduledJob.UniqueKey))
+		assert.NoError(t, err)
+		assert.True(t, ttl > 3500 && ttl <= 3600, ttl)
+	}
+	cleanKeyspace(ns, pool)
+
+	// Until finished: still unique while running and retrying, with the latest args
+	opts := UniqueOptions{KeyMap: Q{"key": "k"}, Mode: UniqueUntilFinished}
+	job, err = enqueuer.EnqueueUniqueWithOptions("wat", Q{"v": 1}, opts)
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+	job, err = enqueuer.EnqueueUniqueWithOptions("wat", Q{"v": 2}, opts)
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	fetched, err := backend.Fetch("1", []string{"wat"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, fetched) {
+		assert.EqualValues(t, 2, fetched.ArgInt64("v"))
+		assert.True(t, exists(fetched.UniqueKey))
+		job, err = enqueuer.EnqueueUniqueWithOptions("wat", Q{"v": 3}, opts)
+		assert.NoError(t, err)
+		assert.Nil(t, job)
+
+		fetched.failed(errors.New("oops"))
+		assert.NoError(t, backend.Retry("1", fetched, nowEpochSeconds()))
+		assert.True(t, exists(fetched.UniqueKey))
+		_, _, err = backend.RequeueDue(RetrySet, []string{"wat"})
+		assert.NoError(t, err)
+
+		fetched, err = backend.Fetch("1", []string{"wat"})
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, fetched.Fails)
+		assert.EqualValues(t, 3, fetched.ArgInt64("v"))
+		assert.NoError(t, backend.Ack("1", fetched))
+		assert.False(t, exists(fetched.UniqueKey))
+	}
+
+	// While queued or retrying: not unique while running
+	opts.Mode = UniqueWhileQueuedOrRetrying
+	job, err = enqueuer.EnqueueUniqueWithOptions("wat", Q{"v": 1}, opts)
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+	fetched, err = backend.Fetch("1", []string{"wat"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, fetched) {
+		assert.False(t, exists(fetched.UniqueKey))
+		fetched.failed(errors.New("oops"))
+		assert.NoError(t, backend.Retry("1", fetched, nowEpochSeconds()+60))
+		assert.True(t, exists(fetched.UniqueKey))
+
+		client := NewClient(ns, pool)
+		assert.NoError(t, client.DeleteRetryJob(nowEpochSeconds()+60, fetched.ID))
+		assert.False(t, exists(fetched.UniqueKey))
+	}
+
+	// Across dead: still unique once dead, until deleted
+	opts.Mode = UniqueAcrossDead
+	job, err = enqueuer.EnqueueUniqueWithOptions("wat", Q{"v": 1}, opts)
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+	fetched, err = backend.Fetch("1", []string{"wat"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, fetched) {
+		assert.NoError(t, backend.Dead("1", fetched, false))
+		job, err = enqueuer.EnqueueUniqueWithOptions("wat", Q{"v": 2}, opts)
+		assert.NoError(t, err)
+		assert.Nil(t, job)
+
+		client := NewClient(ns, pool)
+		deleted, err := client.DeleteDeadJobsMatching(JobFilter{JobName: "wat"})
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		assert.False(t, exists(fetched.UniqueKey))
+	}
+}
+
+func TestEnqueueBatch(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	results, err := enqueuer.EnqueueBatch([]BatchItem{
+		{JobName: "wat", Args: Q{"a": 1}},
+		{JobName: "foo", Args: Q{"b": "cool"}},
+		{JobName: "wat", Args: Q{"a": 2}, SecondsFromNow: 300},
+		{JobName: "bad", Args: Q{"c": make(chan int)}},
+		{JobName: "wat", Args: Q{"a": 3}},
+	})
+	assert.NoError(t, err)
+	if assert.Equal(t, 5, len(results)) {
+		for i, res := range results {
+			assert.Equal(t, i == 3, res.Err != nil)
+			assert.True(t, len(res.ID) > 10)
+		}
+		assert.Equal(t, "wat", results[0].Name)
+		assert.EqualValues(t, 0, results[0].RunAt)
+		assert.EqualValues(t, 1425263409+300, results[2].RunAt)
+	}
+
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "foo")))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "bad")))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(ns)))
+	assert.EqualValues(t, []string{"foo", "wat"}, knownJobs(pool, redisKeyKnownJobs(ns)))
+
+	j := jobOnQueue(pool, redisKeyJobs(ns, "wat"))
+	assert.Equal(t, results[0].ID, j.ID)
+	assert.EqualValues(t, 1, j.ArgInt64("a"))
+
+	score, j := jobOnZset(pool, redisKeyScheduled(ns))
+	assert.EqualValues(t, results[2].RunAt, score)
+	assert.Equal(t, results[2].ID, j.ID)
+
+	results, err = enqueuer.EnqueueBatch(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(results))
+}
+
+func TestEnqueueInBatch(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	results, err := enqueuer.EnqueueInBatch(60, []BatchItem{
+		{JobName: "wat", Args: Q{"a": 1}},
+		{JobName: "foo", SecondsFromNow: 10},
+	})
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(results)) {
+		assert.NoError(t, results[0].Err)
+		assert.NoError(t, results[1].Err)
+		assert.EqualValues(t, 1425263409+60, results[0].RunAt)
+		assert.EqualValues(t, 1425263409+70, results[1].RunAt)
+	}
+
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 2, zsetSize(pool, redisKeyScheduled(ns)))
+	assert.EqualValues(t, []string{"foo", "wat"}, knownJobs(pool, redisKeyKnownJobs(ns)))
+}
@@ -3,10 +3,7 @@ package work
 import (
 	"os"
 	"sort"
-	"strings"
 	"time"
-
-	"github.com/gomodule/redigo/redis"
 )
 
 const beatPeriod = 5 * time.Second
@@ -14,29 +11,37 @@ const beatPeriod = 5 * time.Second
 type workerPoolHeartbeater struct {
 	workerPoolID     string
 	namespace        string // eg, "myapp-work"
-	pool             *redis.Pool
+	backend          Backend
+	logger           Logger
+	jobTypes         map[string]*jobType
+	priorities       *jobPriorities
 	beatPeriod       time.Duration
 	concurrency      uint
-	jobNames         string
+	jobNames         []string
 	startedAt        int64
 	pid              int
 	hostname         string
-	workerIDs        string
+	workerIDs        []string
 	stopChan         chan struct{}
 	doneStoppingChan chan struct{}
 }
 
 func newWorkerPoolHeartbeater(
 	namespace string,
-	pool *redis.Pool,
+	backend Backend,
 	workerPoolID string,
 	jobTypes map[string]*jobType,
 	concurrency uint,
-	workerIDs []string) *workerPoolHeartbeater {
+	workerIDs []string,
+	priorities *jobPriorities,
+	logger Logger) *workerPoolHeartbeater {
 	h := &workerPoolHeartbeater{
 		workerPoolID:     workerPoolID,
 		namespace:        namespace,
-		pool:             pool,
+		backend:          backend,
+		logger:           logger,
+		jobTypes:         jobTypes,
+		priorities:       priorities,
 		beatPeriod:       beatPeriod,
 		concurrency:      concurrency,
 		stopChan:         make(chan struct{}),
@@ -48,15 +53,15 @@ func newWorkerPoolHeartbeater(
 		jobNames = append(jobNames, k)
 	}
 	sort.Strings(jobNames)
-	h.jobNames = strings.Join(jobNames, ",")
+	h.jobNames = jobNames
 
 	sort.Strings(workerIDs)
-	h.workerIDs = strings.Join(workerIDs, ",")
+	h.workerIDs = workerIDs
 
 	h.pid = os.Getpid()
 	host, err := os.Hostname()
 	if err != nil {
-		logError("heartbeat.hostname", err)
+		logError(h.logger, "heartbeat.hostname", err, "namespace", namespace, "worker_pool_id", workerPoolID)
 		host = "hostname_errored"
 	}
 
@@ -65,40 +70,34 @@ func newWorkerPoolHeartbeater(
 }
 
 func (h *workerPoolHeartbeater) heartbeat() {
-	conn := h.pool.Get()
-	defer conn.Close()
-
-	workerPoolsKey := redisKeyWorkerPools(h.namespace)
-	heartbeatKey := redisKeyHeartbeat(h.namespace, h.workerPoolID)
-
-	conn.Send("SADD", workerPoolsKey, h.workerPoolID)
-	conn.Send("HMSET", heartbeatKey,
-		"heartbeat_at", nowEpochSeconds(),
-		"started_at", h.startedAt,
-		"job_names", h.jobNames,
-		"concurrency", h.concurrency,
-		"worker_ids", h.workerIDs,
-		"host", h.hostname,
-		"pid", h.pid,
-	)
+	err := h.backend.Heartbeat(&WorkerPoolHeartbeat{
+		WorkerPoolID: h.workerPoolID,
+		StartedAt:    h.startedAt,
+		HeartbeatAt:  nowEpochSeconds(),
+		JobNames:     h.jobNames,
+		Concurrency:  h.concurrency,
+		Host:         h.hostname,
+		Pid:          h.pid,
+		WorkerIDs:    h.workerIDs,
+	})
+	if err != nil {
+		logError(h.logger, "heartbeat", err, "namespace", h.namespace, "worker_pool_id", h.workerPoolID)
+	}
 
-	if err := conn.Flush(); err != nil {
-		logError("heartbeat", err)
+	// Pick up the overrides set with Client.SetJobConcurrency and Client.SetJobPriority
+	if h.priorities != nil && len(h.jobTypes) > 0 {
+		priorities, err := h.backend.RegisterJobTypes(h.workerPoolID, jobOptions(h.jobTypes))
+		if err != nil {
+			logError(h.logger, "heartbeat.job_controls", err, "namespace", h.namespace, "worker_pool_id", h.workerPoolID)
+			return
+		}
+		h.priorities.set(priorities)
 	}
 }
 
 func (h *workerPoolHeartbeater) removeHeartbeat() {
-	conn := h.pool.Get()
-	defer conn.Close()
-
-	workerPoolsKey := redisKeyWorkerPools(h.namespace)
-	heartbeatKey := redisKeyHeartbeat(h.namespace, h.workerPoolID)
-
-	conn.Send("SREM", workerPoolsKey, h.workerPoolID)
-	conn.Send("DEL", heartbeatKey)
-
-	if err := conn.Flush(); err != nil {
-		logError("remove_heartbeat", err)
+	if err := h.backend.RemoveHeartbeat(h.workerPoolID); err != nil {
+		logError(h.logger, "remove_heartbeat", err, "namespace", h.namespace, "worker_pool_id", h.workerPoolID)
 	}
 }
 
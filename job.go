@@ -1,12 +1,22 @@
 package work
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"reflect"
 )
 
+// ErrJobTimeout is recorded as the error of a job whose handler
+// failed after the JobOptions.Timeout of its job type elapsed.
+var ErrJobTimeout = errors.New("job timed out")
+
+// ErrJobCancelled is recorded as the error of a job whose handler
+// failed after the job was cancelled with Client.CancelJob.
+var ErrJobCancelled = errors.New("job cancelled")
+
 // Q is a shortcut to easily specify arguments for jobs when enqueueing them.
 // Example: e.Enqueue("send_email", work.Q{"addr": "test@example.com", "track": true})
 type Q map[string]interface{}
@@ -19,16 +29,25 @@ type Job struct {
 	Args       map[string]interface{} `json:"args"`
 	Unique     bool                   `json:"unique,omitempty"`
 	UniqueKey  string                 `json:"unique_key,omitempty"`
+	UniqueTTL  int64                  `json:"unique_ttl,omitempty"`  // seconds the job is unique for at most, 24 hours if 0
+	UniqueMode UniqueMode             `json:"unique_mode,omitempty"` // when the job stops being unique
 	EnqueuedAt int64                  `json:"t"`
+	BatchID    string                 `json:"batch_id,omitempty"`
+	Dependents []string               `json:"dependents,omitempty"` // IDs of the jobs waiting for this one to succeed
+	StatusTTL  int64                  `json:"status_ttl,omitempty"` // seconds to keep the status of the job for after it changes, if it's tracked
 	// Inputs when retrying
-	Fails        int64  `json:"fails,omitempty"` // number of times this job has failed
-	LastErr      string `json:"err,omitempty"`
-	FailedAt     int64  `json:"failed_at,omitempty"`
-	rawJSON      []byte
-	argError     error
-	observer     *observer
-	inProgQueue  []byte
-	dequeuedFrom []byte
+	Fails           int64  `json:"fails,omitempty"` // number of times this job has failed
+	LastErr         string `json:"err,omitempty"`
+	FailedAt        int64  `json:"failed_at,omitempty"`
+	FirstEnqueuedAt int64  `json:"first_t,omitempty"` // EnqueuedAt when the job first failed, as EnqueuedAt is reset when it's retried
+	rawJSON         []byte
+	cancelled       bool // set by Fetch if the job was cancelled with Client.CancelJob before it was fetched
+	result          []byte
+	argError        error
+	ctx             context.Context
+	observer        *observer
+	inProgQueue     []byte
+	dequeuedFrom    []byte
 }
 
 func newJob(rawJSON, dequeuedFrom, inProgQueue []byte) (*Job, error) {
@@ -56,11 +75,66 @@ func (j *Job) setArg(key string, val interface{}) {
 }
 
 func (j *Job) failed(err error) {
+	if j.FirstEnqueuedAt == 0 {
+		j.FirstEnqueuedAt = j.EnqueuedAt
+	}
 	j.Fails++
 	j.LastErr = err.Error()
 	j.FailedAt = nowEpochSeconds()
 }
 
+// uniqueTTL returns how many seconds the job is unique for at most.
+func (j *Job) uniqueTTL() int64 {
+	if j.UniqueTTL > 0 {
+		return j.UniqueTTL
+	}
+	return defaultUniqueTTLSeconds
+}
+
+// uniqueWhileRunning reports whether the job keeps its unique key while a worker runs it.
+func (j *Job) uniqueWhileRunning() bool {
+	return j.UniqueMode == UniqueUntilFinished || j.UniqueMode == UniqueAcrossDead
+}
+
+// releasesUniqueKey reports whether the job releases its unique key once it's done,
+// ie, once it succeeded, or died if died is true. Dead jobs which are discarded
+// don't count as being in the dead queue.
+func (j *Job) releasesUniqueKey(died, discarded bool) bool {
+	if !j.Unique || j.UniqueKey == "" {
+		return false
+	}
+	switch j.UniqueMode {
+	case UniqueUntilFinished:
+		return true
+	case UniqueAcrossDead:
+		return !died || discarded
+	}
+	return false
+}
+
+// Context returns the context of the running job.
+// The context is cancelled when the worker pool is stopped
+// or when the Timeout of the job type elapses.
+// Outside of a handler it returns context.Background().
+func (j *Job) Context() context.Context {
+	if j.ctx != nil {
+		return j.ctx
+	}
+	return context.Background()
+}
+
+// SetResult sets the result of the job to v, encoded to JSON.
+// The result is stored along with the status of the job once it succeeds,
+// if it was enqueued with a StatusTTL (see EnqueuerOptions), and can be read with Client.JobStatus.
+func (j *Job) SetResult(v interface{}) error {
+	result, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	j.result = result
+	return nil
+}
+
 // Checkin will update the status of the executing job to the specified messages.
 // This message is visible within the web UI.
 // This is useful for indicating some sort of progress on very long running jobs.
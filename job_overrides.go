@@ -0,0 +1,75 @@
+package work
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// jobPriorities holds the job priorities overridden with Client.SetJobPriority,
+// as last read from Redis. Workers pick them up the next time they fetch a job.
+type jobPriorities struct {
+	mtx        sync.RWMutex
+	priorities map[string]uint // replaced, never modified, so it can be shared with workers
+	version    uint64
+}
+
+func newJobPriorities() *jobPriorities {
+	return &jobPriorities{priorities: map[string]uint{}}
+}
+
+func (p *jobPriorities) get() (map[string]uint, uint64) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return p.priorities, p.version
+}
+
+func (p *jobPriorities) set(priorities map[string]uint) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	changed := len(priorities) != len(p.priorities)
+	for jobName, priority := range priorities {
+		if cur, ok := p.priorities[jobName]; !ok || cur != priority {
+			changed = true
+		}
+	}
+	if changed {
+		p.priorities = priorities
+		p.version++
+	}
+}
+
+// writeJobControls sets the max concurrency of the job types of jobOpts in Redis,
+// unless it was overridden with Client.SetJobConcurrency,
+// and returns the priorities overridden with Client.SetJobPriority.
+func writeJobControls(conn redis.Conn, namespace string, jobOpts map[string]JobOptions) (map[string]uint, error) {
+	jobNames := make([]string, 0, len(jobOpts))
+	keys := make([]interface{}, 0, len(jobOpts)*2)
+	maxConcurrencies := make([]interface{}, 0, len(jobOpts))
+	for jobName, opts := range jobOpts {
+		jobNames = append(jobNames, jobName)
+		keys = append(keys, redisKeyJobsConcurrency(namespace, jobName), redisKeyJobsOverrides(namespace, jobName))
+		maxConcurrencies = append(maxConcurrencies, opts.MaxConcurrency)
+	}
+
+	script := redis.NewScript(len(keys), redisLuaWriteJobControls)
+	overrides, err := redis.Strings(script.Do(conn, append(keys, maxConcurrencies...)...))
+	if err != nil {
+		return nil, err
+	}
+
+	priorities := make(map[string]uint)
+	for i, override := range overrides {
+		if override == "" {
+			continue
+		}
+		priority, err := strconv.ParseUint(override, 10, 0)
+		if err != nil {
+			return nil, err
+		}
+		priorities[jobNames[i]] = uint(priority)
+	}
+	return priorities, nil
+}
@@ -1,7 +1,41 @@
 package work
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
-func logError(key string, err error) {
-	fmt.Printf("ERROR: %s - %s\n", key, err.Error())
+// Logger receives the errors reported by worker pools, enqueuers and clients.
+// The message is a dotted key identifying the call site (eg, "worker.fetch"),
+// followed by alternating key/value pairs that always start with "error"
+// and may include "namespace", "job_name", "job_id" and "worker_pool_id".
+// A *slog.Logger satisfies this interface.
+type Logger interface {
+	Error(msg string, args ...interface{})
+}
+
+// stdoutLogger is the Logger used when none is configured.
+// It prints "ERROR: key - msg" followed by any additional fields.
+type stdoutLogger struct{}
+
+func (stdoutLogger) Error(msg string, args ...interface{}) {
+	var errMsg string
+	var fields strings.Builder
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "error" {
+			errMsg = fmt.Sprint(args[i+1])
+			continue
+		}
+		fmt.Fprintf(&fields, " %v=%v", args[i], args[i+1])
+	}
+	fmt.Printf("ERROR: %s - %s%s\n", msg, errMsg, fields.String())
+}
+
+// logError reports err to logger under key with the given key/value fields.
+// A nil logger reports to stdout.
+func logError(logger Logger, key string, err error, fields ...interface{}) {
+	if logger == nil {
+		logger = stdoutLogger{}
+	}
+	logger.Error(key, append([]interface{}{"error", err}, fields...)...)
 }
@@ -0,0 +1,48 @@
+package work
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogErrorSlog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	logError(logger, "worker.fetch", errors.New("boom"), "namespace", "work", "worker_pool_id", "abc")
+	assert.Equal(t, "level=ERROR msg=worker.fetch error=boom namespace=work worker_pool_id=abc\n", buf.String())
+}
+
+func TestWorkerPoolLogger(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	enqueuer := NewEnqueuer(ns, pool)
+	job, err := enqueuer.Enqueue("wat", nil)
+	assert.NoError(t, err)
+
+	wp := NewWorkerPoolWithOptions(TestContext{}, 1, ns, pool, WorkerPoolOptions{Logger: logger})
+	wp.Job("wat", func(job *Job) error {
+		panic("dayam")
+	})
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Contains(t, buf.String(), "msg=runJob.panic error=dayam job_name=wat job_id="+job.ID)
+}
@@ -0,0 +1,139 @@
+package work
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Metrics receives measurements from a WorkerPool.
+// Implementations must be safe for concurrent use,
+// since every worker of the pool reports to the same Metrics.
+// See the prommetrics package for an implementation
+// that serves the Prometheus text exposition format.
+type Metrics interface {
+	// JobStarted is called when a worker starts running a job.
+	JobStarted(jobName string)
+	// JobSucceeded is called when the handler of a job returns without error.
+	JobSucceeded(jobName string, duration time.Duration)
+	// JobFailed is called when the handler of a job returns an error or panics.
+	JobFailed(jobName string, duration time.Duration)
+	// JobRetried is called when a failed job is put on the retry queue.
+	JobRetried(jobName string)
+	// JobDead is called when a failed job is put on the dead queue.
+	JobDead(jobName string)
+	// Fetched is called after each attempt of a worker to fetch a job.
+	Fetched(duration time.Duration)
+	// QueueSampled reports the number of queued jobs and the latency of a job queue.
+	QueueSampled(jobName string, depth int64, latency time.Duration)
+	// Requeued is called when a job is moved from the retry or scheduled queue to its job queue.
+	Requeued(queue string)
+	// DeadPoolJobRecovered is called when the dead pool reaper re-enqueues an in progress job of a dead worker pool.
+	DeadPoolJobRecovered(jobName string)
+}
+
+// noopMetrics is the Metrics used when none is configured.
+type noopMetrics struct{}
+
+func (noopMetrics) JobStarted(string)                         {}
+func (noopMetrics) JobSucceeded(string, time.Duration)        {}
+func (noopMetrics) JobFailed(string, time.Duration)           {}
+func (noopMetrics) JobRetried(string)                         {}
+func (noopMetrics) JobDead(string)                            {}
+func (noopMetrics) Fetched(time.Duration)                     {}
+func (noopMetrics) QueueSampled(string, int64, time.Duration) {}
+func (noopMetrics) Requeued(string)                           {}
+func (noopMetrics) DeadPoolJobRecovered(string)               {}
+
+const queueSamplePeriod = 5 * time.Second
+
+// queueSampler periodically reports the depth and latency
+// of the job queues of a worker pool to its Metrics.
+type queueSampler struct {
+	namespace        string
+	pool             Pool
+	logger           Logger
+	metrics          Metrics
+	jobNames         []string
+	samplePeriod     time.Duration
+	stopChan         chan struct{}
+	doneStoppingChan chan struct{}
+}
+
+func newQueueSampler(namespace string, pool Pool, jobNames []string, logger Logger, metrics Metrics) *queueSampler {
+	return &queueSampler{
+		namespace:        namespace,
+		pool:             pool,
+		logger:           logger,
+		metrics:          metrics,
+		jobNames:         jobNames,
+		samplePeriod:     queueSamplePeriod,
+		stopChan:         make(chan struct{}),
+		doneStoppingChan: make(chan struct{}),
+	}
+}
+
+func (s *queueSampler) sample() error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	for _, jobName := range s.jobNames {
+		key := redisKeyJobs(s.namespace, jobName)
+		conn.Send("LLEN", key)
+		conn.Send("LINDEX", key, -1)
+	}
+
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+
+	now := nowEpochSeconds()
+	for _, jobName := range s.jobNames {
+		depth, err := redis.Int64(conn.Receive())
+		if err != nil {
+			return err
+		}
+
+		var latency time.Duration
+		rawJSON, err := redis.Bytes(conn.Receive())
+		if err != nil && err != redis.ErrNil {
+			return err
+		}
+
+		if len(rawJSON) > 0 {
+			job, err := newJob(rawJSON, nil, nil)
+			if err != nil {
+				return err
+			}
+			latency = time.Duration(now-job.EnqueuedAt) * time.Second
+		}
+		s.metrics.QueueSampled(jobName, depth, latency)
+	}
+	return nil
+}
+
+func (s *queueSampler) loop() {
+	ticker := time.NewTicker(s.samplePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			s.doneStoppingChan <- struct{}{}
+			return
+		case <-ticker.C:
+			if err := s.sample(); err != nil {
+				logError(s.logger, "queue_sampler.sample", err, "namespace", s.namespace)
+			}
+		}
+	}
+}
+
+func (s *queueSampler) start() {
+	go s.loop()
+}
+
+func (s *queueSampler) stop() {
+	s.stopChan <- struct{}{}
+	<-s.doneStoppingChan
+}
@@ -0,0 +1,104 @@
+package work
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMetrics struct {
+	mtx       sync.Mutex
+	counts    map[string]int
+	depth     map[string]int64
+	fetchSeen bool
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{counts: make(map[string]int), depth: make(map[string]int64)}
+}
+
+func (m *testMetrics) inc(key string) {
+	m.mtx.Lock()
+	m.counts[key]++
+	m.mtx.Unlock()
+}
+
+func (m *testMetrics) count(key string) int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.counts[key]
+}
+
+func (m *testMetrics) JobStarted(jobName string)                    { m.inc("started:" + jobName) }
+func (m *testMetrics) JobSucceeded(jobName string, _ time.Duration) { m.inc("succeeded:" + jobName) }
+func (m *testMetrics) JobFailed(jobName string, _ time.Duration)    { m.inc("failed:" + jobName) }
+func (m *testMetrics) JobRetried(jobName string)                    { m.inc("retried:" + jobName) }
+func (m *testMetrics) JobDead(jobName string)                       { m.inc("dead:" + jobName) }
+func (m *testMetrics) Fetched(time.Duration)                        { m.inc("fetched") }
+func (m *testMetrics) Requeued(queue string)                        { m.inc("requeued:" + queue) }
+func (m *testMetrics) DeadPoolJobRecovered(jobName string)          { m.inc("recovered:" + jobName) }
+func (m *testMetrics) QueueSampled(jobName string, depth int64, _ time.Duration) {
+	m.mtx.Lock()
+	m.depth[jobName] = depth
+	m.mtx.Unlock()
+}
+
+func TestWorkerPoolMetrics(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue("ok", nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue("retry", nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue("dead", nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.EnqueueIn("ok", -1, nil)
+	assert.NoError(t, err)
+
+	metrics := newTestMetrics()
+	wp := NewWorkerPoolWithOptions(TestContext{}, 2, ns, pool, WorkerPoolOptions{Metrics: metrics})
+	wp.Job("ok", func(job *Job) error { return nil })
+	wp.Job("retry", func(job *Job) error { return errors.New("oops") })
+	wp.JobWithOptions("dead", JobOptions{MaxFails: 1}, func(job *Job) error { return errors.New("oops") })
+	wp.Start()
+	wp.scheduler.drain()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Equal(t, 2, metrics.count("started:ok"))
+	assert.Equal(t, 2, metrics.count("succeeded:ok"))
+	assert.Equal(t, 1, metrics.count("failed:retry"))
+	assert.Equal(t, 1, metrics.count("retried:retry"))
+	assert.Equal(t, 1, metrics.count("failed:dead"))
+	assert.Equal(t, 1, metrics.count("dead:dead"))
+	assert.Equal(t, 1, metrics.count("requeued:scheduled"))
+	assert.True(t, metrics.count("fetched") > 0)
+}
+
+func TestQueueSampler(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue("foo", nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue("foo", nil)
+	assert.NoError(t, err)
+
+	setNowEpochSecondsMock(1425263509)
+	metrics := newTestMetrics()
+	s := newQueueSampler(ns, pool, []string{"foo", "bar"}, nil, metrics)
+	assert.NoError(t, s.sample())
+	assert.EqualValues(t, 2, metrics.depth["foo"])
+	assert.EqualValues(t, 0, metrics.depth["bar"])
+}
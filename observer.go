@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"time"
-
-	"github.com/gomodule/redigo/redis"
 )
 
 const (
@@ -36,7 +34,8 @@ type observation struct {
 type observer struct {
 	namespace string
 	workerID  string
-	pool      *redis.Pool
+	backend   Backend
+	logger    Logger
 	// nil: worker isn't doing anything that we know of
 	// not nil: the last started observation that we received on the channel.
 	// if we get an checkin, we'll just update the existing observation
@@ -53,11 +52,12 @@ type observer struct {
 	doneDrainingChan   chan struct{}
 }
 
-func newObserver(namespace string, pool *redis.Pool, workerID string) *observer {
+func newObserver(namespace string, backend Backend, workerID string, logger Logger) *observer {
 	return &observer{
 		namespace:        namespace,
 		workerID:         workerID,
-		pool:             pool,
+		backend:          backend,
+		logger:           logger,
 		observationsChan: make(chan *observation, observerBufferSize),
 		stopChan:         make(chan struct{}),
 		doneStoppingChan: make(chan struct{}),
@@ -77,56 +77,23 @@ func (o *observer) observeCheckin(jobName, jobID, checkin string) {
 }
 
 func (o *observer) writeStatus(obv *observation) error {
-	conn := o.pool.Get()
-	defer conn.Close()
-	key := redisKeyWorkerObservation(o.namespace, o.workerID)
-
-	if obv == nil {
-		if _, err := conn.Do("DEL", key); err != nil {
-			return err
-		}
-	} else {
-		// hash:
-		// job_name -> obv.Name
-		// job_id -> obv.jobID
-		// started_at -> obv.startedAt
-		// args -> json.Encode(obv.arguments)
-		// checkin -> obv.checkin
-		// checkin_at -> obv.checkinAt
-		var argsJSON []byte
-		if len(obv.arguments) == 0 {
-			argsJSON = []byte("")
-		} else {
-			var err error
-			argsJSON, err = json.Marshal(obv.arguments)
+	status := &WorkerObservation{WorkerID: o.workerID}
+	if obv != nil {
+		status.IsBusy = true
+		status.JobName = obv.jobName
+		status.JobID = obv.jobID
+		status.StartedAt = obv.startedAt
+		status.Checkin = obv.checkin
+		status.CheckinAt = obv.checkinAt
+		if len(obv.arguments) > 0 {
+			argsJSON, err := json.Marshal(obv.arguments)
 			if err != nil {
 				return err
 			}
-		}
-
-		args := make([]interface{}, 0, 13)
-		args = append(args,
-			key,
-			"job_name", obv.jobName,
-			"job_id", obv.jobID,
-			"started_at", obv.startedAt,
-			"args", argsJSON,
-		)
-
-		if (obv.checkin != "") && (obv.checkinAt > 0) {
-			args = append(args,
-				"checkin", obv.checkin,
-				"checkin_at", obv.checkinAt,
-			)
-		}
-
-		conn.Send("HMSET", args...)
-		conn.Send("EXPIRE", key, 60*60*24)
-		if err := conn.Flush(); err != nil {
-			return err
+			status.ArgsJSON = string(argsJSON)
 		}
 	}
-	return nil
+	return o.backend.Observe(status)
 }
 
 func (o *observer) process(obv *observation) {
@@ -139,7 +106,7 @@ func (o *observer) process(obv *observation) {
 			o.currentStartedObservation.checkin = obv.checkin
 			o.currentStartedObservation.checkinAt = obv.checkinAt
 		} else {
-			logError("observer.checkin_mismatch", errors.New("got checkin but mismatch on job ID or no job"))
+			logError(o.logger, "observer.checkin_mismatch", errors.New("got checkin but mismatch on job ID or no job"), "namespace", o.namespace, "job_name", obv.jobName, "job_id", obv.jobID)
 		}
 	}
 	o.version++
@@ -147,7 +114,7 @@ func (o *observer) process(obv *observation) {
 	// If this is the version observation we got, just go ahead and write it.
 	if o.version == 1 {
 		if err := o.writeStatus(o.currentStartedObservation); err != nil {
-			logError("observer.first_write", err)
+			logError(o.logger, "observer.first_write", err, "namespace", o.namespace)
 		}
 		o.lastWrittenVersion = o.version
 	}
@@ -172,7 +139,7 @@ func (o *observer) loop() {
 					o.process(obv)
 				default:
 					if err := o.writeStatus(o.currentStartedObservation); err != nil {
-						logError("observer.write", err)
+						logError(o.logger, "observer.write", err, "namespace", o.namespace)
 					}
 					o.doneDrainingChan <- struct{}{}
 					break DRAIN_LOOP
@@ -181,7 +148,7 @@ func (o *observer) loop() {
 		case <-ticker:
 			if o.lastWrittenVersion != o.version {
 				if err := o.writeStatus(o.currentStartedObservation); err != nil {
-					logError("observer.write", err)
+					logError(o.logger, "observer.write", err, "namespace", o.namespace)
 				}
 				o.lastWrittenVersion = o.version
 			}
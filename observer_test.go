@@ -16,7 +16,7 @@ func TestObserverStarted(t *testing.T) {
 	setNowEpochSecondsMock(tMock)
 	defer resetNowEpochSecondsMock()
 
-	observer := newObserver(ns, pool, "abcd")
+	observer := newObserver(ns, newRedisBackend(ns, pool, nil), "abcd", nil)
 	observer.start()
 	observer.observeStarted("foo", "bar", Q{"a": 1, "b": "wat"})
 	observer.drain()
@@ -37,7 +37,7 @@ func TestObserverStartedDone(t *testing.T) {
 	setNowEpochSecondsMock(tMock)
 	defer resetNowEpochSecondsMock()
 
-	observer := newObserver(ns, pool, "abcd")
+	observer := newObserver(ns, newRedisBackend(ns, pool, nil), "abcd", nil)
 	observer.start()
 	observer.observeStarted("foo", "bar", Q{"a": 1, "b": "wat"})
 	observer.observeDone("foo", "bar", nil)
@@ -52,7 +52,7 @@ func TestObserverCheckin(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
 
-	observer := newObserver(ns, pool, "abcd")
+	observer := newObserver(ns, newRedisBackend(ns, pool, nil), "abcd", nil)
 	observer.start()
 
 	tMock := int64(1425263401)
@@ -79,7 +79,7 @@ func TestObserverCheckinFromJob(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
 
-	observer := newObserver(ns, pool, "abcd")
+	observer := newObserver(ns, newRedisBackend(ns, pool, nil), "abcd", nil)
 	observer.start()
 
 	tMock := int64(1425263401)
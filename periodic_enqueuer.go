@@ -1,8 +1,13 @@
 package work
 
 import (
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -14,12 +19,113 @@ const (
 	periodicEnqueuerHorizon = 4 * time.Minute
 )
 
+var periodicSpecParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
 type periodicJob struct {
+	id       string // jobName:spec, or the ID passed to Client.AddPeriodicJob
 	spec     string
 	jobName  string
+	args     map[string]interface{}
+	location *time.Location
+	jitter   time.Duration
+	unique   bool
 	schedule cron.Schedule
 }
 
+func newPeriodicJob(spec, jobName string, opts PeriodicJobOptions) (*periodicJob, error) {
+	schedule, err := periodicSpecParser.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Jitter < 0 {
+		return nil, fmt.Errorf("work: negative jitter for periodic job %s", jobName)
+	}
+
+	return &periodicJob{
+		id:       jobName + ":" + spec,
+		spec:     spec,
+		jobName:  jobName,
+		args:     opts.Args,
+		location: opts.Location,
+		jitter:   opts.Jitter,
+		unique:   opts.Unique,
+		schedule: schedule,
+	}, nil
+}
+
+// isPoolPeriodicID reports whether id has the form jobName:spec of the IDs of the periodic jobs of worker pools.
+func isPoolPeriodicID(id string) bool {
+	for i, r := range id {
+		if r != ':' {
+			continue
+		}
+		if _, err := periodicSpecParser.Parse(id[i+1:]); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the first time of the schedule after t, in the location of the job.
+func (pj *periodicJob) next(t time.Time) time.Time {
+	if pj.location != nil {
+		t = t.In(pj.location)
+	}
+	return pj.schedule.Next(t)
+}
+
+// jitterMilliseconds returns how long after its time the job instance id is run.
+// It's derived from the ID, so that all the worker pools schedule an instance at the same time.
+func (pj *periodicJob) jitterMilliseconds(id string) int64 {
+	ms := pj.jitter.Milliseconds()
+	if ms <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return int64(h.Sum64() % uint64(ms))
+}
+
+// registration returns the PeriodicJob recorded in Redis for the job.
+func (pj *periodicJob) registration() *PeriodicJob {
+	registration := &PeriodicJob{
+		ID:           pj.id,
+		Spec:         pj.spec,
+		JobName:      pj.jobName,
+		Args:         pj.args,
+		Jitter:       pj.jitter,
+		Unique:       pj.unique,
+		RegisteredAt: nowEpochSeconds(),
+	}
+	if pj.location != nil {
+		registration.Location = pj.location.String()
+	}
+	return registration
+}
+
+// periodicJob returns the periodic job to enqueue for the registration.
+func (r *PeriodicJob) periodicJob() (*periodicJob, error) {
+	var opts PeriodicJobOptions
+	if r.Location != "" {
+		loc, err := time.LoadLocation(r.Location)
+		if err != nil {
+			return nil, err
+		}
+		opts.Location = loc
+	}
+	opts.Args = r.Args
+	opts.Jitter = r.Jitter
+	opts.Unique = r.Unique
+
+	pj, err := newPeriodicJob(r.Spec, r.JobName, opts)
+	if err != nil {
+		return nil, err
+	}
+	pj.id = r.ID
+	return pj, nil
+}
+
 type scheduledPeriodicJob struct {
 	scheduledAt      time.Time
 	scheduledAtEpoch int64
@@ -28,17 +134,19 @@ type scheduledPeriodicJob struct {
 
 type periodicEnqueuer struct {
 	namespace             string
-	pool                  *redis.Pool
+	pool                  Pool
+	logger                Logger
 	periodicJobs          []*periodicJob
 	scheduledPeriodicJobs []*scheduledPeriodicJob
 	stopChan              chan struct{}
 	doneStoppingChan      chan struct{}
 }
 
-func newPeriodicEnqueuer(namespace string, pool *redis.Pool, periodicJobs []*periodicJob) *periodicEnqueuer {
+func newPeriodicEnqueuer(namespace string, pool Pool, periodicJobs []*periodicJob, logger Logger) *periodicEnqueuer {
 	return &periodicEnqueuer{
 		namespace:        namespace,
 		pool:             pool,
+		logger:           logger,
 		periodicJobs:     periodicJobs,
 		stopChan:         make(chan struct{}),
 		doneStoppingChan: make(chan struct{}),
@@ -53,13 +161,36 @@ func (pe *periodicEnqueuer) shouldEnqueue() bool {
 	if err == redis.ErrNil {
 		return true
 	} else if err != nil {
-		logError("periodic_enqueuer.should_enqueue", err)
+		logError(pe.logger, "periodic_enqueuer.should_enqueue", err, "namespace", pe.namespace)
 		return true
 	}
 
 	return lastEnqueue < (nowEpochSeconds() - int64(periodicEnqueuerSleep/time.Minute))
 }
 
+// register records the periodic jobs in Redis, so that they're listed by Client.PeriodicJobs.
+func (pe *periodicEnqueuer) register() error {
+	if len(pe.periodicJobs) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, 1+2*len(pe.periodicJobs))
+	args = append(args, redisKeyPeriodicJobs(pe.namespace))
+	for _, pj := range pe.periodicJobs {
+		rawJSON, err := json.Marshal(pj.registration())
+		if err != nil {
+			return err
+		}
+		args = append(args, pj.id, rawJSON)
+	}
+
+	conn := pe.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HSET", args...)
+	return err
+}
+
 func (pe *periodicEnqueuer) enqueue() error {
 	now := nowEpochSeconds()
 	nowTime := time.Unix(now, 0)
@@ -67,36 +198,137 @@ func (pe *periodicEnqueuer) enqueue() error {
 	conn := pe.pool.Get()
 	defer conn.Close()
 
+	// The jobs due since the last enqueue were scheduled by it, as the horizon is longer than the sleep
+	since, err := redis.Int64(conn.Do("GET", redisKeyLastPeriodicEnqueue(pe.namespace)))
+	if err == redis.ErrNil || since > now {
+		since = now
+	} else if err != nil {
+		return err
+	} else if minSince := now - int64(periodicEnqueuerHorizon/time.Second); since < minSince {
+		since = minSince
+	}
+
+	periodicJobs, err := pe.loadPeriodicJobs(conn)
+	if err != nil {
+		return err
+	}
+
+	for _, pj := range periodicJobs {
+		if err := pe.enqueueJob(conn, pj, time.Unix(since, 0), nowTime, horizon); err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("SET", redisKeyLastPeriodicEnqueue(pe.namespace), now)
+	return err
+}
+
+// loadPeriodicJobs returns the periodic jobs of the worker pool and the ones added with Client.AddPeriodicJob,
+// except for the paused ones.
+func (pe *periodicEnqueuer) loadPeriodicJobs(conn redis.Conn) ([]*periodicJob, error) {
+	conn.Send("HGETALL", redisKeyPeriodicJobs(pe.namespace))
+	conn.Send("SMEMBERS", redisKeyPeriodicJobsPaused(pe.namespace))
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	registrations, err := redis.StringMap(conn.Receive())
+	if err != nil {
+		return nil, err
+	}
+	pausedIDs, err := redis.Strings(conn.Receive())
+	if err != nil {
+		return nil, err
+	}
+
+	paused := make(map[string]bool, len(pausedIDs))
+	for _, id := range pausedIDs {
+		paused[id] = true
+	}
+
+	periodicJobs := make([]*periodicJob, 0, len(pe.periodicJobs)+len(registrations))
 	for _, pj := range pe.periodicJobs {
-		for t := pj.schedule.Next(nowTime); t.Before(horizon); t = pj.schedule.Next(t) {
-			epoch := t.Unix()
-			id := makeUniquePeriodicID(pj.jobName, pj.spec, epoch)
-
-			job := &Job{
-				Name: pj.jobName,
-				ID:   id,
-
-				// This is technically wrong, but this lets the bytes be identical for the same periodic job instance.
-				// If we don't do this,
-				// we'd need to use a different approach -- probably giving each periodic job
-				// its own history of the past 100 periodic jobs, and only scheduling a job if it's not in the history.
-				EnqueuedAt: epoch,
-				Args:       nil,
-			}
+		if !paused[pj.id] {
+			periodicJobs = append(periodicJobs, pj)
+		}
+	}
 
-			rawJSON, err := job.serialize()
-			if err != nil {
-				return err
-			}
+	ids := make([]string, 0, len(registrations))
+	for id := range registrations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		var registration PeriodicJob
+		if err := json.Unmarshal([]byte(registrations[id]), &registration); err != nil {
+			logError(pe.logger, "periodic_enqueuer.load.unmarshal", err, "namespace", pe.namespace, "periodic_job_id", id)
+			continue
+		}
+		if !registration.Dynamic || paused[id] {
+			continue
+		}
 
-			_, err = conn.Do("ZADD", redisKeyScheduled(pe.namespace), epoch, rawJSON)
+		registration.ID = id
+		pj, err := registration.periodicJob()
+		if err != nil {
+			logError(pe.logger, "periodic_enqueuer.load.periodic_job", err, "namespace", pe.namespace, "periodic_job_id", id)
+			continue
+		}
+		periodicJobs = append(periodicJobs, pj)
+	}
+	return periodicJobs, nil
+}
+
+// enqueueJob schedules the instances of pj due before horizon,
+// and records the last one due since the previous enqueue as its last enqueued run.
+func (pe *periodicEnqueuer) enqueueJob(conn redis.Conn, pj *periodicJob, since, nowTime, horizon time.Time) error {
+	var lastEnqueuedAt int64
+	t := pj.next(since)
+	for ; !t.IsZero() && !t.After(nowTime); t = pj.schedule.Next(t) {
+		lastEnqueuedAt = t.Unix()
+	}
+
+	for ; !t.IsZero() && t.Before(horizon); t = pj.schedule.Next(t) {
+		epoch := t.Unix()
+		id := makeUniquePeriodicID(pj.id, epoch)
+
+		job := &Job{
+			Name: pj.jobName,
+			ID:   id,
+
+			// This is technically wrong, but this lets the bytes be identical for the same periodic job instance.
+			// If we don't do this,
+			// we'd need to use a different approach -- probably giving each periodic job
+			// its own history of the past 100 periodic jobs, and only scheduling a job if it's not in the history.
+			EnqueuedAt: epoch,
+			Args:       pj.args,
+		}
+		runAt := t.UnixMilli() + pj.jitterMilliseconds(id)
+
+		if pj.unique {
+			// The unique key is only taken once the job is due, as per redisLuaZremLpushCmd
+			uniqueKey, err := redisKeyUniqueJob(pe.namespace, pj.jobName, nil)
 			if err != nil {
 				return err
 			}
+			job.Unique = true
+			job.UniqueKey = uniqueKey
+		}
+
+		rawJSON, err := job.serialize()
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.Do("ZADD", redisKeyScheduled(pe.namespace), runAt, rawJSON)
+		if err != nil {
+			return err
 		}
 	}
 
-	_, err := conn.Do("SET", redisKeyLastPeriodicEnqueue(pe.namespace), now)
+	if lastEnqueuedAt == 0 {
+		return nil
+	}
+	_, err := conn.Do("HSET", redisKeyPeriodicJobsLastEnqueued(pe.namespace), pj.id, lastEnqueuedAt)
 	return err
 }
 
@@ -105,10 +337,14 @@ func (pe *periodicEnqueuer) loop() {
 	timer := time.NewTimer(periodicEnqueuerSleep + time.Duration(rand.Intn(30))*time.Second)
 	defer timer.Stop()
 
+	if err := pe.register(); err != nil {
+		logError(pe.logger, "periodic_enqueuer.loop.register", err, "namespace", pe.namespace)
+	}
+
 	if pe.shouldEnqueue() {
 		err := pe.enqueue()
 		if err != nil {
-			logError("periodic_enqueuer.loop.enqueue", err)
+			logError(pe.logger, "periodic_enqueuer.loop.enqueue", err, "namespace", pe.namespace)
 		}
 	}
 
@@ -122,7 +358,7 @@ func (pe *periodicEnqueuer) loop() {
 			if pe.shouldEnqueue() {
 				err := pe.enqueue()
 				if err != nil {
-					logError("periodic_enqueuer.loop.enqueue", err)
+					logError(pe.logger, "periodic_enqueuer.loop.enqueue", err, "namespace", pe.namespace)
 				}
 			}
 		}
@@ -138,6 +374,18 @@ func (pe *periodicEnqueuer) stop() {
 	<-pe.doneStoppingChan
 }
 
-func makeUniquePeriodicID(name, spec string, epoch int64) string {
-	return fmt.Sprintf("periodic:%s:%s:%d", name, spec, epoch)
+// isPeriodicInstanceID reports whether jobID is the ID of an instance of the periodic job periodicID,
+// as returned by makeUniquePeriodicID.
+func isPeriodicInstanceID(jobID, periodicID string) bool {
+	prefix := "periodic:" + periodicID + ":"
+	if !strings.HasPrefix(jobID, prefix) {
+		return false
+	}
+	_, err := strconv.ParseInt(jobID[len(prefix):], 10, 64)
+	return err == nil
+}
+
+// makeUniquePeriodicID returns the ID of the instance at epoch of the periodic job periodicID.
+func makeUniquePeriodicID(periodicID string, epoch int64) string {
+	return fmt.Sprintf("periodic:%s:%d", periodicID, epoch)
 }
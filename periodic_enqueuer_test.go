@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/gomodule/redigo/redis"
-	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,7 +13,7 @@ func TestPeriodicEnqueuerSpawn(t *testing.T) {
 	ns := "work"
 	cleanKeyspace(ns, pool)
 
-	pe := newPeriodicEnqueuer(ns, pool, nil)
+	pe := newPeriodicEnqueuer(ns, pool, nil, nil)
 	pe.start()
 	pe.stop()
 }
@@ -32,7 +31,7 @@ func TestPeriodicEnqueuer(t *testing.T) {
 	setNowEpochSecondsMock(1468359453)
 	defer resetNowEpochSecondsMock()
 
-	pe := newPeriodicEnqueuer(ns, pool, pjs)
+	pe := newPeriodicEnqueuer(ns, pool, pjs, nil)
 	err := pe.enqueue()
 	assert.NoError(t, err)
 
@@ -107,14 +106,143 @@ func TestPeriodicEnqueuer(t *testing.T) {
 	assert.True(t, pe.shouldEnqueue())
 }
 
+func TestPeriodicEnqueuerWithOptions(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	assert.NoError(t, err)
+
+	var pjs []*periodicJob
+	pjs = appendPeriodicJobWithOptions(pjs, "0/29 * * * * *", "args", PeriodicJobOptions{Args: Q{"a": 1}})
+	pjs = appendPeriodicJobWithOptions(pjs, "0 8 3 * * *", "location", PeriodicJobOptions{Location: kolkata}) // 03:08 in Kolkata is 21:38 in UTC
+	pjs = appendPeriodicJobWithOptions(pjs, "0/29 * * * * *", "jitter", PeriodicJobOptions{Jitter: 10 * time.Second})
+	pjs = appendPeriodicJobWithOptions(pjs, "0/29 * * * * *", "unique", PeriodicJobOptions{Unique: true})
+
+	setNowEpochSecondsMock(1468359453) // 2016-07-12 21:37:33 UTC
+	defer resetNowEpochSecondsMock()
+
+	pe := newPeriodicEnqueuer(ns, pool, pjs, nil)
+	assert.NoError(t, pe.enqueue())
+
+	c := NewClient(ns, pool)
+	byName := func() map[string][]*ScheduledJob {
+		jobs := map[string][]*ScheduledJob{}
+		for _, name := range []string{"args", "location", "jitter", "unique"} {
+			scheduledJobs, err := c.ScheduledJobsMatching(JobFilter{JobName: name}, 1)
+			assert.NoError(t, err)
+			jobs[name] = scheduledJobs
+		}
+		return jobs
+	}
+	jobs := byName()
+
+	if assert.Len(t, jobs["args"], 12) {
+		assert.EqualValues(t, 1, jobs["args"][0].ArgInt64("a"))
+	}
+
+	if assert.Len(t, jobs["location"], 1) {
+		assert.EqualValues(t, 1468359480, jobs["location"][0].RunAt)
+		assert.Equal(t, "periodic:location:0 8 3 * * *:1468359480", jobs["location"][0].ID)
+	}
+
+	assert.Len(t, jobs["jitter"], 12)
+	conn := pool.Get()
+	defer conn.Close()
+	scores := map[string]int64{}
+	for _, j := range jobs["jitter"] {
+		score, err := redis.Int64(conn.Do("ZSCORE", redisKeyScheduled(ns), j.rawJSON))
+		assert.NoError(t, err)
+		assert.True(t, score >= j.EnqueuedAt*1000 && score < j.EnqueuedAt*1000+10000, "score %d out of the jitter of %d", score, j.EnqueuedAt)
+		scores[j.ID] = score
+	}
+
+	// The unique jobs are all scheduled, and only take the unique key of their name once due
+	if assert.Len(t, jobs["unique"], 12) {
+		assert.EqualValues(t, 1468359478, jobs["unique"][0].RunAt)
+		assert.True(t, jobs["unique"][0].Unique)
+	}
+	uniqueKey, err := redisKeyUniqueJob(ns, "unique", nil)
+	assert.NoError(t, err)
+	exists, err := redis.Bool(conn.Do("EXISTS", uniqueKey))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// Enqueuing again doesn't move the jobs around nor add any
+	setNowEpochSecondsMock(1468359454)
+	assert.NoError(t, pe.enqueue())
+	jobs = byName()
+	assert.Len(t, jobs["args"], 12)
+	assert.Len(t, jobs["unique"], 12)
+	for _, j := range jobs["jitter"] {
+		score, err := redis.Int64(conn.Do("ZSCORE", redisKeyScheduled(ns), j.rawJSON))
+		assert.NoError(t, err)
+		assert.Equal(t, scores[j.ID], score)
+	}
+
+	// A unique job due while another one is waiting to start is dropped, but the ones due after it started aren't
+	backend := newRedisBackend(ns, pool, nil)
+	requeueUnique := func(now int64) {
+		setNowEpochSecondsMock(now)
+		_, _, err := backend.RequeueDue(ScheduledSet, []string{"unique"})
+		assert.NoError(t, err)
+	}
+	requeueUnique(1468359478)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "unique")))
+	requeueUnique(1468359480)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "unique")))
+	_, err = conn.Do("DEL", uniqueKey)
+	assert.NoError(t, err)
+	requeueUnique(1468359509)
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(ns, "unique")))
+	jobs = byName()
+	assert.Len(t, jobs["unique"], 9)
+
+	// Once run, the unique jobs are no longer in progress and release their unique key
+	var ran int
+	jobTypes := map[string]*jobType{
+		"unique": {
+			Name:           "unique",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 1},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { ran++; return nil },
+		},
+	}
+	w := newWorker(ns, "1", backend, tstCtxType, nil, jobTypes, nil, nil, nil)
+	w.start()
+	w.drain()
+	w.stop()
+	assert.Equal(t, 2, ran)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "unique")))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", "unique")))
+	exists, err = redis.Bool(conn.Do("EXISTS", uniqueKey))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestPeriodicallyEnqueueWithOptionsBadSpec(t *testing.T) {
+	pool := newTestPool(":6379")
+	wp := NewWorkerPool(TestContext{}, 10, "work", pool)
+
+	assert.Error(t, wp.PeriodicallyEnqueueWithOptions("bad spec", "foo", PeriodicJobOptions{}))
+	assert.Error(t, wp.PeriodicallyEnqueueWithOptions("* * * * * *", "foo", PeriodicJobOptions{Jitter: -time.Second}))
+	assert.Empty(t, wp.periodicJobs)
+
+	assert.NoError(t, wp.PeriodicallyEnqueueWithOptions("* * * * * *", "foo", PeriodicJobOptions{}))
+	assert.Len(t, wp.periodicJobs, 1)
+	assert.Panics(t, func() { wp.PeriodicallyEnqueue("bad spec", "foo") })
+}
+
 func appendPeriodicJob(pjs []*periodicJob, spec, jobName string) []*periodicJob {
-	p := cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	return appendPeriodicJobWithOptions(pjs, spec, jobName, PeriodicJobOptions{})
+}
 
-	sched, err := p.Parse(spec)
+func appendPeriodicJobWithOptions(pjs []*periodicJob, spec, jobName string, opts PeriodicJobOptions) []*periodicJob {
+	pj, err := newPeriodicJob(spec, jobName, opts)
 	if err != nil {
 		panic(err)
 	}
 
-	pj := &periodicJob{jobName: jobName, spec: spec, schedule: sched}
 	return append(pjs, pj)
 }
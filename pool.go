@@ -0,0 +1,265 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Pool provides the connections to Redis that jobs are stored with.
+// A redigo *redis.Pool is a Pool, and NewGoRedisPool adapts a go-redis client into one.
+type Pool interface {
+	Get() redis.Conn
+}
+
+// isNilPool reports whether pool is nil, including when it's a nil *redis.Pool.
+func isNilPool(pool Pool) bool {
+	p, ok := pool.(*redis.Pool)
+	return pool == nil || (ok && p == nil)
+}
+
+// NewGoRedisPool returns a Pool running commands with a go-redis client,
+// eg, a *redis.ClusterClient or a Sentinel-backed *redis.Client.
+// With Redis Cluster, use a namespace returned by ClusterNamespace.
+// The connections it returns are lightweight handles on the client, which manages the actual connections.
+// Commands sent between MULTI and EXEC are run in a go-redis transaction pipeline,
+// and replies are converted to the types returned by redigo, including with RESP3.
+func NewGoRedisPool(client goredis.UniversalClient) Pool {
+	if client == nil {
+		panic("NewGoRedisPool needs a non-nil go-redis client")
+	}
+	return &goRedisPool{client: client}
+}
+
+type goRedisPool struct {
+	client goredis.UniversalClient
+}
+
+func (p *goRedisPool) Get() redis.Conn {
+	return &goRedisConn{client: p.client}
+}
+
+// goRedisReply is the reply to a command run by a goRedisConn, as converted by goRedisValue.
+type goRedisReply struct {
+	value interface{}
+	err   error
+}
+
+// goRedisConn implements redis.Conn on top of a go-redis client.
+// Commands sent with Send are run when the connection is flushed,
+// and their replies are queued until they're received.
+type goRedisConn struct {
+	client  goredis.UniversalClient
+	pending [][]interface{} // sent but not flushed yet
+	multi   bool            // set between MULTI and EXEC
+	tx      [][]interface{} // the commands queued since MULTI
+	replies []goRedisReply  // flushed but not received yet
+	closed  bool
+}
+
+var errGoRedisConnClosed = errors.New("work: connection closed")
+
+func (c *goRedisConn) Close() error {
+	c.pending, c.tx, c.replies = nil, nil, nil
+	c.multi = false
+	c.closed = true
+	return nil
+}
+
+func (c *goRedisConn) Err() error {
+	if c.closed {
+		return errGoRedisConnClosed
+	}
+	return nil
+}
+
+func (c *goRedisConn) Send(commandName string, args ...interface{}) error {
+	if c.closed {
+		return errGoRedisConnClosed
+	}
+	c.pending = append(c.pending, append([]interface{}{commandName}, args...))
+	return nil
+}
+
+func (c *goRedisConn) Flush() error {
+	if c.closed {
+		return errGoRedisConnClosed
+	}
+
+	ctx := context.Background()
+	var pipe goredis.Pipeliner
+	var cmds []*goredis.Cmd
+	// runPipe runs the commands sent before a transaction is started or run, in a single round trip
+	runPipe := func() {
+		if pipe == nil {
+			return
+		}
+		pipe.Exec(ctx)
+		for _, cmd := range cmds {
+			c.replies = append(c.replies, goRedisCmdReply(cmd))
+		}
+		pipe, cmds = nil, nil
+	}
+
+	for _, args := range c.pending {
+		switch cmdName := args[0].(string); {
+		case cmdName == "MULTI":
+			runPipe()
+			c.multi = true
+			c.tx = nil
+			c.replies = append(c.replies, goRedisReply{value: "OK"})
+		case cmdName == "DISCARD" && c.multi:
+			c.multi = false
+			c.tx = nil
+			c.replies = append(c.replies, goRedisReply{value: "OK"})
+		case cmdName == "EXEC" && c.multi:
+			runPipe()
+			c.replies = append(c.replies, c.exec(ctx))
+		case c.multi:
+			c.tx = append(c.tx, args)
+			c.replies = append(c.replies, goRedisReply{value: "QUEUED"})
+		default:
+			if pipe == nil {
+				pipe = c.client.Pipeline()
+			}
+			cmds = append(cmds, pipe.Do(ctx, args...))
+		}
+	}
+	runPipe()
+	c.pending = nil
+	return nil
+}
+
+// exec runs the commands queued since MULTI in a transaction, and returns the reply to EXEC.
+func (c *goRedisConn) exec(ctx context.Context) goRedisReply {
+	tx := c.tx
+	c.multi = false
+	c.tx = nil
+
+	pipe := c.client.TxPipeline()
+	cmds := make([]*goredis.Cmd, len(tx))
+	for i, args := range tx {
+		cmds[i] = pipe.Do(ctx, args...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !isGoRedisReplyError(err) {
+		return goRedisReply{err: err}
+	}
+
+	values := make([]interface{}, len(cmds))
+	for i, cmd := range cmds {
+		reply := goRedisCmdReply(cmd)
+		if reply.err != nil {
+			values[i] = reply.err
+		} else {
+			values[i] = reply.value
+		}
+	}
+	return goRedisReply{value: values}
+}
+
+func (c *goRedisConn) Receive() (interface{}, error) {
+	if len(c.replies) == 0 && len(c.pending) > 0 {
+		if err := c.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.replies) == 0 {
+		return nil, errors.New("work: no reply to receive")
+	}
+
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+	return reply.value, reply.err
+}
+
+// Do runs the command along with the pending ones, and returns the reply to the command.
+// As with redigo, it returns all of the pending replies if commandName is empty.
+func (c *goRedisConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if commandName != "" {
+		if err := c.Send(commandName, args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := c.replies
+	c.replies = nil
+	if commandName == "" {
+		values := make([]interface{}, len(replies))
+		for i, reply := range replies {
+			if _, ok := reply.err.(redis.Error); ok {
+				values[i] = reply.err
+			} else if reply.err != nil {
+				return nil, reply.err
+			} else {
+				values[i] = reply.value
+			}
+		}
+		return values, nil
+	}
+	if len(replies) == 0 {
+		return nil, errors.New("work: no reply to receive")
+	}
+	reply := replies[len(replies)-1]
+	return reply.value, reply.err
+}
+
+// goRedisCmdReply converts the outcome of cmd to what redigo would have returned.
+func goRedisCmdReply(cmd *goredis.Cmd) goRedisReply {
+	value, err := cmd.Result()
+	if err == goredis.Nil {
+		return goRedisReply{}
+	} else if isGoRedisReplyError(err) {
+		return goRedisReply{err: redis.Error(err.Error())}
+	} else if err != nil {
+		return goRedisReply{err: err}
+	}
+	return goRedisReply{value: goRedisValue(value)}
+}
+
+func isGoRedisReplyError(err error) bool {
+	var replyErr goredis.Error
+	return errors.As(err, &replyErr) && err != goredis.Nil
+}
+
+// goRedisValue converts a value returned by go-redis to the type redigo returns for it in RESP2:
+// strings are []byte, and the maps, doubles and booleans of RESP3 are flattened,
+// formatted and turned into integers respectively.
+func goRedisValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return []byte(v)
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case []interface{}:
+		values := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			// With RESP3, WITHSCORES returns [member, score] pairs instead of a flat array
+			if pair, ok := elem.([]interface{}); ok && len(pair) == 2 {
+				if _, ok := pair[1].(float64); ok {
+					values = append(values, goRedisValue(pair[0]), goRedisValue(pair[1]))
+					continue
+				}
+			}
+			values = append(values, goRedisValue(elem))
+		}
+		return values
+	case map[interface{}]interface{}:
+		values := make([]interface{}, 0, len(v)*2)
+		for key, elem := range v {
+			values = append(values, goRedisValue(key), goRedisValue(elem))
+		}
+		return values
+	}
+	return value
+}
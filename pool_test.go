@@ -0,0 +1,133 @@
+package work
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoRedisPool(t *testing.T) {
+	for _, protocol := range []int{2, 3} {
+		t.Run(fmt.Sprint("RESP", protocol), func(t *testing.T) {
+			pool := newTestPool(":6379")
+			ns := ClusterNamespace("work")
+			cleanKeyspace(ns, pool)
+			client := goredis.NewClient(&goredis.Options{Addr: ":6379", Protocol: protocol})
+			defer client.Close()
+			goPool := NewGoRedisPool(client)
+
+			enqueuer := NewEnqueuer(ns, goPool)
+			_, err := enqueuer.Enqueue("wat", Q{"a": 1})
+			assert.NoError(t, err)
+			job, err := enqueuer.EnqueueUnique("wat", Q{"a": 2})
+			assert.NoError(t, err)
+			assert.NotNil(t, job)
+			job, err = enqueuer.EnqueueUnique("wat", Q{"a": 2})
+			assert.NoError(t, err)
+			assert.Nil(t, job)
+			_, err = enqueuer.Enqueue("broken", nil)
+			assert.NoError(t, err)
+			_, err = enqueuer.EnqueueBatch([]BatchItem{{JobName: "wat", Args: Q{"a": 3}}})
+			assert.NoError(t, err)
+
+			var mtx sync.Mutex
+			var handled []int64
+			wp := NewWorkerPool(TestContext{}, 2, ns, goPool)
+			wp.Job("wat", func(job *Job) error {
+				mtx.Lock()
+				handled = append(handled, job.ArgInt64("a"))
+				mtx.Unlock()
+				return nil
+			})
+			wp.JobWithOptions("broken", JobOptions{MaxFails: 1}, func(job *Job) error {
+				return fmt.Errorf("ohno")
+			})
+			wp.Start()
+			wp.Drain()
+			wp.Stop()
+			assert.ElementsMatch(t, []int64{1, 2, 3}, handled)
+
+			c := NewClient(ns, goPool)
+			queues, err := c.Queues()
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(queues))
+			deadJobs, count, err := c.DeadJobs(1)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, count)
+			if assert.Equal(t, 1, len(deadJobs)) {
+				assert.Equal(t, "broken", deadJobs[0].Name)
+				assert.Equal(t, "ohno", deadJobs[0].LastErr)
+				assert.NoError(t, c.RetryDeadJob(deadJobs[0].DiedAt, deadJobs[0].ID))
+			}
+			assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "broken")))
+
+			// All of the keys share a hash tag, so they're in the same Redis Cluster slot
+			conn := pool.Get()
+			defer conn.Close()
+			keys, err := redis.Strings(conn.Do("KEYS", "*work*"))
+			assert.NoError(t, err)
+			assert.NotEmpty(t, keys)
+			for _, key := range keys {
+				if strings.Contains(key, "{work}") {
+					assert.True(t, strings.HasPrefix(key, "{work}:"), key)
+				}
+			}
+		})
+	}
+}
+
+func TestGoRedisConn(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	client := goredis.NewClient(&goredis.Options{Addr: ":6379"})
+	defer client.Close()
+	conn := NewGoRedisPool(client).Get()
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("GET", "work:nope"))
+	assert.Equal(t, redis.ErrNil, err)
+
+	// Pipelines
+	assert.NoError(t, conn.Send("SET", "work:a", 1))
+	assert.NoError(t, conn.Send("INCR", "work:a"))
+	assert.NoError(t, conn.Send("LPUSH", "work:a", "x"))
+	assert.NoError(t, conn.Flush())
+	ok, err := redis.String(conn.Receive())
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", ok)
+	n, err := redis.Int64(conn.Receive())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+	_, err = conn.Receive()
+	assert.IsType(t, redis.Error(""), err)
+
+	// Transactions
+	conn.Send("MULTI")
+	conn.Send("INCR", "work:a")
+	conn.Send("HSET", "work:h", "f", "v")
+	values, err := redis.Values(conn.Do("EXEC"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(3), int64(1)}, values)
+
+	conn.Send("MULTI")
+	conn.Send("INCR", "work:a")
+	_, err = conn.Do("DISCARD")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, getInt64(pool, "work:a"))
+
+	h, err := redis.StringMap(conn.Do("HGETALL", "work:h"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"f": "v"}, h)
+
+	// Scripts are loaded on first use
+	script := redis.NewScript(1, `return redis.call('get', KEYS[1])`)
+	v, err := redis.Int64(script.Do(conn, "work:a"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, v)
+}
@@ -5,12 +5,7 @@ import "math/rand"
 type sampleItem struct {
 	priority uint
 	// payload:
-	redisJobs               string
-	redisJobsInProg         string
-	redisJobsPaused         string
-	redisJobsLock           string
-	redisJobsLockInfo       string
-	redisJobsMaxConcurrency string
+	jobName string
 }
 
 type prioritySampler struct {
@@ -18,24 +13,8 @@ type prioritySampler struct {
 	samples []sampleItem
 }
 
-func (s *prioritySampler) add(
-	priority uint,
-	redisJobs,
-	redisJobsInProg,
-	redisJobsPaused,
-	redisJobsLock,
-	redisJobsLockInfo,
-	redisJobsMaxConcurrency string) {
-	sample := sampleItem{
-		priority:                priority,
-		redisJobs:               redisJobs,
-		redisJobsInProg:         redisJobsInProg,
-		redisJobsPaused:         redisJobsPaused,
-		redisJobsLock:           redisJobsLock,
-		redisJobsLockInfo:       redisJobsLockInfo,
-		redisJobsMaxConcurrency: redisJobsMaxConcurrency,
-	}
-	s.samples = append(s.samples, sample)
+func (s *prioritySampler) add(priority uint, jobName string) {
+	s.samples = append(s.samples, sampleItem{priority: priority, jobName: jobName})
 	s.sum += priority
 }
 
@@ -0,0 +1,283 @@
+// Package prommetrics implements work.Metrics and serves the collected metrics
+// in the Prometheus text exposition format,
+// without depending on the Prometheus client libraries.
+//
+// Example:
+//
+//	m := prommetrics.New()
+//	wp := work.NewWorkerPoolWithOptions(ctx, 10, "myapp-work", pool, work.WorkerPoolOptions{Metrics: m})
+//	http.Handle("/metrics", m.Handler())
+package prommetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pchchv/work"
+)
+
+// DefaultBuckets are the upper bounds (in seconds) of the histogram buckets used by New.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var _ work.Metrics = (*Metrics)(nil)
+
+// Metrics collects the measurements of one or more worker pools.
+type Metrics struct {
+	mtx          sync.Mutex
+	buckets      []float64
+	started      map[string]float64
+	succeeded    map[string]float64
+	failed       map[string]float64
+	retried      map[string]float64
+	dead         map[string]float64
+	requeued     map[string]float64
+	recovered    map[string]float64
+	queueDepth   map[string]float64
+	queueLatency map[string]float64
+	jobDuration  map[string]*histogram
+	fetch        *histogram
+}
+
+type histogram struct {
+	counts []uint64 // cumulative count per bucket
+	count  uint64
+	sum    float64
+}
+
+type metricFamily struct {
+	name   string
+	help   string
+	kind   string
+	label  string
+	values map[string]float64
+}
+
+// New creates a Metrics with DefaultBuckets.
+func New() *Metrics {
+	return NewWithBuckets(DefaultBuckets)
+}
+
+// NewWithBuckets creates a Metrics whose histograms use the specified bucket upper bounds (in seconds).
+func NewWithBuckets(buckets []float64) *Metrics {
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+	return &Metrics{
+		buckets:      b,
+		started:      make(map[string]float64),
+		succeeded:    make(map[string]float64),
+		failed:       make(map[string]float64),
+		retried:      make(map[string]float64),
+		dead:         make(map[string]float64),
+		requeued:     make(map[string]float64),
+		recovered:    make(map[string]float64),
+		queueDepth:   make(map[string]float64),
+		queueLatency: make(map[string]float64),
+		jobDuration:  make(map[string]*histogram),
+		fetch:        newHistogram(b),
+	}
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	for i, upper := range buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// JobStarted implements work.Metrics.
+func (m *Metrics) JobStarted(jobName string) {
+	m.mtx.Lock()
+	m.started[jobName]++
+	m.mtx.Unlock()
+}
+
+// JobSucceeded implements work.Metrics.
+func (m *Metrics) JobSucceeded(jobName string, duration time.Duration) {
+	m.mtx.Lock()
+	m.succeeded[jobName]++
+	m.observeJobDuration(jobName, duration)
+	m.mtx.Unlock()
+}
+
+// JobFailed implements work.Metrics.
+func (m *Metrics) JobFailed(jobName string, duration time.Duration) {
+	m.mtx.Lock()
+	m.failed[jobName]++
+	m.observeJobDuration(jobName, duration)
+	m.mtx.Unlock()
+}
+
+func (m *Metrics) observeJobDuration(jobName string, duration time.Duration) {
+	h, ok := m.jobDuration[jobName]
+	if !ok {
+		h = newHistogram(m.buckets)
+		m.jobDuration[jobName] = h
+	}
+	h.observe(m.buckets, duration.Seconds())
+}
+
+// JobRetried implements work.Metrics.
+func (m *Metrics) JobRetried(jobName string) {
+	m.mtx.Lock()
+	m.retried[jobName]++
+	m.mtx.Unlock()
+}
+
+// JobDead implements work.Metrics.
+func (m *Metrics) JobDead(jobName string) {
+	m.mtx.Lock()
+	m.dead[jobName]++
+	m.mtx.Unlock()
+}
+
+// Fetched implements work.Metrics.
+func (m *Metrics) Fetched(duration time.Duration) {
+	m.mtx.Lock()
+	m.fetch.observe(m.buckets, duration.Seconds())
+	m.mtx.Unlock()
+}
+
+// QueueSampled implements work.Metrics.
+func (m *Metrics) QueueSampled(jobName string, depth int64, latency time.Duration) {
+	m.mtx.Lock()
+	m.queueDepth[jobName] = float64(depth)
+	m.queueLatency[jobName] = latency.Seconds()
+	m.mtx.Unlock()
+}
+
+// Requeued implements work.Metrics.
+func (m *Metrics) Requeued(queue string) {
+	m.mtx.Lock()
+	m.requeued[queue]++
+	m.mtx.Unlock()
+}
+
+// DeadPoolJobRecovered implements work.Metrics.
+func (m *Metrics) DeadPoolJobRecovered(jobName string) {
+	m.mtx.Lock()
+	m.recovered[jobName]++
+	m.mtx.Unlock()
+}
+
+// Handler returns an http.Handler that serves the collected metrics.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WriteTo(rw)
+	})
+}
+
+// WriteTo writes the collected metrics to w in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	families := []metricFamily{
+		{"work_jobs_started_total", "Number of jobs started.", "counter", "job_name", m.started},
+		{"work_jobs_succeeded_total", "Number of jobs whose handler succeeded.", "counter", "job_name", m.succeeded},
+		{"work_jobs_failed_total", "Number of jobs whose handler failed.", "counter", "job_name", m.failed},
+		{"work_jobs_retried_total", "Number of failed jobs put on the retry queue.", "counter", "job_name", m.retried},
+		{"work_jobs_dead_total", "Number of failed jobs put on the dead queue.", "counter", "job_name", m.dead},
+		{"work_requeued_total", "Number of jobs moved from the retry or scheduled queue to their job queue.", "counter", "queue", m.requeued},
+		{"work_dead_pool_jobs_recovered_total", "Number of in progress jobs of dead worker pools re-enqueued by the reaper.", "counter", "job_name", m.recovered},
+		{"work_queue_depth", "Number of jobs in the job queue.", "gauge", "job_name", m.queueDepth},
+		{"work_queue_latency_seconds", "How long ago the next job to be processed was enqueued.", "gauge", "job_name", m.queueLatency},
+	}
+	for _, f := range families {
+		writeFamily(cw, f)
+	}
+
+	fmt.Fprintf(cw, "# HELP work_job_duration_seconds Duration of job handlers.\n# TYPE work_job_duration_seconds histogram\n")
+	for _, jobName := range sortedKeys(m.jobDuration) {
+		m.writeHistogram(cw, "work_job_duration_seconds", `job_name="`+escapeLabelValue(jobName)+`",`, m.jobDuration[jobName])
+	}
+	fmt.Fprintf(cw, "# HELP work_fetch_duration_seconds Duration of attempts to fetch a job.\n# TYPE work_fetch_duration_seconds histogram\n")
+	m.writeHistogram(cw, "work_fetch_duration_seconds", "", m.fetch)
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func writeFamily(w io.Writer, f metricFamily) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for _, v := range sortedKeys(f.values) {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", f.name, f.label, escapeLabelValue(v), formatFloat(f.values[v]))
+	}
+}
+
+// writeHistogram writes h. labels is either empty or a list of labels with a trailing comma.
+func (m *Metrics) writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	for i, upper := range m.buckets {
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, labels, formatFloat(upper), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+
+	labels = strings.TrimSuffix(labels, ",")
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
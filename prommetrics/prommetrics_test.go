@@ -0,0 +1,54 @@
+package prommetrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewWithBuckets([]float64{1, 0.1})
+	m.JobStarted("send_email")
+	m.JobStarted("send_email")
+	m.JobSucceeded("send_email", 50*time.Millisecond)
+	m.JobFailed("send_email", 2*time.Second)
+	m.JobRetried("send_email")
+	m.JobDead(`we"ird`)
+	m.Fetched(time.Millisecond)
+	m.QueueSampled("send_email", 7, 3*time.Second)
+	m.Requeued("retry")
+	m.DeadPoolJobRecovered("send_email")
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE work_jobs_started_total counter",
+		`work_jobs_started_total{job_name="send_email"} 2`,
+		`work_jobs_succeeded_total{job_name="send_email"} 1`,
+		`work_jobs_failed_total{job_name="send_email"} 1`,
+		`work_jobs_retried_total{job_name="send_email"} 1`,
+		`work_jobs_dead_total{job_name="we\"ird"} 1`,
+		`work_requeued_total{queue="retry"} 1`,
+		`work_dead_pool_jobs_recovered_total{job_name="send_email"} 1`,
+		"# TYPE work_queue_depth gauge",
+		`work_queue_depth{job_name="send_email"} 7`,
+		`work_queue_latency_seconds{job_name="send_email"} 3`,
+		"# TYPE work_job_duration_seconds histogram",
+		`work_job_duration_seconds_bucket{job_name="send_email",le="0.1"} 1`,
+		`work_job_duration_seconds_bucket{job_name="send_email",le="1"} 1`,
+		`work_job_duration_seconds_bucket{job_name="send_email",le="+Inf"} 2`,
+		`work_job_duration_seconds_sum{job_name="send_email"} 2.05`,
+		`work_job_duration_seconds_count{job_name="send_email"} 2`,
+		`work_fetch_duration_seconds_bucket{le="0.1"} 1`,
+		`work_fetch_duration_seconds_bucket{le="+Inf"} 1`,
+		"work_fetch_duration_seconds_count 1",
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+}
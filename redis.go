@@ -4,19 +4,21 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 var (
 	// Used to fetch the next job to run
 	//
-	// KEYS[1] = the 1st job queue we want to try, eg, "work:jobs:emails"
-	// KEYS[2] = the 1st job queue's in prog queue, eg, "work:jobs:emails:97c84119d13cb54119a38743:inprogress"
-	// KEYS[3] = the 2nd job queue...
-	// KEYS[4] = the 2nd job queue's in prog queue...
+	// KEYS[1] = zset of the IDs of the jobs cancelled with Client.CancelJob, scored by when they stop being flagged, eg, "work:cancelled"
+	// KEYS[2] = the 1st job queue we want to try, eg, "work:jobs:emails"
+	// KEYS[3] = the 1st job queue's in prog queue, eg, "work:jobs:emails:97c84119d13cb54119a38743:inprogress"
+	// KEYS[4...8] = the 1st job queue's paused, lock, lock info, max concurrency and rate limit keys
+	// KEYS[9] = the 2nd job queue...
 	// ...
-	// KEYS[N] = the last job queue...
-	// KEYS[N+1] = the last job queue's in prog queue...
 	// ARGV[1] = job queue's workerPoolID
+	// ARGV[2] = current time in epoch milliseconds
+	// Returns: the job, its queue, its in prog queue, and 1 if it was cancelled, 0 otherwise
 	redisLuaFetchJob = fmt.Sprintf(`
 local function acquireLock(lockKey, lockInfoKey, workerPoolID)
   redis.call('incr', lockKey)
@@ -44,28 +46,92 @@ local function canRun(lockKey, maxConcurrency)
   end
 end
 
-local res, jobQueue, inProgQueue, pauseKey, lockKey, maxConcurrency, workerPoolID, concurrencyKey, lockInfoKey
+-- The rate limit is a token bucket holding up to limit tokens,
+-- refilled at a rate of limit tokens per interval.
+-- Each fetched job takes a token, so it must be checked last.
+local function takeToken(rateLimitKey, now)
+  local r = redis.call('hmget', rateLimitKey, 'limit', 'interval_ms', 'tokens', 'updated_at')
+  local limit = tonumber(r[1])
+  local interval = tonumber(r[2])
+  if not limit or limit <= 0 or not interval or interval <= 0 then
+    -- no rate limit
+    return true
+  end
+
+  local tokens = tonumber(r[3]) or limit
+  local updatedAt = tonumber(r[4]) or now
+  if now > updatedAt then
+    tokens = math.min(limit, tokens + (now - updatedAt) * limit / interval)
+    updatedAt = now
+  end
+  if tokens < 1 then
+    return false
+  end
+
+  redis.call('hset', rateLimitKey, 'tokens', tostring(tokens - 1), 'updated_at', updatedAt)
+  return true
+end
+
+-- The job may have been cancelled before it was fetched, eg, while it was scheduled
+local function isCancelled(job, now)
+  -- the ID is the first field of the jobs, unless they were serialized by other clients
+  local id = string.match(job, '^{"id":"([^"]*)"') or cjson.decode(job)['id']
+  if not id then
+    return false
+  end
+  local flaggedUntil = tonumber(redis.call('zscore', KEYS[1], id))
+  return flaggedUntil ~= nil and flaggedUntil * 1000 > now
+end
+
+local res, jobQueue, inProgQueue, pauseKey, lockKey, maxConcurrency, workerPoolID, concurrencyKey, lockInfoKey, rateLimitKey
 local keylen = #KEYS
 workerPoolID = ARGV[1]
+local now = tonumber(ARGV[2])
 
-for i=1,keylen,%d do
+for i=2,keylen,%d do
   jobQueue = KEYS[i]
   inProgQueue = KEYS[i+1]
   pauseKey = KEYS[i+2]
   lockKey = KEYS[i+3]
   lockInfoKey = KEYS[i+4]
   concurrencyKey = KEYS[i+5]
+  rateLimitKey = KEYS[i+6]
 
   maxConcurrency = tonumber(redis.call('get', concurrencyKey))
 
-  if haveJobs(jobQueue) and not isPaused(pauseKey) and canRun(lockKey, maxConcurrency) then
+  if haveJobs(jobQueue) and not isPaused(pauseKey) and canRun(lockKey, maxConcurrency) and takeToken(rateLimitKey, now) then
     acquireLock(lockKey, lockInfoKey, workerPoolID)
     res = redis.call('rpoplpush', jobQueue, inProgQueue)
-    return {res, jobQueue, inProgQueue}
+    if isCancelled(res, now) then
+      return {res, jobQueue, inProgQueue, 1}
+    end
+    return {res, jobQueue, inProgQueue, 0}
   end
 end
 return nil`, fetchKeysPerJobType)
 
+	// Used by worker pools to set the max concurrency of their jobs and get their overridden priorities
+	//
+	// KEYS[1] = the 1st job's max concurrency key, eg, "work:jobs:emails:max_concurrency"
+	// KEYS[2] = the 1st job's overrides hash, eg, "work:jobs:emails:overrides"
+	// KEYS[3] = the 2nd job's max concurrency key...
+	// KEYS[4] = the 2nd job's overrides hash...
+	// ...
+	// ARGV[1] = the 1st job's max concurrency, used unless overridden
+	// ARGV[2] = the 2nd job's max concurrency...
+	// ...
+	// Returns: the priority override of each job, or an empty string if it isn't overridden
+	redisLuaWriteJobControls = `
+local res = {}
+local o
+for i=1,#KEYS,2 do
+  o = redis.call('hmget', KEYS[i+1], 'max_concurrency', 'priority')
+  redis.call('set', KEYS[i], o[1] or ARGV[(i+1)/2])
+  res[#res+1] = o[2] or ''
+end
+return res
+`
+
 	// Used by the reaper to re-enqueue jobs that were in progress
 	//
 	// KEYS[1] = the 1st job's in progress queue
@@ -99,6 +165,26 @@ for i=1,keylen,%d do
 end
 return nil`, requeueKeysPerJob)
 
+	// Used by a stopping worker to put back the job it's processing on its queue
+	//
+	// KEYS[1] = the job's in progress queue
+	// KEYS[2] = the job's job queue
+	// KEYS[3] = the job's lock
+	// KEYS[4] = the job's lock info hash
+	// ARGV[1] = the job, as fetched
+	// ARGV[2] = workerPoolID for job queue
+	// Returns: 1 if the job was put back, 0 if it wasn't in progress
+	redisLuaRequeueInFlightJob = `
+if redis.call('lrem', KEYS[1], 1, ARGV[1]) == 1 then
+  -- it was at the front of the queue when it was fetched, so put it back there
+  redis.call('rpush', KEYS[2], ARGV[1])
+  redis.call('decr', KEYS[3])
+  redis.call('hincrby', KEYS[4], ARGV[2], -1)
+  return 1
+end
+return 0
+`
+
 	// Used by the reaper to clean up stale locks
 	//
 	// KEYS[1] = the 1st job's lock
@@ -129,6 +215,39 @@ for i=1,keylen,2 do
   end
 end
 return nil
+`
+
+	// Sets the status of a job moved by a script, as per sendJobStatus, if it's tracked
+	redisLuaSetJobStatus = `
+local function setJobStatus(statusPrefix, j, state, now)
+  local ttl = tonumber(j['status_ttl'])
+  if not ttl or ttl <= 0 then
+    return
+  end
+  local key = statusPrefix .. j['id']
+  redis.call('hset', key, 'state', state, 'name', j['name'], 'updated_at', now, 'fails', j['fails'] or 0, 'err', j['err'] or '')
+  redis.call('expire', key, ttl)
+end
+`
+
+	// Tells which job holds a unique key from its value: the ID of the job,
+	// or the job itself if enqueuing it again replaced its args.
+	// The keys set by older versions hold "1", so any job could hold them.
+	redisLuaUniqueKeyOwner = `
+local function uniqueKeyOwner(v)
+  if string.sub(v, 1, 1) ~= '{' then
+    return v
+  end
+  return string.match(v, '^{"id":"([^"]*)"') or cjson.decode(v)['id']
+end
+local function ownsUniqueKey(key, id)
+  local v = redis.call('get', key)
+  if not v then
+    return false
+  end
+  local owner = uniqueKeyOwner(v)
+  return owner == id or owner == '1'
+end
 `
 
 	// KEYS[1] = zset of jobs (retry or scheduled), eg work:retry
@@ -136,37 +255,90 @@ return nil
 	// KEYS[3...] = known job queues, eg ["work:jobs:create_watch", "work:jobs:send_email", ...]
 	// ARGV[1] = jobs prefix, eg, "work:jobs:". We'll take that and append the job name from the JSON object in order to queue up a job
 	// ARGV[2] = current time in epoch seconds
-	redisLuaZremLpushCmd = `
+	// ARGV[3] = current time in epoch milliseconds
+	// ARGV[4] = job statuses prefix, eg, "work:status:". We'll append the job ID to it to update the status of tracked jobs
+	// Unique periodic jobs only take the unique key of their name once due, and are dropped if another one holds it
+	redisLuaZremLpushCmd = redisLuaSetJobStatus + fmt.Sprintf(`
 local res, j, queue
+-- the scores are in epoch milliseconds, except for the jobs added by older versions, which are in epoch seconds
 res = redis.call('zrangebyscore', KEYS[1], '-inf', ARGV[2], 'LIMIT', 0, 1)
+if #res == 0 then
+  res = redis.call('zrangebyscore', KEYS[1], %d, ARGV[3], 'LIMIT', 0, 1)
+end
 if #res > 0 then
   j = cjson.decode(res[1])
   redis.call('zrem', KEYS[1], res[1])
   queue = ARGV[1] .. j['name']
   for _,v in pairs(KEYS) do
     if v == queue then
+      if j['unique'] and j['unique_key'] and not j['fails'] and string.sub(j['id'], 1, 9) == 'periodic:' then
+        -- the key only holds the ID, as the job is queued re-encoded, so it must not be swapped for res[1] once fetched
+        if not redis.call('set', j['unique_key'], j['id'], 'NX', 'EX', j['unique_ttl'] or %d) then
+          return 'dup'
+        end
+      end
       j['t'] = tonumber(ARGV[2])
       redis.call('lpush', queue, cjson.encode(j))
+      setJobStatus(ARGV[4], j, 'queued', ARGV[2])
       return 'ok'
     end
   end
   j['err'] = 'unknown job when requeueing'
   j['failed_at'] = tonumber(ARGV[2])
   redis.call('zadd', KEYS[2], ARGV[2], cjson.encode(j))
+  setJobStatus(ARGV[4], j, 'dead', ARGV[2])
   return 'dead' -- put on dead queue
 end
 return nil
+`, minMillisecondsScore, defaultUniqueTTLSeconds)
+
+	// Used to read the jobs of a zset following the last one read, wherever it is now
+	//
+	// KEYS[1] = zset of (dead|scheduled|retry), eg, work:dead
+	// ARGV[1] = score of the last job read
+	// ARGV[2] = last job read
+	// ARGV[3] = max score of the jobs to read, or "+inf"
+	// ARGV[4] = max number of jobs to read
+	// Returns: the jobs read, with their scores, as ZRANGEBYSCORE ... WITHSCORES
+	redisLuaZsetAfter = `
+local start = redis.call('zrank', KEYS[1], ARGV[2])
+if start then
+  start = start + 1
+else
+  -- the last job read was deleted since, so it's added back for as long as it takes to find where it was
+  redis.call('zadd', KEYS[1], ARGV[1], ARGV[2])
+  start = redis.call('zrank', KEYS[1], ARGV[2])
+  redis.call('zrem', KEYS[1], ARGV[2])
+end
+local max = ARGV[3] == '+inf' and math.huge or tonumber(ARGV[3])
+local res = redis.call('zrange', KEYS[1], start, start + tonumber(ARGV[4]) - 1, 'WITHSCORES')
+local jobs = {}
+for i = 1, #res, 2 do
+  if tonumber(res[i+1]) > max then
+    break
+  end
+  jobs[#jobs+1] = res[i]
+  jobs[#jobs+1] = res[i+1]
+end
+return jobs
 `
 
 	// KEYS[1] = zset of (dead|scheduled|retry), eg, work:dead
 	// ARGV[1] = died at. The z rank of the job.
 	// ARGV[2] = job ID to requeue
+	// ARGV[3] = optional, the z rank in epoch milliseconds at the start of that second, for scheduled and retry jobs
+	// ARGV[4] = optional, the z rank in epoch milliseconds at the end of that second
 	// Returns:
 	// - number of jobs deleted (typically 1 or 0)
 	// - job bytes (last job only)
 	redisLuaDeleteSingleCmd = `
 local jobs, i, j, deletedCount, jobBytes
 jobs = redis.call('zrangebyscore', KEYS[1], ARGV[1], ARGV[1])
+if ARGV[3] then
+  for _,jobBytes in ipairs(redis.call('zrangebyscore', KEYS[1], ARGV[3], ARGV[4])) do
+    jobs[#jobs+1] = jobBytes
+  end
+end
 local jobCount = #jobs
 jobBytes = ''
 deletedCount = 0
@@ -179,6 +351,19 @@ for i=1,jobCount do
   end
 end
 return {deletedCount, jobBytes}
+`
+
+	// KEYS[1...] = unique keys to release, eg ["work:unique:send_digest:", ...]
+	// ARGV[1...] = IDs of the jobs which held them, in the same order
+	// Returns: number of keys released, the ones held by other jobs being left alone
+	redisLuaReleaseUniqueKeys = redisLuaUniqueKeyOwner + `
+local n = 0
+for i, key in ipairs(KEYS) do
+  if ownsUniqueKey(key, ARGV[i]) then
+    n = n + redis.call('del', key)
+  end
+end
+return n
 `
 
 	// KEYS[1] = zset of dead jobs, eg, work:dead
@@ -187,8 +372,9 @@ return {deletedCount, jobBytes}
 	// ARGV[2] = current time in epoch seconds
 	// ARGV[3] = died at. The z rank of the job.
 	// ARGV[4] = job ID to requeue
+	// ARGV[5] = job statuses prefix, eg, "work:status:". We'll append the job ID to it to update the status of tracked jobs
 	// Returns: number of jobs requeued (typically 1 or 0)
-	redisLuaRequeueSingleDeadCmd = `
+	redisLuaRequeueSingleDeadCmd = redisLuaSetJobStatus + `
 local jobs, i, j, queue, found, requeuedCount
 jobs = redis.call('zrangebyscore', KEYS[1], ARGV[3], ARGV[3])
 local jobCount = #jobs
@@ -204,8 +390,10 @@ for i=1,jobCount do
         j['t'] = tonumber(ARGV[2])
         j['fails'] = nil
         j['failed_at'] = nil
+        j['first_t'] = nil
         j['err'] = nil
         redis.call('lpush', queue, cjson.encode(j))
+        setJobStatus(ARGV[5], j, 'queued', ARGV[2])
         requeuedCount = requeuedCount + 1
         found = true
         break
@@ -226,8 +414,9 @@ return requeuedCount
 	// ARGV[1] = jobs prefix, eg, "work:jobs:". We'll take that and append the job name from the JSON object in order to queue up a job
 	// ARGV[2] = current time in epoch seconds
 	// ARGV[3] = max number of jobs to requeue
+	// ARGV[4] = job statuses prefix, eg, "work:status:". We'll append the job ID to it to update the status of tracked jobs
 	// Returns: number of jobs requeued
-	redisLuaRequeueAllDeadCmd = `
+	redisLuaRequeueAllDeadCmd = redisLuaSetJobStatus + `
 local jobs, i, j, queue, found, requeuedCount
 jobs = redis.call('zrangebyscore', KEYS[1], '-inf', ARGV[2], 'LIMIT', 0, ARGV[3])
 local jobCount = #jobs
@@ -242,8 +431,10 @@ for i=1,jobCount do
       j['t'] = tonumber(ARGV[2])
       j['fails'] = nil
       j['failed_at'] = nil
+      j['first_t'] = nil
       j['err'] = nil
       redis.call('lpush', queue, cjson.encode(j))
+      setJobStatus(ARGV[4], j, 'queued', ARGV[2])
       requeuedCount = requeuedCount + 1
       found = true
       break
@@ -256,18 +447,250 @@ for i=1,jobCount do
   end
 end
 return requeuedCount
+`
+
+	// KEYS[1] = zset of dead jobs, eg work:dead
+	// ARGV[1] = max died at of the jobs to delete, eg "(1700000000", or "-inf" for none by age and "+inf" for all
+	// ARGV[2] = number of most recent jobs to keep, or 0 for no limit
+	// ARGV[3] = max number of jobs to delete
+	// ARGV[4] = the UniqueAcrossDead unique mode. The unique keys the deleted jobs with it still hold are deleted too
+	// Returns: number of jobs deleted
+	redisLuaDeleteDeadJobs = redisLuaUniqueKeyOwner + `
+local n = redis.call('zcount', KEYS[1], '-inf', ARGV[1])
+local keep = tonumber(ARGV[2])
+if keep > 0 then
+  n = math.max(n, redis.call('zcard', KEYS[1]) - keep)
+end
+n = math.min(n, tonumber(ARGV[3]))
+if n <= 0 then
+  return 0
+end
+for _,jobBytes in ipairs(redis.call('zrange', KEYS[1], 0, n - 1)) do
+  -- only decode the jobs which could hold a unique key
+  if string.find(jobBytes, '"unique_key"', 1, true) then
+    local j = cjson.decode(jobBytes)
+    if j['unique'] and j['unique_key'] and j['unique_mode'] == tonumber(ARGV[4]) and ownsUniqueKey(j['unique_key'], j['id']) then
+      redis.call('del', j['unique_key'])
+    end
+  end
+end
+return redis.call('zremrangebyrank', KEYS[1], 0, n - 1)
+`
+
+	// Used to enqueue a job into a batch
+	//
+	// KEYS[1] = the batch's hash, eg, "work:batches:6a3f2e9b7c1d0e5f4a8b2c7d"
+	// KEYS[2] = job queue to push onto, or the scheduled job queue
+	// ARGV[1] = job
+	// ARGV[2] = epoch milliseconds for job to be run at, or an empty string to run it now
+	redisLuaBatchEnqueue = `
+local b = redis.call('hmget', KEYS[1], 'created_at', 'closed')
+if not b[1] then
+  return 'missing'
+end
+if b[2] == '1' then
+  return 'closed'
+end
+redis.call('hincrby', KEYS[1], 'total', 1)
+redis.call('hincrby', KEYS[1], 'pending', 1)
+if ARGV[2] == '' then
+  redis.call('lpush', KEYS[2], ARGV[1])
+else
+  redis.call('zadd', KEYS[2], ARGV[2], ARGV[1])
+end
+return 'ok'
+`
+
+	// Used when a job of a batch succeeded or died
+	//
+	// KEYS[1] = the batch's hash
+	// KEYS[2] = the hash of the jobs of the batch done, eg, "work:batches:6a3f2e9b7c1d0e5f4a8b2c7d:done"
+	// ARGV[1] = current time in epoch seconds
+	// ARGV[2] = seconds to keep the batch's hash after the batch finished
+	// ARGV[3] = "1" if the job died, "0" if it succeeded
+	// ARGV[4] = ID of the job
+	// A job is only pending until it's first done. One which died and was retried from the dead queue
+	// isn't failed anymore once it succeeds. A job done after its batch finished isn't counted.
+	redisLuaBatchJobDone = redisLuaBatchFinish + `
+if redis.call('exists', KEYS[1]) == 0 then
+  return 'missing'
+end
+if redis.call('hexists', KEYS[1], 'finished_at') == 1 then
+  return 'finished'
+end
+local done = redis.call('hget', KEYS[2], ARGV[4])
+local pending
+if not done then
+  pending = redis.call('hincrby', KEYS[1], 'pending', -1)
+  if ARGV[3] == '1' then
+    redis.call('hincrby', KEYS[1], 'failed', 1)
+  end
+elseif done == 'dead' and ARGV[3] == '0' then
+  pending = tonumber(redis.call('hget', KEYS[1], 'pending')) or 0
+  redis.call('hincrby', KEYS[1], 'failed', -1)
+else
+  return 'done'
+end
+if ARGV[3] == '1' then
+  redis.call('hset', KEYS[2], ARGV[4], 'dead')
+else
+  redis.call('hset', KEYS[2], ARGV[4], 'ok')
+end
+if pending <= 0 and redis.call('hget', KEYS[1], 'closed') == '1' then
+  finish(KEYS[1], KEYS[2], ARGV[1], ARGV[2])
+  return 'finished'
+end
+return 'ok'
+`
+
+	// Used to close a batch, so that it can finish
+	//
+	// KEYS[1] = the batch's hash
+	// KEYS[2] = the hash of the jobs of the batch done
+	// ARGV[1] = current time in epoch seconds
+	// ARGV[2] = seconds to keep the batch's hash after the batch finished
+	redisLuaBatchClose = redisLuaBatchFinish + `
+local b = redis.call('hmget', KEYS[1], 'created_at', 'closed', 'pending')
+if not b[1] then
+  return 'missing'
+end
+if b[2] == '1' then
+  return 'closed'
+end
+redis.call('hset', KEYS[1], 'closed', '1')
+if (tonumber(b[3]) or 0) <= 0 then
+  finish(KEYS[1], KEYS[2], ARGV[1], ARGV[2])
+  return 'finished'
+end
+return 'ok'
+`
+
+	// Enqueues the callbacks of a finished batch.
+	// The callbacks are stored in the batch's hash along with the queues to push them onto.
+	redisLuaBatchFinish = `
+local function pushCallback(queue, job, now)
+  local j = cjson.decode(job)
+  j['t'] = tonumber(now)
+  redis.call('lpush', queue, cjson.encode(j))
+end
+
+local function finish(batchKey, doneKey, now, keepSeconds)
+  local b = redis.call('hmget', batchKey, 'failed', 'on_success_queue', 'on_success', 'on_complete_queue', 'on_complete')
+  if (tonumber(b[1]) or 0) == 0 and b[2] then
+    pushCallback(b[2], b[3], now)
+  end
+  if b[4] then
+    pushCallback(b[4], b[5], now)
+  end
+  redis.call('hset', batchKey, 'finished_at', now)
+  redis.call('expire', batchKey, keepSeconds)
+  redis.call('expire', doneKey, keepSeconds)
+end
+`
+
+	// Used when a job with dependents succeeded, to release the dependents waiting on no other job
+	//
+	// KEYS[1] = the 1st dependent's waiting hash, eg, "work:waiting:6a3f2e9b7c1d0e5f4a8b2c7d"
+	// KEYS[2] = the 2nd dependent's waiting hash...
+	// ...
+	// ARGV[1] = current time in epoch seconds
+	// ARGV[2] = ID of the job that succeeded
+	// The job isn't decoded, so that its args are pushed as they are: the enqueued at time is spliced in at t_start..t_end.
+	redisLuaReleaseDependents = `
+local w, j
+for _, key in ipairs(KEYS) do
+  if redis.call('hdel', key, 'parent:' .. ARGV[2]) == 1 and redis.call('hincrby', key, 'pending', -1) <= 0 then
+    w = redis.call('hmget', key, 'queue', 'job', 't_start', 't_end')
+    j = w[2]
+    if w[3] and w[4] then
+      j = string.sub(j, 1, tonumber(w[3])) .. ARGV[1] .. string.sub(j, tonumber(w[4]) + 1)
+    end
+    redis.call('lpush', w[1], j)
+    redis.call('del', key)
+  end
+end
+return nil
+`
+
+	// Used when a job with dependents died, to park the dependents, unless they're to be cancelled with redisLuaCancelDependents
+	//
+	// KEYS[1] = zset of dead jobs, eg, work:dead
+	// KEYS[2] = the 1st dependent's waiting hash
+	// KEYS[3] = the 2nd dependent's waiting hash...
+	// ...
+	// ARGV[1] = current time in epoch seconds
+	// ARGV[2] = ID of the job that died
+	// ARGV[3] = job statuses prefix, eg, "work:status:". We'll append the job ID to it to update the status of tracked jobs
+	redisLuaParentDied = redisLuaSetJobStatus + `
+local w, j, err
+for i=2,#KEYS do
+  w = redis.call('hmget', KEYS[i], 'job', 'on_parent_dead')
+  if w[1] and w[2] ~= 'cancel' then
+    -- The waiting job has never failed, so err and failed_at are appended without decoding it
+    err = 'parent job ' .. ARGV[2] .. ' died'
+    j = string.sub(w[1], 1, -2) .. ',"err":' .. cjson.encode(err) .. ',"failed_at":' .. ARGV[1] .. '}'
+    redis.call('zadd', KEYS[1], ARGV[1], j)
+    redis.call('del', KEYS[i])
+    if string.find(w[1], '"status_ttl"', 1, true) then
+      j = cjson.decode(w[1])
+      j['err'] = err
+      setJobStatus(ARGV[3], j, 'dead', ARGV[1])
+    end
+  end
+end
+return nil
+`
+
+	// Used after a job with dependents died, to cancel the dependents to be cancelled, then their own dependents, and so on,
+	// a level of dependents at a time
+	//
+	// KEYS[1] = the 1st waiting hash of the dependents to cancel, eg, "work:waiting:6a3f2e9b7c1d0e5f4a8b2c7d"
+	// KEYS[2] = the 2nd waiting hash...
+	// ...
+	// ARGV[1] = current time in epoch seconds
+	// ARGV[2] = job statuses prefix, eg, "work:status:". We'll append the job ID to it to update the status of tracked jobs
+	// ARGV[3] = the error to set in the statuses of the cancelled jobs
+	// Returns: the IDs of the dependents of the cancelled jobs, to cancel next
+	redisLuaCancelDependents = redisLuaSetJobStatus + `
+local dependents = {}
+for i=1,#KEYS do
+  local job = redis.call('hget', KEYS[i], 'job')
+  if job then
+    redis.call('del', KEYS[i])
+    local j = cjson.decode(job)
+    j['err'] = ARGV[3]
+    setJobStatus(ARGV[2], j, 'dead', ARGV[1])
+    if type(j['dependents']) == 'table' then
+      for _, id in ipairs(j['dependents']) do
+        dependents[#dependents+1] = id
+      end
+    end
+  end
+end
+return dependents
 `
 
 	// KEYS[1] = job queue to push onto
 	// KEYS[2] = Unique job's key. Test for existence and set if we push.
 	// ARGV[1] = job
-	// ARGV[2] = updated job or just a 1 if arguments don't update
-	redisLuaEnqueueUnique = `
-if redis.call('set', KEYS[2], ARGV[2], 'NX', 'EX', '86400') then
+	// ARGV[2] = updated job, or just its ID if arguments don't update
+	// ARGV[3] = seconds for the job to be unique for at most
+	redisLuaEnqueueUnique = redisLuaUniqueKeyOwner + `
+if redis.call('set', KEYS[2], ARGV[2], 'NX', 'EX', ARGV[3]) then
   redis.call('lpush', KEYS[1], ARGV[1])
   return 'ok'
 else
-  redis.call('set', KEYS[2], ARGV[2], 'EX', '86400')
+  -- the key stays held by the same job, only its args being replaced
+  local owner = uniqueKeyOwner(redis.call('get', KEYS[2]))
+  local v = owner
+  local id = string.match(ARGV[2], '^{"id":"[^"]*"')
+  if id then
+    v = ARGV[2]
+    if owner ~= '1' then
+      v = '{"id":"' .. owner .. '"' .. string.sub(ARGV[2], #id + 1)
+    end
+  end
+  redis.call('set', KEYS[2], v, 'EX', ARGV[3])
 end
 return 'dup'
 `
@@ -275,19 +698,122 @@ return 'dup'
 	// KEYS[1] = scheduled job queue
 	// KEYS[2] = Unique job's key. Test for existence and set if we push.
 	// ARGV[1] = job
-	// ARGV[2] = updated job or just a 1 if arguments don't update
-	// ARGV[3] = epoch seconds for job to be run at
-	redisLuaEnqueueUniqueIn = `
-if redis.call('set', KEYS[2], ARGV[2], 'NX', 'EX', '86400') then
-  redis.call('zadd', KEYS[1], ARGV[3], ARGV[1])
+	// ARGV[2] = updated job, or just its ID if arguments don't update
+	// ARGV[3] = seconds for the job to be unique for at most
+	// ARGV[4] = epoch milliseconds for job to be run at
+	redisLuaEnqueueUniqueIn = redisLuaUniqueKeyOwner + `
+if redis.call('set', KEYS[2], ARGV[2], 'NX', 'EX', ARGV[3]) then
+  redis.call('zadd', KEYS[1], ARGV[4], ARGV[1])
   return 'ok'
 else
-  redis.call('set', KEYS[2], ARGV[2], 'EX', '86400')
+  -- the key stays held by the same job, only its args being replaced
+  local owner = uniqueKeyOwner(redis.call('get', KEYS[2]))
+  local v = owner
+  local id = string.match(ARGV[2], '^{"id":"[^"]*"')
+  if id then
+    v = ARGV[2]
+    if owner ~= '1' then
+      v = '{"id":"' .. owner .. '"' .. string.sub(ARGV[2], #id + 1)
+    end
+  end
+  redis.call('set', KEYS[2], v, 'EX', ARGV[3])
 end
 return 'dup'
+`
+
+	// Used to enqueue a debounced job, replacing the one scheduled for the same key unless it's due already
+	//
+	// KEYS[1] = scheduled job queue
+	// KEYS[2] = the debounce key, eg, "work:debounce:send_digest:42", holding the job last scheduled for it
+	// ARGV[1] = job
+	// ARGV[2] = epoch milliseconds for job to be run at
+	// ARGV[3] = seconds to keep the debounce key for
+	// Returns: the job replaced, or nil if there wasn't any
+	redisLuaEnqueueDebounced = `
+local prev = redis.call('get', KEYS[2])
+if prev and redis.call('zrem', KEYS[1], prev) == 0 then
+  prev = false
+end
+redis.call('zadd', KEYS[1], ARGV[2], ARGV[1])
+redis.call('set', KEYS[2], ARGV[1], 'EX', ARGV[3])
+return prev
+`
+
+	// Used to enqueue a throttled job. It runs right away unless a job of the same key ran during the window,
+	// in which case it's scheduled for the end of the window, replacing the one scheduled already if any.
+	//
+	// KEYS[1] = job queue to push onto
+	// KEYS[2] = scheduled job queue
+	// KEYS[3] = the throttle hash, eg, "work:throttle:send_digest:42"
+	// ARGV[1] = job
+	// ARGV[2] = current time in epoch milliseconds
+	// ARGV[3] = the window, in milliseconds
+	// Returns: the epoch milliseconds for job to be run at, and the job replaced or nil
+	redisLuaEnqueueThrottled = `
+local now = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local t = redis.call('hmget', KEYS[3], 'next', 'job', 'at')
+if t[2] and redis.call('zrem', KEYS[2], t[2]) == 1 then
+  -- the job scheduled for the end of the window didn't run yet, so it's just replaced
+  redis.call('zadd', KEYS[2], t[3], ARGV[1])
+  redis.call('hset', KEYS[3], 'job', ARGV[1])
+  return {tonumber(t[3]), t[2]}
+end
+
+local nextAt = tonumber(t[1])
+if not nextAt or nextAt <= now then
+  redis.call('lpush', KEYS[1], ARGV[1])
+  redis.call('hset', KEYS[3], 'next', now + window)
+  redis.call('hdel', KEYS[3], 'job', 'at')
+  redis.call('pexpire', KEYS[3], window)
+  return {now, false}
+end
+
+redis.call('zadd', KEYS[2], nextAt, ARGV[1])
+redis.call('hset', KEYS[3], 'next', nextAt + window, 'job', ARGV[1], 'at', nextAt)
+redis.call('pexpire', KEYS[3], nextAt + window - now)
+return {nextAt, false}
+`
+
+	// KEYS[1] = zset of the IDs of the cancelled jobs, eg, "work:cancelled"
+	// KEYS[2] = the job's waiting hash, in case it's waiting on the jobs it depends on
+	// KEYS[3] = the job's status, in case it's tracked, eg, "work:status:6a3f2e9b7c1d0e5f4a8b2c7d"
+	// ARGV[1] = job ID to cancel
+	// ARGV[2] = current time in epoch seconds
+	// ARGV[3] = until when to flag the job as cancelled, in epoch seconds
+	// ARGV[4] = the error to set in the status of the job
+	// Returns: the job deleted from its waiting hash, or nil if it wasn't waiting and was flagged instead
+	redisLuaCancelJob = `
+local waiting = redis.call('hget', KEYS[2], 'job')
+if waiting then
+  redis.call('del', KEYS[2])
+  return waiting
+end
+redis.call('zremrangebyscore', KEYS[1], '-inf', ARGV[2])
+redis.call('zadd', KEYS[1], ARGV[3], ARGV[1])
+-- a job which isn't running is discarded once fetched, so it's dead already
+local state = redis.call('hget', KEYS[3], 'state')
+if state == 'queued' or state == 'retrying' then
+  redis.call('hset', KEYS[3], 'state', 'dead', 'updated_at', ARGV[2], 'err', ARGV[4])
+end
+return nil
 `
 )
 
+// ClusterNamespace returns namespace wrapped in a hash tag, eg, "{myapp-work}" for "myapp-work",
+// so that all of its keys hash to the same Redis Cluster slot.
+// The scripts that fetch and move jobs work with the keys of several queues and sets at once,
+// which fails with a CROSSSLOT error on Redis Cluster unless they share a slot.
+// As a result, the jobs of a namespace are all stored on the same node,
+// so use several namespaces to spread jobs across the cluster.
+// A namespace that's hash-tagged already is returned as is.
+func ClusterNamespace(namespace string) string {
+	if strings.HasPrefix(namespace, "{") && strings.Contains(namespace, "}") {
+		return namespace
+	}
+	return "{" + strings.TrimSuffix(namespace, ":") + "}"
+}
+
 func redisNamespacePrefix(namespace string) string {
 	l := len(namespace)
 	if (l > 0) && (namespace[l-1] != ':') {
@@ -330,6 +856,14 @@ func redisKeyJobsConcurrency(namespace, jobName string) string {
 	return redisKeyJobs(namespace, jobName) + ":max_concurrency"
 }
 
+func redisKeyJobsRateLimit(namespace, jobName string) string {
+	return redisKeyJobs(namespace, jobName) + ":rate_limit"
+}
+
+func redisKeyJobsOverrides(namespace, jobName string) string {
+	return redisKeyJobs(namespace, jobName) + ":overrides"
+}
+
 func redisKeyKnownJobs(namespace string) string {
 	return redisNamespacePrefix(namespace) + "known_jobs"
 }
@@ -372,6 +906,62 @@ func redisKeyHeartbeat(namespace, workerPoolID string) string {
 	return redisNamespacePrefix(namespace) + "worker_pools:" + workerPoolID
 }
 
+func redisKeyBatch(namespace, batchID string) string {
+	return redisNamespacePrefix(namespace) + "batches:" + batchID
+}
+
+func redisKeyBatchDone(namespace, batchID string) string {
+	return redisKeyBatch(namespace, batchID) + ":done"
+}
+
+// returns "<namespace>:waiting:"
+// so that we can just append the job ID
+func redisKeyWaitingJobsPrefix(namespace string) string {
+	return redisNamespacePrefix(namespace) + "waiting:"
+}
+
+func redisKeyWaitingJob(namespace, jobID string) string {
+	return redisKeyWaitingJobsPrefix(namespace) + jobID
+}
+
+// returns "<namespace>:status:"
+// so that we can just append the job ID
+func redisKeyJobStatusPrefix(namespace string) string {
+	return redisNamespacePrefix(namespace) + "status:"
+}
+
+func redisKeyJobStatus(namespace, jobID string) string {
+	return redisKeyJobStatusPrefix(namespace) + jobID
+}
+
+func redisKeyCancelledJobs(namespace string) string {
+	return redisNamespacePrefix(namespace) + "cancelled"
+}
+
+func redisKeyDebounce(namespace, jobName, key string) string {
+	return redisNamespacePrefix(namespace) + "debounce:" + jobName + ":" + key
+}
+
+func redisKeyThrottle(namespace, jobName, key string) string {
+	return redisNamespacePrefix(namespace) + "throttle:" + jobName + ":" + key
+}
+
 func redisKeyLastPeriodicEnqueue(namespace string) string {
 	return redisNamespacePrefix(namespace) + "last_periodic_enqueue"
 }
+
+func redisKeyPeriodicJobs(namespace string) string {
+	return redisNamespacePrefix(namespace) + "periodic_jobs"
+}
+
+func redisKeyPeriodicJobsLastEnqueued(namespace string) string {
+	return redisKeyPeriodicJobs(namespace) + ":last_enqueued"
+}
+
+func redisKeyPeriodicJobsPaused(namespace string) string {
+	return redisKeyPeriodicJobs(namespace) + ":paused"
+}
+
+func redisKeyLastDeadPrune(namespace string) string {
+	return redisNamespacePrefix(namespace) + "last_dead_prune"
+}
@@ -3,66 +3,51 @@ package work
 import (
 	"fmt"
 	"time"
-
-	"github.com/gomodule/redigo/redis"
 )
 
 type requeuer struct {
-	namespace          string
-	pool               *redis.Pool
-	redisRequeueScript *redis.Script
-	redisRequeueArgs   []interface{}
-	stopChan           chan struct{}
-	doneStoppingChan   chan struct{}
-	drainChan          chan struct{}
-	doneDrainingChan   chan struct{}
+	namespace        string
+	backend          Backend
+	logger           Logger
+	metrics          Metrics
+	set              string // eg, "retry"
+	jobNames         []string
+	stopChan         chan struct{}
+	doneStoppingChan chan struct{}
+	drainChan        chan struct{}
+	doneDrainingChan chan struct{}
 }
 
-func newRequeuer(namespace string, pool *redis.Pool, requeueKey string, jobNames []string) *requeuer {
-	args := make([]interface{}, 0, len(jobNames)+2+2)
-	args = append(args, requeueKey)              // KEY[1]
-	args = append(args, redisKeyDead(namespace)) // KEY[2]
-	for _, jobName := range jobNames {
-		args = append(args, redisKeyJobs(namespace, jobName)) // KEY[3, 4, ...]
+func newRequeuer(namespace string, backend Backend, set string, jobNames []string, logger Logger, metrics Metrics) *requeuer {
+	if metrics == nil {
+		metrics = noopMetrics{}
 	}
 
-	args = append(args, redisKeyJobsPrefix(namespace)) // ARGV[1]
-	args = append(args, 0)                             // ARGV[2] -- NOTE: We're going to change this one on every call
 	return &requeuer{
-		namespace:          namespace,
-		pool:               pool,
-		redisRequeueScript: redis.NewScript(len(jobNames)+2, redisLuaZremLpushCmd),
-		redisRequeueArgs:   args,
-		stopChan:           make(chan struct{}),
-		doneStoppingChan:   make(chan struct{}),
-		drainChan:          make(chan struct{}),
-		doneDrainingChan:   make(chan struct{}),
+		namespace:        namespace,
+		backend:          backend,
+		logger:           logger,
+		metrics:          metrics,
+		set:              set,
+		jobNames:         jobNames,
+		stopChan:         make(chan struct{}),
+		doneStoppingChan: make(chan struct{}),
+		drainChan:        make(chan struct{}),
+		doneDrainingChan: make(chan struct{}),
 	}
 }
 
-func (r *requeuer) process() bool {
-	conn := r.pool.Get()
-	defer conn.Close()
-
-	r.redisRequeueArgs[len(r.redisRequeueArgs)-1] = nowEpochSeconds()
-
-	res, err := redis.String(r.redisRequeueScript.Do(conn, r.redisRequeueArgs...))
-	if err == redis.ErrNil {
-		return false
-	} else if err != nil {
-		logError("requeuer.process", err)
-		return false
+func (r *requeuer) process() {
+	requeued, dead, err := r.backend.RequeueDue(r.set, r.jobNames)
+	for i := 0; i < requeued; i++ {
+		r.metrics.Requeued(r.set)
 	}
-
-	if res == "" {
-		return false
-	} else if res == "dead" {
-		logError("requeuer.process.dead", fmt.Errorf("no job name"))
-		return true
-	} else if res == "ok" {
-		return true
+	if dead > 0 {
+		logError(r.logger, "requeuer.process.dead", fmt.Errorf("no job name"), "namespace", r.namespace)
+	}
+	if err != nil {
+		logError(r.logger, "requeuer.process", err, "namespace", r.namespace)
 	}
-	return false
 }
 
 func (r *requeuer) loop() {
@@ -77,12 +62,10 @@ func (r *requeuer) loop() {
 			r.doneStoppingChan <- struct{}{}
 			return
 		case <-r.drainChan:
-			for r.process() {
-			}
+			r.process()
 			r.doneDrainingChan <- struct{}{}
 		case <-ticker:
-			for r.process() {
-			}
+			r.process()
 		}
 	}
 }
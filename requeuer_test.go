@@ -2,6 +2,7 @@ package work
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,7 +30,7 @@ func TestRequeue(t *testing.T) {
 
 	resetNowEpochSecondsMock()
 
-	re := newRequeuer(ns, pool, redisKeyScheduled(ns), []string{"wat", "foo", "bar"})
+	re := newRequeuer(ns, newRedisBackend(ns, pool, nil), ScheduledSet, []string{"wat", "foo", "bar"}, nil, nil)
 	re.start()
 	re.drain()
 	re.stop()
@@ -48,6 +49,36 @@ func TestRequeue(t *testing.T) {
 	assert.True(t, (j.EnqueuedAt+2) >= nowEpochSeconds())
 }
 
+func TestRequeueSecondScores(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	// Jobs scheduled by older versions are scored in epoch seconds
+	now := nowEpochSeconds()
+	for _, at := range []int64{now - 5, now + 60} {
+		rawJSON, _ := (&Job{Name: "wat", ID: makeIdentifier(), EnqueuedAt: now}).serialize()
+		_, err := conn.Do("ZADD", redisKeyScheduled(ns), at, rawJSON)
+		assert.NoError(t, err)
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.EnqueueAfter("wat", -time.Second, nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.EnqueueAfter("wat", time.Minute, nil)
+	assert.NoError(t, err)
+
+	requeued, dead, err := enqueuer.redis.RequeueDue(ScheduledSet, []string{"wat"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requeued)
+	assert.Equal(t, 0, dead)
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 2, zsetSize(pool, redisKeyScheduled(ns)))
+}
+
 func TestRequeueUnknown(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -64,7 +95,7 @@ func TestRequeueUnknown(t *testing.T) {
 	nowish := nowEpochSeconds()
 	setNowEpochSecondsMock(nowish)
 
-	re := newRequeuer(ns, pool, redisKeyScheduled(ns), []string{"bar"})
+	re := newRequeuer(ns, newRedisBackend(ns, pool, nil), ScheduledSet, []string{"bar"}, nil, nil)
 	re.start()
 	re.drain()
 	re.stop()
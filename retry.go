@@ -0,0 +1,129 @@
+package work
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Jitter is how the backoff before retrying a job is randomized,
+// so that jobs failing together aren't all retried at the same time.
+type Jitter int
+
+const (
+	// JitterNone uses the backoff as is.
+	JitterNone Jitter = iota
+	// JitterFull waits between none and all of the backoff.
+	JitterFull
+	// JitterEqual waits between half and all of the backoff.
+	JitterEqual
+)
+
+// RetryPolicy refines how failed jobs are retried, on top of MaxFails and Backoff.
+type RetryPolicy struct {
+	MaxAge     time.Duration // Don't retry jobs which would start over this long after they were first enqueued (default is no max)
+	MaxBackoff time.Duration // Cap on the backoff before retrying a job (default is no cap)
+	Jitter     Jitter        // How the backoff is randomized (default is JitterNone)
+}
+
+// backoff applies the policy to the backoff in seconds returned by a BackoffCalculator.
+func (p RetryPolicy) backoff(seconds int64) int64 {
+	if max := int64(p.MaxBackoff / time.Second); p.MaxBackoff > 0 && seconds > max {
+		seconds = max
+	}
+	if seconds <= 0 {
+		return 0
+	}
+
+	switch p.Jitter {
+	case JitterFull:
+		return rand.Int63n(seconds + 1)
+	case JitterEqual:
+		return seconds/2 + rand.Int63n(seconds-seconds/2+1)
+	}
+	return seconds
+}
+
+// NoRetry wraps err so that the job whose handler returned it isn't retried,
+// but sent straight to the dead queue (unless SkipDead).
+// NoRetry returns nil if err is nil.
+func NoRetry(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &noRetryError{err: err}
+}
+
+// RetryAfter wraps err so that the job whose handler returned it is retried after d instead of its usual backoff.
+// The job still counts as failed, so it's only retried as per MaxFails and RetryPolicy.MaxAge.
+// RetryAfter returns nil if err is nil.
+func RetryAfter(d time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{after: d, err: err}
+}
+
+// noRetryError wraps an error after which a job must not be retried.
+type noRetryError struct {
+	err error
+}
+
+func (e *noRetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *noRetryError) Unwrap() error {
+	return e.err
+}
+
+// retryAfterError wraps an error after which a job must be retried at a given time.
+type retryAfterError struct {
+	after time.Duration
+	err   error
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// retryAt returns when job, which failed with runErr, gets retried in epoch milliseconds,
+// and false if it doesn't get retried.
+func retryAt(jt *jobType, job *Job, runErr error) (int64, bool) {
+	if jt == nil || int64(jt.MaxFails)-job.Fails <= 0 {
+		return 0, false
+	}
+	var noRetry *noRetryError
+	if errors.As(runErr, &noRetry) {
+		return 0, false
+	}
+
+	now := nowEpochMilliseconds()
+	var at int64
+	var retryAfter *retryAfterError
+	if errors.As(runErr, &retryAfter) {
+		// Round up so the job isn't retried before it was asked to be
+		at = now + ceilMilliseconds(retryAfter.after)
+	} else {
+		at = now + jt.Retry.backoff(jt.calcBackoff(job))*1000
+	}
+
+	enqueuedAt := job.FirstEnqueuedAt
+	if enqueuedAt == 0 {
+		enqueuedAt = job.EnqueuedAt
+	}
+	if maxAge := jt.Retry.MaxAge; maxAge > 0 && at-enqueuedAt*1000 > maxAge.Milliseconds() {
+		return 0, false
+	}
+	return at, true
+}
+
+// Default algorithm returns a fastly increasing unboundedly fashion backoff counter.
+func defaultBackoffCalculator(job *Job) int64 {
+	fails := job.Fails
+	return (fails * fails * fails * fails) + 15 + (rand.Int63n(30) * (fails + 1))
+}
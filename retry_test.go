@@ -0,0 +1,80 @@
+package work
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryAt(t *testing.T) {
+	now := nowEpochSeconds()
+	setNowEpochSecondsMock(now)
+	defer resetNowEpochSecondsMock()
+
+	five := func(job *Job) int64 { return 5 }
+	jt := &jobType{Name: "wat", JobOptions: JobOptions{MaxFails: 3, Backoff: five}}
+	job := &Job{Name: "wat", EnqueuedAt: now, Fails: 1}
+	runErr := errors.New("sorry kid")
+
+	at, ok := retryAt(jt, job, runErr)
+	assert.True(t, ok)
+	assert.Equal(t, (now+5)*1000, at)
+
+	// Out of fails
+	_, ok = retryAt(jt, &Job{Name: "wat", EnqueuedAt: now, Fails: 3}, runErr)
+	assert.False(t, ok)
+	_, ok = retryAt(nil, job, runErr)
+	assert.False(t, ok)
+
+	// Typed errors, including wrapped ones
+	_, ok = retryAt(jt, job, NoRetry(runErr))
+	assert.False(t, ok)
+	_, ok = retryAt(jt, job, fmt.Errorf("wrapped: %w", NoRetry(runErr)))
+	assert.False(t, ok)
+	at, ok = retryAt(jt, job, RetryAfter(90*time.Second, runErr))
+	assert.True(t, ok)
+	assert.Equal(t, (now+90)*1000, at)
+	at, ok = retryAt(jt, job, fmt.Errorf("wrapped: %w", RetryAfter(1500*time.Millisecond, runErr)))
+	assert.True(t, ok)
+	assert.Equal(t, now*1000+1500, at)
+	assert.True(t, errors.Is(RetryAfter(time.Second, runErr), runErr))
+	assert.Equal(t, "sorry kid", NoRetry(runErr).Error())
+	assert.Nil(t, NoRetry(nil))
+	assert.Nil(t, RetryAfter(time.Second, nil))
+
+	// Max age
+	jt.Retry.MaxAge = time.Minute
+	_, ok = retryAt(jt, job, runErr)
+	assert.True(t, ok)
+	_, ok = retryAt(jt, &Job{Name: "wat", EnqueuedAt: now - 56, Fails: 1}, runErr)
+	assert.False(t, ok)
+	_, ok = retryAt(jt, job, RetryAfter(2*time.Minute, runErr))
+	assert.False(t, ok)
+	// EnqueuedAt is reset when a job is retried
+	_, ok = retryAt(jt, &Job{Name: "wat", EnqueuedAt: now, FirstEnqueuedAt: now - 56, Fails: 1}, runErr)
+	assert.False(t, ok)
+
+	// Max backoff
+	jt.Retry = RetryPolicy{MaxBackoff: 3 * time.Second}
+	at, ok = retryAt(jt, job, runErr)
+	assert.True(t, ok)
+	assert.Equal(t, (now+3)*1000, at)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	assert.EqualValues(t, 10, RetryPolicy{}.backoff(10))
+	assert.EqualValues(t, 4, RetryPolicy{MaxBackoff: 4 * time.Second}.backoff(10))
+	assert.EqualValues(t, 0, RetryPolicy{Jitter: JitterFull}.backoff(0))
+
+	for i := 0; i < 100; i++ {
+		b := RetryPolicy{Jitter: JitterFull}.backoff(10)
+		assert.True(t, b >= 0 && b <= 10, b)
+		b = RetryPolicy{Jitter: JitterEqual}.backoff(10)
+		assert.True(t, b >= 5 && b <= 10, b)
+		b = RetryPolicy{Jitter: JitterEqual, MaxBackoff: 4 * time.Second}.backoff(100)
+		assert.True(t, b >= 2 && b <= 4, b)
+	}
+}
@@ -10,7 +10,7 @@ import (
 // or we couldn't reflect correctly.
 // if we return an error,
 // it signals we want the job to be retried.
-func runJob(job *Job, ctxType reflect.Type, middleware []*middlewareHandler, jt *jobType) (returnCtx reflect.Value, returnError error) {
+func runJob(job *Job, ctxType reflect.Type, middleware []*middlewareHandler, jt *jobType, logger Logger) (returnCtx reflect.Value, returnError error) {
 	var next NextMiddlewareFunc
 	currentMiddleware := 0
 	returnCtx = reflect.New(ctxType)
@@ -48,7 +48,7 @@ func runJob(job *Job, ctxType reflect.Type, middleware []*middlewareHandler, jt
 			// of actual type "runtime.errorCString"
 			// Luckily, the err sprints nicely via fmt.
 			errorishError := fmt.Errorf("%v", panicErr)
-			logError("runJob.panic", errorishError)
+			logError(logger, "runJob.panic", errorishError, "job_name", job.Name, "job_id", job.ID)
 			returnError = errorishError
 		}
 	}()
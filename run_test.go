@@ -48,7 +48,7 @@ func TestRunBasicMiddleware(t *testing.T) {
 		Args: map[string]interface{}{"a": "foo"},
 	}
 
-	v, err := runJob(job, tstCtxType, middleware, jt)
+	v, err := runJob(job, tstCtxType, middleware, jt, nil)
 	assert.NoError(t, err)
 	c := v.Interface().(*tstCtx)
 	assert.Equal(t, "mw1mw2mw3h1foo", c.String())
@@ -77,7 +77,7 @@ func TestRunMiddlewarePanic(t *testing.T) {
 		Name: "foo",
 	}
 
-	_, err := runJob(job, tstCtxType, middleware, jt)
+	_, err := runJob(job, tstCtxType, middleware, jt, nil)
 	assert.Error(t, err)
 	assert.Equal(t, "dayam", err.Error())
 }
@@ -106,7 +106,7 @@ func TestRunHandlerPanic(t *testing.T) {
 		Name: "foo",
 	}
 
-	_, err := runJob(job, tstCtxType, middleware, jt)
+	_, err := runJob(job, tstCtxType, middleware, jt, nil)
 	assert.Error(t, err)
 	assert.Equal(t, "dayam", err.Error())
 }
@@ -134,7 +134,7 @@ func TestRunMiddlewareError(t *testing.T) {
 		Name: "foo",
 	}
 
-	_, err := runJob(job, tstCtxType, middleware, jt)
+	_, err := runJob(job, tstCtxType, middleware, jt, nil)
 	assert.Error(t, err)
 	assert.Equal(t, "mw1_err", err.Error())
 }
@@ -162,7 +162,7 @@ func TestRunHandlerError(t *testing.T) {
 		Name: "foo",
 	}
 
-	v, err := runJob(job, tstCtxType, middleware, jt)
+	v, err := runJob(job, tstCtxType, middleware, jt, nil)
 	assert.Error(t, err)
 	assert.Equal(t, "h1_err", err.Error())
 
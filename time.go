@@ -1,22 +1,56 @@
 package work
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
-var nowMock int64
+// nowMock is read by the workers while tests move the clock, so it's atomic.
+var nowMock atomic.Int64
+
+// minMillisecondsScore is the lowest score of the jobs scheduled or retried at a time in epoch milliseconds,
+// rather than in epoch seconds as with older versions: it's in 1973 in epoch milliseconds, but in 5138 in epoch seconds.
+const minMillisecondsScore = 100000000000
 
 func nowEpochSeconds() int64 {
-	if nowMock != 0 {
-		return nowMock
+	if mock := nowMock.Load(); mock != 0 {
+		return mock
 	}
 	return time.Now().Unix()
 }
 
+// nowEpochMilliseconds is nowEpochSeconds with millisecond precision.
+func nowEpochMilliseconds() int64 {
+	if mock := nowMock.Load(); mock != 0 {
+		return mock * 1000
+	}
+	return time.Now().UnixMilli()
+}
+
 func setNowEpochSecondsMock(t int64) {
-	nowMock = t
+	nowMock.Store(t)
 }
 
 func resetNowEpochSecondsMock() {
-	nowMock = 0
+	nowMock.Store(0)
+}
+
+// scoreToEpochSeconds returns the time a job is scheduled or retried at, in epoch seconds, from its score.
+func scoreToEpochSeconds(score int64) int64 {
+	if score >= minMillisecondsScore {
+		return score / 1000
+	}
+	return score
+}
+
+// ceilMilliseconds returns d in milliseconds, rounded up.
+func ceilMilliseconds(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// ceilSeconds returns d in seconds, rounded up.
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
 }
 
 // epochSecondsToTime convert epoch seconds to a time.
@@ -0,0 +1,94 @@
+package work
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// TypedHandler is a job handler that receives the job's arguments decoded into a T.
+type TypedHandler[T any] func(ctx context.Context, job *Job, args T) error
+
+// EnqueueTyped enqueues jobName with args encoded as the job's arguments.
+// args must encode to a JSON object, eg, a struct or a map with string keys.
+// The job can be handled by a handler registered with Handle.
+func EnqueueTyped[T any](e *Enqueuer, jobName string, args T) (*Job, error) {
+	m, err := encodeTypedArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return e.Enqueue(jobName, m)
+}
+
+// EnqueueInTyped enqueues jobName with args encoded as the job's arguments
+// in the scheduled job queue for execution in secondsFromNow seconds.
+// See EnqueueTyped for the requirements on args.
+func EnqueueInTyped[T any](e *Enqueuer, jobName string, secondsFromNow int64, args T) (*ScheduledJob, error) {
+	m, err := encodeTypedArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return e.EnqueueIn(jobName, secondsFromNow, m)
+}
+
+// Handle registers fn as the handler for jobName jobs as per the Job function.
+// Before fn runs, the job's arguments are decoded into a T.
+// If they can't be decoded, fn isn't called and the job is sent
+// straight to the dead queue (unless SkipDead) instead of being retried.
+func Handle[T any](wp *WorkerPool, jobName string, fn TypedHandler[T]) *WorkerPool {
+	return HandleWithOptions(wp, jobName, JobOptions{}, fn)
+}
+
+// HandleWithOptions registers fn as the handler for jobName jobs as per the Handle function,
+// but permits you to specify additional options as per the JobWithOptions function.
+func HandleWithOptions[T any](wp *WorkerPool, jobName string, jobOpts JobOptions, fn TypedHandler[T]) *WorkerPool {
+	return wp.JobWithOptions(jobName, jobOpts, func(job *Job) error {
+		args, err := decodeTypedArgs[T](job)
+		if err != nil {
+			return NoRetry(err)
+		}
+		return fn(job.Context(), job, args)
+	})
+}
+
+func encodeTypedArgs[T any](args T) (map[string]interface{}, error) {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// UseNumber keeps large integers intact until the job is serialized.
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("work: typed job arguments must encode to a JSON object: %w", err)
+	}
+	return m, nil
+}
+
+// decodeTypedArgs decodes the arguments of job into a T.
+// Fetched jobs are decoded from their raw JSON, so that numbers don't lose precision
+// by going through the float64 values of job.Args.
+func decodeTypedArgs[T any](job *Job) (T, error) {
+	var args T
+	var raw struct {
+		Args json.RawMessage `json:"args"`
+	}
+	if len(job.rawJSON) > 0 {
+		if err := json.Unmarshal(job.rawJSON, &raw); err != nil {
+			return args, err
+		}
+	} else {
+		var err error
+		if raw.Args, err = json.Marshal(job.Args); err != nil {
+			return args, err
+		}
+	}
+
+	if err := json.Unmarshal(raw.Args, &args); err != nil {
+		return args, fmt.Errorf("decoding arguments of job %s: %w", job.Name, err)
+	}
+	return args, nil
+}
@@ -0,0 +1,72 @@
+package work
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sendEmailArgs struct {
+	Addr   string `json:"addr"`
+	UserID int64  `json:"user_id"`
+}
+
+func TestEnqueueTyped(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	job, err := EnqueueTyped(enqueuer, "send_email", sendEmailArgs{Addr: "a@b.c", UserID: 9007199254740993})
+	assert.NoError(t, err)
+	assert.Equal(t, "send_email", job.Name)
+
+	j := jobOnQueue(pool, redisKeyJobs(ns, "send_email"))
+	assert.Equal(t, "a@b.c", j.ArgString("addr"))
+
+	args, err := decodeTypedArgs[sendEmailArgs](j)
+	assert.NoError(t, err)
+	assert.Equal(t, sendEmailArgs{Addr: "a@b.c", UserID: 9007199254740993}, args)
+
+	_, err = EnqueueTyped(enqueuer, "send_email", 3)
+	assert.Error(t, err)
+
+	scheduled, err := EnqueueInTyped(enqueuer, "send_email", 10, sendEmailArgs{Addr: "x@y.z"})
+	assert.NoError(t, err)
+	assert.Equal(t, "x@y.z", scheduled.Args["addr"])
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(ns)))
+}
+
+func TestHandleTyped(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var got []sendEmailArgs
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	Handle(wp, "send_email", func(ctx context.Context, job *Job, args sendEmailArgs) error {
+		assert.NotNil(t, ctx)
+		got = append(got, args)
+		return nil
+	})
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := EnqueueTyped(enqueuer, "send_email", sendEmailArgs{Addr: "a@b.c", UserID: 1})
+	assert.NoError(t, err)
+	// undecodable arguments go straight to the dead queue
+	_, err = enqueuer.Enqueue("send_email", Q{"addr": 7})
+	assert.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Equal(t, []sendEmailArgs{{Addr: "a@b.c", UserID: 1}}, got)
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(ns)))
+
+	_, job := jobOnZset(pool, redisKeyDead(ns))
+	assert.EqualValues(t, 1, job.Fails)
+	assert.Contains(t, job.LastErr, "decoding arguments of job send_email")
+}
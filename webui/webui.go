@@ -0,0 +1,308 @@
+// Package webui serves a JSON HTTP API and a static dashboard
+// to inspect and operate the jobs of a namespace through a work.Client.
+//
+// Endpoints:
+//
+//	GET  /queues
+//	POST /queues/{job_name}/pause
+//	POST /queues/{job_name}/resume
+//	GET  /worker_pools
+//	GET  /busy_workers
+//	GET  /retry_jobs?page=N
+//	GET  /scheduled_jobs?page=N
+//	GET  /dead_jobs?page=N
+//	POST /delete_dead_job/{died_at}/{job_id}
+//	POST /retry_dead_job/{died_at}/{job_id}
+//	POST /delete_all_dead_jobs
+//	POST /retry_all_dead_jobs
+//	POST /delete_retry_job/{retry_at}/{job_id}
+//	POST /delete_scheduled_job/{run_at}/{job_id}
+//
+// The POST requests must have the X-Requested-With header, which browsers don't let other sites send
+// without CORS, and if they have an Origin header, it must be the host of the request, against CSRF.
+//
+// Every other GET request is served from the embedded dashboard.
+package webui
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pchchv/work"
+)
+
+//go:embed assets
+var assets embed.FS
+
+type handler struct {
+	client *work.Client
+	mux    *http.ServeMux
+}
+
+type jobsPage struct {
+	Count int64       `json:"count"`
+	Jobs  interface{} `json:"jobs"`
+}
+
+// NewHandler returns an http.Handler serving the JSON API and the dashboard for client.
+func NewHandler(client *work.Client) http.Handler {
+	h := &handler{
+		client: client,
+		mux:    http.NewServeMux(),
+	}
+
+	static, err := fs.Sub(assets, "assets")
+	if err != nil {
+		panic(err)
+	}
+
+	h.mux.HandleFunc("/queues", get(h.queues))
+	h.mux.HandleFunc("/queues/", post(h.pauseOrResumeQueue))
+	h.mux.HandleFunc("/worker_pools", get(h.workerPools))
+	h.mux.HandleFunc("/busy_workers", get(h.busyWorkers))
+	h.mux.HandleFunc("/retry_jobs", get(h.retryJobs))
+	h.mux.HandleFunc("/scheduled_jobs", get(h.scheduledJobs))
+	h.mux.HandleFunc("/dead_jobs", get(h.deadJobs))
+	h.mux.HandleFunc("/delete_dead_job/", post(h.zsetJobAction(h.client.DeleteDeadJob)))
+	h.mux.HandleFunc("/retry_dead_job/", post(h.zsetJobAction(h.client.RetryDeadJob)))
+	h.mux.HandleFunc("/delete_retry_job/", post(h.zsetJobAction(h.client.DeleteRetryJob)))
+	h.mux.HandleFunc("/delete_scheduled_job/", post(h.zsetJobAction(h.client.DeleteScheduledJob)))
+	h.mux.HandleFunc("/delete_all_dead_jobs", post(h.action(h.client.DeleteAllDeadJobs)))
+	h.mux.HandleFunc("/retry_all_dead_jobs", post(h.action(h.client.RetryAllDeadJobs)))
+	h.mux.Handle("/", get(http.FileServer(http.FS(static)).ServeHTTP))
+	return h
+}
+
+func (h *handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(rw, r)
+}
+
+func (h *handler) queues(rw http.ResponseWriter, r *http.Request) {
+	queues, err := h.client.Queues()
+	render(rw, queues, err)
+}
+
+// pauseOrResumeQueue handles /queues/{job_name}/pause and /queues/{job_name}/resume.
+func (h *handler) pauseOrResumeQueue(rw http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/queues/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		renderError(rw, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	var err error
+	switch parts[1] {
+	case "pause":
+		err = h.client.PauseQueue(parts[0])
+	case "resume":
+		err = h.client.ResumeQueue(parts[0])
+	default:
+		renderError(rw, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	render(rw, map[string]string{"status": "ok"}, err)
+}
+
+func (h *handler) workerPools(rw http.ResponseWriter, r *http.Request) {
+	heartbeats, err := h.client.WorkerPoolHeartbeats()
+	render(rw, heartbeats, err)
+}
+
+func (h *handler) busyWorkers(rw http.ResponseWriter, r *http.Request) {
+	observations, err := h.client.WorkerObservations()
+	if err != nil {
+		render(rw, nil, err)
+		return
+	}
+
+	busy := make([]*work.WorkerObservation, 0, len(observations))
+	for _, ob := range observations {
+		if ob.IsBusy {
+			busy = append(busy, ob)
+		}
+	}
+	render(rw, busy, nil)
+}
+
+func (h *handler) retryJobs(rw http.ResponseWriter, r *http.Request) {
+	page, ok := parsePage(rw, r)
+	if !ok {
+		return
+	}
+
+	jobs, count, err := h.client.RetryJobs(page)
+	render(rw, &jobsPage{Count: count, Jobs: jobs}, err)
+}
+
+func (h *handler) scheduledJobs(rw http.ResponseWriter, r *http.Request) {
+	page, ok := parsePage(rw, r)
+	if !ok {
+		return
+	}
+
+	jobs, count, err := h.client.ScheduledJobs(page)
+	render(rw, &jobsPage{Count: count, Jobs: jobs}, err)
+}
+
+func (h *handler) deadJobs(rw http.ResponseWriter, r *http.Request) {
+	page, ok := parsePage(rw, r)
+	if !ok {
+		return
+	}
+
+	jobs, count, err := h.client.DeadJobs(page)
+	render(rw, &jobsPage{Count: count, Jobs: jobs}, err)
+}
+
+// zsetJobAction handles paths like /delete_dead_job/{score}/{job_id}
+// by calling fn with the score and the job ID.
+func (h *handler) zsetJobAction(fn func(int64, string) error) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[2] == "" {
+			renderError(rw, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+
+		score, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			renderError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		render(rw, map[string]string{"status": "ok"}, fn(score, parts[2]))
+	}
+}
+
+func (h *handler) action(fn func() error) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		render(rw, map[string]string{"status": "ok"}, fn())
+	}
+}
+
+func get(fn http.HandlerFunc) http.HandlerFunc {
+	return method(http.MethodGet, fn)
+}
+
+func post(fn http.HandlerFunc) http.HandlerFunc {
+	return method(http.MethodPost, func(rw http.ResponseWriter, r *http.Request) {
+		if !sameOrigin(r) {
+			renderError(rw, http.StatusForbidden, errors.New("cross-origin request"))
+			return
+		}
+		fn(rw, r)
+	})
+}
+
+// sameOrigin reports whether r was sent by the dashboard rather than by another site:
+// it has the X-Requested-With header, which can't be sent cross-origin without a CORS preflight,
+// and its Origin header, if any, is its host.
+func sameOrigin(r *http.Request) bool {
+	if r.Header.Get("X-Requested-With") == "" {
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func method(m string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			rw.Header().Set("Allow", m)
+			renderError(rw, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		fn(rw, r)
+	}
+}
+
+func parsePage(rw http.ResponseWriter, r *http.Request) (uint, bool) {
+	s := r.URL.Query().Get("page")
+	if s == "" {
+		return 1, true
+	}
+
+	page, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		renderError(rw, http.StatusBadRequest, err)
+		return 0, false
+	}
+	return uint(page), true
+}
+
+func render(rw http.ResponseWriter, v interface{}, err error) {
+	if errors.Is(err, work.ErrNotDeleted) || errors.Is(err, work.ErrNotRetried) {
+		renderError(rw, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		renderError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	renderJSON(rw, http.StatusOK, v)
+}
+
+func renderError(rw http.ResponseWriter, status int, err error) {
+	renderJSON(rw, status, map[string]string{"error": err.Error()})
+}
+
+func renderJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+// Server serves NewHandler on a TCP address.
+type Server struct {
+	server   *http.Server
+	hostPort string
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a Server for the specified namespace and pool that will listen on hostPort (eg, ":5040").
+func NewServer(namespace string, pool work.Pool, hostPort string) *Server {
+	return &Server{
+		hostPort: hostPort,
+		server: &http.Server{
+			Addr:              hostPort,
+			Handler:           NewHandler(work.NewClient(namespace, pool)),
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Start starts listening and serving in the background.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.hostPort)
+	if err != nil {
+		return err
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.server.Serve(ln)
+	}()
+	return nil
+}
+
+// Stop gracefully shuts the server down and waits for it to return.
+func (s *Server) Stop() error {
+	err := s.server.Shutdown(context.Background())
+	s.wg.Wait()
+	return err
+}
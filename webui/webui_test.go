@@ -0,0 +1,282 @@
+package webui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pchchv/work"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestContext struct{}
+
+func TestWebUIStartStop(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work_webui"
+	cleanKeyspace(ns, pool)
+
+	s := NewServer(ns, pool, ":6666")
+	assert.NoError(t, s.Start())
+	assert.NoError(t, s.Stop())
+}
+
+func TestWebUIQueues(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work_webui"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := work.NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue("wat", nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue("foo", nil)
+	assert.NoError(t, err)
+
+	h := NewHandler(work.NewClient(ns, pool))
+
+	rec := do(h, "GET", "/queues")
+	assert.Equal(t, 200, rec.Code)
+	var queues []*work.Queue
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &queues))
+	if assert.Equal(t, 2, len(queues)) {
+		assert.Equal(t, "foo", queues[0].JobName)
+		assert.EqualValues(t, 1, queues[0].Count)
+		assert.False(t, queues[0].Paused)
+	}
+
+	rec = do(h, "POST", "/queues/foo/pause")
+	assert.Equal(t, 200, rec.Code)
+	rec = do(h, "GET", "/queues")
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &queues))
+	assert.True(t, queues[0].Paused)
+
+	rec = do(h, "POST", "/queues/foo/resume")
+	assert.Equal(t, 200, rec.Code)
+	rec = do(h, "GET", "/queues")
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &queues))
+	assert.False(t, queues[0].Paused)
+
+	rec = do(h, "POST", "/queues/foo/explode")
+	assert.Equal(t, 404, rec.Code)
+	rec = do(h, "POST", "/queues")
+	assert.Equal(t, 405, rec.Code)
+}
+
+func TestWebUIWorkerPoolsAndBusyWorkers(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work_webui"
+	cleanKeyspace(ns, pool)
+
+	wp := work.NewWorkerPool(TestContext{}, 2, ns, pool)
+	started := make(chan struct{})
+	done := make(chan struct{})
+	wp.Job("wat", func(job *work.Job) error {
+		close(started)
+		<-done
+		return nil
+	})
+	wp.Start()
+	defer wp.Stop()
+
+	enqueuer := work.NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue("wat", work.Q{"a": 1})
+	assert.NoError(t, err)
+	<-started
+	time.Sleep(10 * time.Millisecond)
+
+	h := NewHandler(work.NewClient(ns, pool))
+
+	rec := do(h, "GET", "/worker_pools")
+	assert.Equal(t, 200, rec.Code)
+	var heartbeats []*work.WorkerPoolHeartbeat
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &heartbeats))
+	if assert.Equal(t, 1, len(heartbeats)) {
+		assert.Equal(t, []string{"wat"}, heartbeats[0].JobNames)
+		assert.EqualValues(t, 2, heartbeats[0].Concurrency)
+	}
+
+	rec = do(h, "GET", "/busy_workers")
+	assert.Equal(t, 200, rec.Code)
+	var observations []*work.WorkerObservation
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &observations))
+	if assert.Equal(t, 1, len(observations)) {
+		assert.Equal(t, "wat", observations[0].JobName)
+		assert.Equal(t, `{"a":1}`, observations[0].ArgsJSON)
+	}
+	close(done)
+}
+
+func TestWebUIDeadJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work_webui"
+	cleanKeyspace(ns, pool)
+
+	wp := work.NewWorkerPool(TestContext{}, 2, ns, pool)
+	wp.JobWithOptions("wat", work.JobOptions{MaxFails: 1}, func(job *work.Job) error {
+		return errors.New("ohno")
+	})
+	wp.Start()
+
+	enqueuer := work.NewEnqueuer(ns, pool)
+	for i := 0; i < 3; i++ {
+		_, err := enqueuer.Enqueue("wat", work.Q{"i": i})
+		assert.NoError(t, err)
+	}
+	wp.Drain()
+	wp.Stop()
+
+	h := NewHandler(work.NewClient(ns, pool))
+
+	rec := do(h, "GET", "/dead_jobs?page=1")
+	assert.Equal(t, 200, rec.Code)
+	var page struct {
+		Count int64           `json:"count"`
+		Jobs  []*work.DeadJob `json:"jobs"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.EqualValues(t, 3, page.Count)
+	assert.Equal(t, 3, len(page.Jobs))
+
+	rec = do(h, "GET", "/dead_jobs?page=wat")
+	assert.Equal(t, 400, rec.Code)
+
+	job := page.Jobs[0]
+	rec = do(h, "POST", fmt.Sprintf("/delete_dead_job/%d/%s", job.DiedAt, job.ID))
+	assert.Equal(t, 200, rec.Code)
+	rec = do(h, "POST", fmt.Sprintf("/delete_dead_job/%d/%s", job.DiedAt, job.ID))
+	assert.Equal(t, 404, rec.Code)
+	rec = do(h, "POST", "/delete_dead_job/abc/"+job.ID)
+	assert.Equal(t, 400, rec.Code)
+
+	job = page.Jobs[1]
+	rec = do(h, "POST", fmt.Sprintf("/retry_dead_job/%d/%s", job.DiedAt, job.ID))
+	assert.Equal(t, 200, rec.Code)
+	assert.EqualValues(t, 1, listSize(pool, ns+":jobs:wat"))
+
+	rec = do(h, "POST", "/retry_all_dead_jobs")
+	assert.Equal(t, 200, rec.Code)
+	assert.EqualValues(t, 2, listSize(pool, ns+":jobs:wat"))
+
+	rec = do(h, "POST", "/delete_all_dead_jobs")
+	assert.Equal(t, 200, rec.Code)
+	rec = do(h, "GET", "/dead_jobs")
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.EqualValues(t, 0, page.Count)
+}
+
+func TestWebUIScheduledAndRetryJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work_webui"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := work.NewEnqueuer(ns, pool)
+	scheduled, err := enqueuer.EnqueueIn("wat", 300, nil)
+	assert.NoError(t, err)
+
+	h := NewHandler(work.NewClient(ns, pool))
+
+	rec := do(h, "GET", "/scheduled_jobs")
+	assert.Equal(t, 200, rec.Code)
+	var page struct {
+		Count int64                `json:"count"`
+		Jobs  []*work.ScheduledJob `json:"jobs"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.EqualValues(t, 1, page.Count)
+
+	rec = do(h, "POST", fmt.Sprintf("/delete_scheduled_job/%d/%s", scheduled.RunAt, scheduled.ID))
+	assert.Equal(t, 200, rec.Code)
+
+	rec = do(h, "GET", "/retry_jobs")
+	assert.Equal(t, 200, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"count":0`)
+}
+
+func TestWebUIAssets(t *testing.T) {
+	h := NewHandler(work.NewClient("work_webui", newTestPool(":6379")))
+
+	rec := do(h, "GET", "/")
+	assert.Equal(t, 200, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), "<title>work</title>"))
+}
+
+func TestWebUICrossOrigin(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work_webui"
+	cleanKeyspace(ns, pool)
+
+	h := NewHandler(work.NewClient(ns, pool))
+
+	// Without X-Requested-With, as a form posted from another site
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/queues/foo/pause", nil))
+	assert.Equal(t, 403, rec.Code)
+
+	// From another origin
+	req := httptest.NewRequest("POST", "/queues/foo/pause", nil)
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, 403, rec.Code)
+
+	// From the dashboard
+	req = httptest.NewRequest("POST", "/queues/foo/pause", nil)
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	req.Header.Set("Origin", "http://"+req.Host)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, 200, rec.Code)
+}
+
+func do(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func newTestPool(addr string) *redis.Pool {
+	return &redis.Pool{
+		MaxActive:   10,
+		MaxIdle:     10,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr)
+		},
+		Wait: true,
+	}
+}
+
+func cleanKeyspace(namespace string, pool *redis.Pool) {
+	conn := pool.Get()
+	defer conn.Close()
+
+	keys, err := redis.Strings(conn.Do("KEYS", namespace+"*"))
+	if err != nil {
+		panic("could not get keys: " + err.Error())
+	}
+	for _, k := range keys {
+		if _, err := conn.Do("DEL", k); err != nil {
+			panic("could not del: " + err.Error())
+		}
+	}
+}
+
+func listSize(pool *redis.Pool, key string) int64 {
+	conn := pool.Get()
+	defer conn.Close()
+
+	v, err := redis.Int64(conn.Do("LLEN", key))
+	if err != nil {
+		panic("could not get list length: " + err.Error())
+	}
+	return v
+}
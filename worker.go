@@ -1,53 +1,69 @@
 package work
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/gomodule/redigo/redis"
 )
 
-const fetchKeysPerJobType = 6
-
 var sleepBackoffsInMilliseconds = []int64{0, 10, 100, 1000, 5000}
 
-type terminateOp func(conn redis.Conn)
-
 type worker struct {
-	workerID         string
-	poolID           string
-	namespace        string
-	pool             *redis.Pool
-	jobTypes         map[string]*jobType
-	sleepBackoffs    []int64
-	middleware       []*middlewareHandler
-	contextType      reflect.Type
-	redisFetchScript *redis.Script
-	sampler          prioritySampler
+	workerID          string
+	poolID            string
+	namespace         string
+	backend           Backend
+	jobTypes          map[string]*jobType
+	sleepBackoffs     []int64
+	logger            Logger
+	metrics           Metrics
+	middleware        []*middlewareHandler
+	contextType       reflect.Type
+	sampler           prioritySampler
+	jobNames          []string       // the job names of sampler, in the order they were sampled in
+	priorities        *jobPriorities // set by the worker pool
+	prioritiesVersion uint64
 	*observer
+	ctx              context.Context // cancelled when the worker is stopped
+	cancel           context.CancelFunc
+	stopping         atomic.Bool // set when the worker is stopped, so that it doesn't fetch any more jobs
+	inFlightMtx      sync.Mutex
+	inFlight         *Job               // the job being processed, as fetched
+	handedOff        bool               // set if inFlight was put back on its queue while being processed
+	cancelJob        context.CancelFunc // cancels the context of inFlight
+	cancelled        bool               // set if inFlight was cancelled with Client.CancelJob
+	pendingStop      chan struct{}      // closed once the stop that timed out in stopWithContext is done
 	stopChan         chan struct{}
 	doneStoppingChan chan struct{}
 	drainChan        chan struct{}
 	doneDrainingChan chan struct{}
 }
 
-func newWorker(namespace string, poolID string, pool *redis.Pool, contextType reflect.Type, middleware []*middlewareHandler, jobTypes map[string]*jobType, sleepBackoffs []int64) *worker {
+func newWorker(namespace string, poolID string, backend Backend, contextType reflect.Type, middleware []*middlewareHandler, jobTypes map[string]*jobType, sleepBackoffs []int64, logger Logger, metrics Metrics) *worker {
 	workerID := makeIdentifier()
-	ob := newObserver(namespace, pool, workerID)
+	ob := newObserver(namespace, backend, workerID, logger)
 
 	if len(sleepBackoffs) == 0 {
 		sleepBackoffs = sleepBackoffsInMilliseconds
 	}
 
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+
 	w := &worker{
 		workerID:      workerID,
 		poolID:        poolID,
 		namespace:     namespace,
-		pool:          pool,
+		backend:       backend,
 		contextType:   contextType,
 		sleepBackoffs: sleepBackoffs,
+		logger:        logger,
+		metrics:       metrics,
 
 		observer: ob,
 
@@ -58,6 +74,7 @@ func newWorker(namespace string, poolID string, pool *redis.Pool, contextType re
 		doneDrainingChan: make(chan struct{}),
 	}
 
+	w.ctx, w.cancel = context.WithCancel(context.Background())
 	w.updateMiddlewareAndJobTypes(middleware, jobTypes)
 
 	return w
@@ -66,185 +83,248 @@ func newWorker(namespace string, poolID string, pool *redis.Pool, contextType re
 // note: can't be called while the thing is started.
 func (w *worker) updateMiddlewareAndJobTypes(middleware []*middlewareHandler, jobTypes map[string]*jobType) {
 	w.middleware = middleware
+	w.jobTypes = jobTypes
+	w.resetSampler()
+}
+
+// resetSampler samples the job types of w by their priority,
+// or by the priority they were given with Client.SetJobPriority.
+func (w *worker) resetSampler() {
+	var overrides map[string]uint
+	if w.priorities != nil {
+		overrides, w.prioritiesVersion = w.priorities.get()
+	}
+
 	sampler := prioritySampler{}
-	for _, jt := range jobTypes {
-		sampler.add(jt.Priority,
-			redisKeyJobs(w.namespace, jt.Name),
-			redisKeyJobsInProgress(w.namespace, w.poolID, jt.Name),
-			redisKeyJobsPaused(w.namespace, jt.Name),
-			redisKeyJobsLock(w.namespace, jt.Name),
-			redisKeyJobsLockInfo(w.namespace, jt.Name),
-			redisKeyJobsConcurrency(w.namespace, jt.Name))
+	for _, jt := range w.jobTypes {
+		priority := jt.Priority
+		if p, ok := overrides[jt.Name]; ok {
+			priority = p
+		}
+		sampler.add(priority, jt.Name)
 	}
 	w.sampler = sampler
-	w.jobTypes = jobTypes
-	w.redisFetchScript = redis.NewScript(len(jobTypes)*fetchKeysPerJobType, redisLuaFetchJob)
+	w.jobNames = make([]string, len(sampler.samples))
 }
 
 func (w *worker) start() {
+	w.waitPendingStop()
+	w.stopping.Store(false)
 	go w.loop()
 	go w.observer.start()
 }
 
 func (w *worker) stop() {
+	w.stopping.Store(true)
+	w.cancel()
 	w.stopChan <- struct{}{}
 	<-w.doneStoppingChan
-	w.observer.drain()
-	w.observer.stop()
+	w.afterStop()
 }
 
-func (w *worker) drain() {
-	w.drainChan <- struct{}{}
-	<-w.doneDrainingChan
-	w.observer.drain()
+// stopWithContext stops w as per stop, but lets the job it's processing run until ctx is done.
+// Then the job's context is cancelled and the job is put back on its queue.
+// In that case, it returns ctx.Err() without waiting for the job's handler to return.
+func (w *worker) stopWithContext(ctx context.Context) error {
+	w.stopping.Store(true)
+	cancel := w.cancel
+	done := make(chan struct{})
+	go func() {
+		w.stopChan <- struct{}{}
+		<-w.doneStoppingChan
+		cancel()
+		w.afterStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		w.requeueInFlight()
+		w.pendingStop = done
+		return ctx.Err()
+	}
 }
 
-func (w *worker) fetchJob() (*Job, error) {
-	// resort queues
-	// NOTE: could optimize this to only resort every second, or something.
-	w.sampler.sample()
-	numKeys := len(w.sampler.samples) * fetchKeysPerJobType
-	scriptArgs := make([]interface{}, 0, numKeys+1)
-
-	for _, s := range w.sampler.samples {
-		scriptArgs = append(scriptArgs, s.redisJobs, s.redisJobsInProg, s.redisJobsPaused, s.redisJobsLock, s.redisJobsLockInfo, s.redisJobsMaxConcurrency) // KEYS[1-6 * N]
-	}
-	scriptArgs = append(scriptArgs, w.poolID) // ARGV[1]
-	conn := w.pool.Get()
-	defer conn.Close()
-
-	values, err := redis.Values(w.redisFetchScript.Do(conn, scriptArgs...))
-	if err == redis.ErrNil {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
+// waitPendingStop waits for the stop that timed out in stopWithContext, if any, to be done,
+// ie, for the handler of the job that was being processed to return.
+// Until then, the loop of the worker hasn't exited, so it can't be started again.
+func (w *worker) waitPendingStop() {
+	if w.pendingStop == nil {
+		return
 	}
+	<-w.pendingStop
+	w.pendingStop = nil
+}
 
-	if len(values) != 3 {
-		return nil, fmt.Errorf("need 3 elements back")
-	}
+func (w *worker) afterStop() {
+	// the loop has exited, so the context can be renewed for the next start
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.observer.drain()
+	w.observer.stop()
+}
 
-	rawJSON, ok := values[0].([]byte)
-	if !ok {
-		return nil, fmt.Errorf("response message not bytes")
+// requeueInFlight puts the job being processed back on its queue, so that another worker can run it.
+// The worker discards the outcome of the job once its handler returns.
+func (w *worker) requeueInFlight() {
+	w.inFlightMtx.Lock()
+	job := w.inFlight
+	if job != nil {
+		w.inFlight = nil
+		w.handedOff = true
 	}
+	w.inFlightMtx.Unlock()
 
-	dequeuedFrom, ok := values[1].([]byte)
-	if !ok {
-		return nil, fmt.Errorf("response queue not bytes")
+	if job == nil {
+		return
 	}
 
-	inProgQueue, ok := values[2].([]byte)
-	if !ok {
-		return nil, fmt.Errorf("response in prog not bytes")
+	if err := w.backend.Requeue(w.poolID, job); err != nil {
+		logError(w.logger, "worker.requeue_in_flight", err, w.jobFields(job)...)
 	}
+}
 
-	job, err := newJob(rawJSON, dequeuedFrom, inProgQueue)
-	if err != nil {
-		return nil, err
-	}
-	return job, nil
+// finishInFlight reports whether the job being processed can be terminated,
+// ie, it wasn't put back on its queue by requeueInFlight.
+func (w *worker) finishInFlight() bool {
+	w.inFlightMtx.Lock()
+	defer w.inFlightMtx.Unlock()
+
+	handedOff := w.handedOff
+	w.inFlight = nil
+	w.handedOff = false
+	w.cancelJob = nil
+	w.cancelled = false
+	return !handedOff
 }
 
-func (w *worker) getAndDeleteUniqueJob(job *Job) *Job {
-	var uniqueKey string
-	var err error
-	if job.UniqueKey != "" {
-		uniqueKey = job.UniqueKey
-	} else { // For jobs put in queue prior to this change. In the future this can be deleted as there will always be a UniqueKey
-		uniqueKey, err = redisKeyUniqueJob(w.namespace, job.Name, job.Args)
-		if err != nil {
-			logError("worker.delete_unique_job.key", err)
-			return nil
-		}
+// inFlightJobID returns the ID of the job being processed, if any.
+func (w *worker) inFlightJobID() string {
+	w.inFlightMtx.Lock()
+	defer w.inFlightMtx.Unlock()
+
+	if w.inFlight == nil || w.cancelJob == nil {
+		return ""
 	}
+	return w.inFlight.ID
+}
 
-	conn := w.pool.Get()
-	defer conn.Close()
+// cancelInFlight cancels the context of the job being processed if it's the one with jobID.
+func (w *worker) cancelInFlight(jobID string) {
+	w.inFlightMtx.Lock()
+	defer w.inFlightMtx.Unlock()
 
-	rawJSON, err := redis.Bytes(conn.Do("GET", uniqueKey))
-	if err != nil {
-		logError("worker.delete_unique_job.get", err)
-		return nil
+	if w.inFlight != nil && w.inFlight.ID == jobID && w.cancelJob != nil {
+		w.cancelled = true
+		w.cancelJob()
 	}
+}
 
-	_, err = conn.Do("DEL", uniqueKey)
-	if err != nil {
-		logError("worker.delete_unique_job.del", err)
-		return nil
-	}
+func (w *worker) drain() {
+	w.drainChan <- struct{}{}
+	<-w.doneDrainingChan
+	w.observer.drain()
+}
 
-	// Previous versions did not support updated arguments and just set key to 1, so in these cases we should do nothing.
-	// In the future this can be deleted, as we will always be getting arguments from here
-	if string(rawJSON) == "1" {
-		return nil
+func (w *worker) fetchJob() (*Job, error) {
+	if w.priorities != nil {
+		if _, version := w.priorities.get(); version != w.prioritiesVersion {
+			w.resetSampler()
+		}
 	}
 
-	// The job pulled off the queue was just a placeholder with no args, so replace it
-	jobWithArgs, err := newJob(rawJSON, job.dequeuedFrom, job.inProgQueue)
-	if err != nil {
-		logError("worker.delete_unique_job.updated_job", err)
-		return nil
+	// resort queues
+	// NOTE: could optimize this to only resort every second, or something.
+	for i, sample := range w.sampler.sample() {
+		w.jobNames[i] = sample.jobName
 	}
-	return jobWithArgs
+	return w.backend.Fetch(w.poolID, w.jobNames)
 }
 
-func (w *worker) removeJobFromInProgress(job *Job, fate terminateOp) {
-	conn := w.pool.Get()
-	defer conn.Close()
-
-	conn.Send("MULTI")
-	conn.Send("LREM", job.inProgQueue, 1, job.rawJSON)
-	conn.Send("DECR", redisKeyJobsLock(w.namespace, job.Name))
-	conn.Send("HINCRBY", redisKeyJobsLockInfo(w.namespace, job.Name), w.poolID, -1)
-	fate(conn)
-	if _, err := conn.Do("EXEC"); err != nil {
-		logError("worker.remove_job_from_in_progress.lrem", err)
+// terminate removes job from the jobs in progress once its handler returned runErr,
+// retrying it or moving it to the dead jobs if it failed.
+// A cancelled job is neither retried nor moved to the dead jobs.
+func (w *worker) terminate(jt *jobType, job *Job, runErr error) error {
+	if runErr == nil {
+		return w.backend.Ack(w.poolID, job)
+	}
+	if runErr == ErrJobCancelled {
+		return w.backend.Dead(w.poolID, job, true)
+	}
+	if at, ok := retryAt(jt, job, runErr); ok {
+		w.metrics.JobRetried(job.Name)
+		return w.backend.Retry(w.poolID, job, at)
 	}
+	if jt != nil && jt.SkipDead {
+		return w.backend.Dead(w.poolID, job, true)
+	}
+	w.metrics.JobDead(job.Name)
+	return w.backend.Dead(w.poolID, job, false)
 }
 
-func (w *worker) jobFate(jt *jobType, job *Job) terminateOp {
-	if jt != nil {
-		failsRemaining := int64(jt.MaxFails) - job.Fails
-		if failsRemaining > 0 {
-			return terminateAndRetry(w, jt, job)
-		}
-		if jt.SkipDead {
-			return terminateOnly
-		}
+// jobFields returns the structured logging fields identifying job.
+func (w *worker) jobFields(job *Job) []interface{} {
+	return []interface{}{"namespace", w.namespace, "job_name", job.Name, "job_id", job.ID, "worker_pool_id", w.poolID}
+}
+
+// jobContext returns the context to run a job of type jt with,
+// derived from the worker's context and bounded by jt.Timeout if set.
+func (w *worker) jobContext(jt *jobType) (context.Context, context.CancelFunc) {
+	if jt.Timeout > 0 {
+		return context.WithTimeout(w.ctx, jt.Timeout)
 	}
-	return terminateAndDead(w, job)
+	return context.WithCancel(w.ctx)
 }
 
 func (w *worker) processJob(job *Job) {
 	var runErr error
-	if job.Unique {
-		updatedJob := w.getAndDeleteUniqueJob(job)
-		// This is to support the old way of doing it, where we used the job off the queue and just deleted the unique key
-		// Going forward the job on the queue will always be just a placeholder, and we will be replacing it with the
-		// updated job extracted here
-		if updatedJob != nil {
-			job = updatedJob
-		}
-	}
-
 	jt := w.jobTypes[job.Name]
-	if jt == nil {
+	if job.cancelled {
+		runErr = ErrJobCancelled
+	} else if jt == nil {
 		runErr = fmt.Errorf("stray job: no handler")
-		logError("process_job.stray", runErr)
+		logError(w.logger, "process_job.stray", runErr, w.jobFields(job)...)
 	} else {
+		ctx, cancel := w.jobContext(jt)
+		job.ctx = ctx
+		w.inFlightMtx.Lock()
+		w.cancelJob = cancel
+		w.inFlightMtx.Unlock()
 		w.observeStarted(job.Name, job.ID, job.Args)
+		w.metrics.JobStarted(job.Name)
 		job.observer = w.observer // for Checkin
-		_, runErr = runJob(job, w.contextType, w.middleware, jt)
+		startedAt := time.Now()
+		_, runErr = runJob(job, w.contextType, w.middleware, jt, w.logger)
+		w.inFlightMtx.Lock()
+		cancelled := w.cancelled
+		w.inFlightMtx.Unlock()
+		if runErr != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			runErr = ErrJobTimeout
+		} else if runErr != nil && cancelled {
+			runErr = ErrJobCancelled
+		}
+		cancel()
+		if runErr != nil {
+			w.metrics.JobFailed(job.Name, time.Since(startedAt))
+		} else {
+			w.metrics.JobSucceeded(job.Name, time.Since(startedAt))
+		}
 		w.observeDone(job.Name, job.ID, runErr)
 	}
 
-	fate := terminateOnly
+	if !w.finishInFlight() {
+		// the job was put back on its queue when the worker was stopped
+		return
+	}
+
 	if runErr != nil {
 		job.failed(runErr)
-		fate = w.jobFate(jt, job)
 	}
-	w.removeJobFromInProgress(job, fate)
+	if err := w.terminate(jt, job, runErr); err != nil {
+		logError(w.logger, "worker.terminate", err, w.jobFields(job)...)
+	}
 }
 
 func (w *worker) loop() {
@@ -264,11 +344,20 @@ func (w *worker) loop() {
 			drained = true
 			timer.Reset(0)
 		case <-timer.C:
+			if w.stopping.Load() {
+				// wait for stopChan
+				continue
+			}
+			fetchStartedAt := time.Now()
 			job, err := w.fetchJob()
+			w.metrics.Fetched(time.Since(fetchStartedAt))
 			if err != nil {
-				logError("worker.fetch", err)
+				logError(w.logger, "worker.fetch", err, "namespace", w.namespace, "worker_pool_id", w.poolID)
 				timer.Reset(10 * time.Millisecond)
 			} else if job != nil {
+				w.inFlightMtx.Lock()
+				w.inFlight = job
+				w.inFlightMtx.Unlock()
 				w.processJob(job)
 				consequtiveNoJobs = 0
 				timer.Reset(0)
@@ -287,39 +376,3 @@ func (w *worker) loop() {
 		}
 	}
 }
-
-// Default algorithm returns a fastly increasing unboundedly fashion backoff counter.
-func defaultBackoffCalculator(job *Job) int64 {
-	fails := job.Fails
-	return (fails * fails * fails * fails) + 15 + (rand.Int63n(30) * (fails + 1))
-}
-
-func terminateOnly(_ redis.Conn) {
-	return
-}
-
-func terminateAndRetry(w *worker, jt *jobType, job *Job) terminateOp {
-	rawJSON, err := job.serialize()
-	if err != nil {
-		logError("worker.terminate_and_retry.serialize", err)
-		return terminateOnly
-	}
-	return func(conn redis.Conn) {
-		conn.Send("ZADD", redisKeyRetry(w.namespace), nowEpochSeconds()+jt.calcBackoff(job), rawJSON)
-	}
-}
-
-func terminateAndDead(w *worker, job *Job) terminateOp {
-	rawJSON, err := job.serialize()
-	if err != nil {
-		logError("worker.terminate_and_dead.serialize", err)
-		return terminateOnly
-	}
-	return func(conn redis.Conn) {
-		// NOTE: sidekiq limits the # of jobs: only keep jobs for 6 months, and only keep a max # of jobs
-		// The max # of jobs seems really horrible. Seems like operations should be on top of it.
-		// conn.Send("ZREMRANGEBYSCORE", redisKeyDead(w.namespace), "-inf", now - keepInterval)
-		// conn.Send("ZREMRANGEBYRANK", redisKeyDead(w.namespace), 0, -maxJobs)
-		conn.Send("ZADD", redisKeyDead(w.namespace), nowEpochSeconds(), rawJSON)
-	}
-}
@@ -1,13 +1,12 @@
 package work
 
 import (
+	"context"
 	"reflect"
 	"sort"
 	"strings"
 	"sync"
-
-	"github.com/gomodule/redigo/redis"
-	"github.com/robfig/cron/v3"
+	"time"
 )
 
 // You may provide your own backoff function for retrying failed jobs or use the builtin one.
@@ -23,6 +22,24 @@ type JobOptions struct {
 	SkipDead       bool              // If true, don't send failed jobs to the dead queue when retries are exhausted.
 	MaxConcurrency uint              // Max number of jobs to keep in flight (default is 0, meaning no max)
 	Backoff        BackoffCalculator // If not set, uses the default backoff algorithm
+	Timeout        time.Duration     // If set, Job.Context() is cancelled after the handler runs this long
+	RateLimit      RateLimit         // Max number of jobs to start per interval across all worker pools (default is no limit)
+	Retry          RetryPolicy       // Max age, backoff cap and jitter of retries (default is to retry as per MaxFails and Backoff only)
+}
+
+// RateLimit caps how many jobs of a type are started per interval across all worker pools.
+// Jobs over the limit stay in their queue until they can be started.
+// Up to Limit jobs can be started at once after a quiet period,
+// after which jobs are started at an even rate of Limit per Interval.
+// Intervals under a millisecond are rounded up to one millisecond.
+type RateLimit struct {
+	Limit    uint
+	Interval time.Duration
+}
+
+// intervalMilliseconds returns the interval of the rate limit in milliseconds, one at least.
+func (rl RateLimit) intervalMilliseconds() int64 {
+	return max(rl.Interval.Milliseconds(), 1)
 }
 
 // GenericHandler is a job handler without any custom context.
@@ -44,7 +61,11 @@ type middlewareHandler struct {
 
 // WorkerPoolOptions can be passed to NewWorkerPoolWithOptions.
 type WorkerPoolOptions struct {
-	SleepBackoffs []int64 // Sleep backoffs in milliseconds
+	SleepBackoffs []int64       // Sleep backoffs in milliseconds
+	Logger        Logger        // If not set, errors are printed to stdout
+	Metrics       Metrics       // If not set, no metrics are collected
+	MaxDeadJobs   uint          // If set, the dead queue is pruned down to this many jobs every few minutes, oldest first (needs Redis)
+	MaxDeadAge    time.Duration // If set, dead jobs are pruned every few minutes once they died this long ago (needs Redis)
 }
 
 type jobType struct {
@@ -55,6 +76,15 @@ type jobType struct {
 	DynamicHandler reflect.Value
 }
 
+// jobOptions returns the options of jobTypes by job name.
+func jobOptions(jobTypes map[string]*jobType) map[string]JobOptions {
+	jobOpts := make(map[string]JobOptions, len(jobTypes))
+	for jobName, jt := range jobTypes {
+		jobOpts[jobName] = jt.JobOptions
+	}
+	return jobOpts
+}
+
 func (jt *jobType) calcBackoff(j *Job) int64 {
 	if jt.Backoff == nil {
 		return defaultBackoffCalculator(j)
@@ -73,8 +103,13 @@ type WorkerPool struct {
 	workerPoolID     string
 	concurrency      uint
 	namespace        string // eg, "myapp-work"
-	pool             *redis.Pool
+	pool             Pool   // nil unless backend is the Redis one
+	backend          Backend
 	sleepBackoffs    []int64
+	maxDeadJobs      uint
+	maxDeadAge       time.Duration
+	logger           Logger
+	metrics          Metrics
 	contextType      reflect.Type
 	jobTypes         map[string]*jobType
 	middleware       []*middlewareHandler
@@ -86,29 +121,56 @@ type WorkerPool struct {
 	scheduler        *requeuer
 	deadPoolReaper   *deadPoolReaper
 	periodicEnqueuer *periodicEnqueuer
+	queueSampler     *queueSampler
+	jobCanceller     *jobCanceller
+	deadPruner       *deadPruner
+	priorities       *jobPriorities
 }
 
 // NewWorkerPoolWithOptions creates a new worker pool as per the NewWorkerPool function, but permits you to specify
 // additional options such as sleep backoffs.
-func NewWorkerPoolWithOptions(ctx interface{}, concurrency uint, namespace string, pool *redis.Pool, workerPoolOpts WorkerPoolOptions) *WorkerPool {
-	if pool == nil {
-		panic("NewWorkerPool needs a non-nil *redis.Pool")
+func NewWorkerPoolWithOptions(ctx interface{}, concurrency uint, namespace string, pool Pool, workerPoolOpts WorkerPoolOptions) *WorkerPool {
+	if isNilPool(pool) {
+		panic("NewWorkerPool needs a non-nil Pool")
 	}
+	return newWorkerPool(ctx, concurrency, newRedisBackend(namespace, pool, workerPoolOpts.Logger), workerPoolOpts)
+}
 
+// NewWorkerPoolWithBackend creates a new worker pool as per NewWorkerPoolWithOptions,
+// processing the jobs of the specified backend, eg, one returned by NewMemoryBackend.
+// The dead pool reaper, periodic jobs, the pruning of dead jobs and the queue sampling of Metrics need Redis,
+// so they're only run with the Redis backend.
+func NewWorkerPoolWithBackend(ctx interface{}, concurrency uint, backend Backend, workerPoolOpts WorkerPoolOptions) *WorkerPool {
+	if backend == nil {
+		panic("NewWorkerPoolWithBackend needs a non-nil Backend")
+	}
+	return newWorkerPool(ctx, concurrency, backend, workerPoolOpts)
+}
+
+func newWorkerPool(ctx interface{}, concurrency uint, backend Backend, workerPoolOpts WorkerPoolOptions) *WorkerPool {
 	ctxType := reflect.TypeOf(ctx)
 	validateContextType(ctxType)
 	wp := &WorkerPool{
 		workerPoolID:  makeIdentifier(),
 		concurrency:   concurrency,
-		namespace:     namespace,
-		pool:          pool,
+		backend:       backend,
 		sleepBackoffs: workerPoolOpts.SleepBackoffs,
+		maxDeadJobs:   workerPoolOpts.MaxDeadJobs,
+		maxDeadAge:    workerPoolOpts.MaxDeadAge,
+		logger:        workerPoolOpts.Logger,
+		metrics:       workerPoolOpts.Metrics,
 		contextType:   ctxType,
 		jobTypes:      make(map[string]*jobType),
+		priorities:    newJobPriorities(),
+	}
+	if rb, ok := backend.(*redisBackend); ok {
+		wp.namespace = rb.namespace
+		wp.pool = rb.pool
 	}
 
 	for i := uint(0); i < wp.concurrency; i++ {
-		w := newWorker(wp.namespace, wp.workerPoolID, wp.pool, wp.contextType, nil, wp.jobTypes, wp.sleepBackoffs)
+		w := newWorker(wp.namespace, wp.workerPoolID, wp.backend, wp.contextType, nil, wp.jobTypes, wp.sleepBackoffs, wp.logger, wp.metrics)
+		w.priorities = wp.priorities
 		wp.workers = append(wp.workers, w)
 	}
 	return wp
@@ -117,7 +179,7 @@ func NewWorkerPoolWithOptions(ctx interface{}, concurrency uint, namespace strin
 // NewWorkerPool creates a new worker pool.
 // ctx should be a struct literal whose type will be used for middleware and handlers.
 // concurrency specifies how many workers to spin up - each worker can process jobs concurrently.
-func NewWorkerPool(ctx interface{}, concurrency uint, namespace string, pool *redis.Pool) *WorkerPool {
+func NewWorkerPool(ctx interface{}, concurrency uint, namespace string, pool Pool) *WorkerPool {
 	return NewWorkerPoolWithOptions(ctx, concurrency, namespace, pool, WorkerPoolOptions{})
 }
 
@@ -179,51 +241,50 @@ func (wp *WorkerPool) Job(name string, fn interface{}) *WorkerPool {
 	return wp.JobWithOptions(name, JobOptions{}, fn)
 }
 
+// PeriodicJobOptions can be passed to PeriodicallyEnqueueWithOptions.
+type PeriodicJobOptions struct {
+	Args     map[string]interface{} // The args of the jobs enqueued
+	Location *time.Location         // The time zone the spec is in (default is time.Local)
+	Jitter   time.Duration          // If set, each job is run up to Jitter after its time, to spread the load of jobs due at once
+	Unique   bool                   // If true, a job due while one of the same name is waiting to start is dropped, as per EnqueueUnique with nil args
+}
+
 // PeriodicallyEnqueue will periodically enqueue jobName according to the cron-based spec.
 // The spec format is based on https://godoc.org/github.com/robfig/cron, which is a relatively standard cron format.
 // Note that the first value is the seconds!
 // If you have multiple worker pools on different machines, they'll all coordinate and only enqueue your job once.
+// Periodic jobs are only enqueued by worker pools using the Redis backend.
+// It panics if spec can't be parsed; see PeriodicallyEnqueueWithOptions for a version returning an error.
 func (wp *WorkerPool) PeriodicallyEnqueue(spec string, jobName string) *WorkerPool {
-	p := cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
-	schedule, err := p.Parse(spec)
-	if err != nil {
+	if err := wp.PeriodicallyEnqueueWithOptions(spec, jobName, PeriodicJobOptions{}); err != nil {
 		panic(err)
 	}
-
-	wp.periodicJobs = append(wp.periodicJobs, &periodicJob{jobName: jobName, spec: spec, schedule: schedule})
 	return wp
 }
 
-func (wp *WorkerPool) writeConcurrencyControlsToRedis() {
-	if len(wp.jobTypes) == 0 {
-		return
+// PeriodicallyEnqueueWithOptions will periodically enqueue jobName according to the cron-based spec
+// as per PeriodicallyEnqueue, with the specified options such as the args of the jobs.
+// It returns an error if spec can't be parsed.
+// The periodic jobs of all worker pools are recorded in Redis, see Client.PeriodicJobs.
+func (wp *WorkerPool) PeriodicallyEnqueueWithOptions(spec string, jobName string, opts PeriodicJobOptions) error {
+	pj, err := newPeriodicJob(spec, jobName, opts)
+	if err != nil {
+		return err
 	}
 
-	conn := wp.pool.Get()
-	defer conn.Close()
-	for jobName, jobType := range wp.jobTypes {
-		if _, err := conn.Do("SET", redisKeyJobsConcurrency(wp.namespace, jobName), jobType.MaxConcurrency); err != nil {
-			logError("write_concurrency_controls_max_concurrency", err)
-		}
-	}
+	wp.periodicJobs = append(wp.periodicJobs, pj)
+	return nil
 }
 
-func (wp *WorkerPool) writeKnownJobsToRedis() {
-	if len(wp.jobTypes) == 0 {
-		return
-	}
-
-	conn := wp.pool.Get()
-	defer conn.Close()
-	key := redisKeyKnownJobs(wp.namespace)
-	jobNames := make([]interface{}, 0, len(wp.jobTypes)+1)
-	jobNames = append(jobNames, key)
-	for k := range wp.jobTypes {
-		jobNames = append(jobNames, k)
+// registerJobTypes records the options of the pool's job types in its backend,
+// and picks up the priorities overridden with Client.SetJobPriority.
+func (wp *WorkerPool) registerJobTypes() {
+	priorities, err := wp.backend.RegisterJobTypes(wp.workerPoolID, jobOptions(wp.jobTypes))
+	if err != nil {
+		logError(wp.logger, "worker_pool.register_job_types", err, "namespace", wp.namespace, "worker_pool_id", wp.workerPoolID)
 	}
-
-	if _, err := conn.Do("SADD", jobNames...); err != nil {
-		logError("write_known_jobs", err)
+	if priorities != nil {
+		wp.priorities.set(priorities)
 	}
 }
 
@@ -232,12 +293,23 @@ func (wp *WorkerPool) startRequeuers() {
 	for k := range wp.jobTypes {
 		jobNames = append(jobNames, k)
 	}
-	wp.retrier = newRequeuer(wp.namespace, wp.pool, redisKeyRetry(wp.namespace), jobNames)
-	wp.scheduler = newRequeuer(wp.namespace, wp.pool, redisKeyScheduled(wp.namespace), jobNames)
-	wp.deadPoolReaper = newDeadPoolReaper(wp.namespace, wp.pool, jobNames)
+	wp.retrier = newRequeuer(wp.namespace, wp.backend, RetrySet, jobNames, wp.logger, wp.metrics)
+	wp.scheduler = newRequeuer(wp.namespace, wp.backend, ScheduledSet, jobNames, wp.logger, wp.metrics)
 	wp.retrier.start()
 	wp.scheduler.start()
+	if wp.pool == nil {
+		return
+	}
+	wp.deadPoolReaper = newDeadPoolReaper(wp.namespace, wp.pool, jobNames, wp.logger, wp.metrics)
 	wp.deadPoolReaper.start()
+	if wp.maxDeadJobs > 0 || wp.maxDeadAge > 0 {
+		wp.deadPruner = newDeadPruner(wp.namespace, wp.pool, wp.maxDeadAge, wp.maxDeadJobs, wp.logger)
+		wp.deadPruner.start()
+	}
+	if wp.metrics != nil {
+		wp.queueSampler = newQueueSampler(wp.namespace, wp.pool, jobNames, wp.logger, wp.metrics)
+		wp.queueSampler.start()
+	}
 }
 
 func (wp *WorkerPool) workerIDs() []string {
@@ -251,6 +323,7 @@ func (wp *WorkerPool) workerIDs() []string {
 }
 
 // Start starts the workers and associated processes.
+// If StopWithContext returned before the handlers of the jobs being run did, Start waits for them to return first.
 func (wp *WorkerPool) Start() {
 	if wp.started {
 		return
@@ -258,32 +331,64 @@ func (wp *WorkerPool) Start() {
 	wp.started = true
 
 	// TODO: we should cleanup stale keys on startup from previously registered jobs
-	wp.writeConcurrencyControlsToRedis()
-	go wp.writeKnownJobsToRedis()
+	wp.registerJobTypes()
 
 	for _, w := range wp.workers {
+		w.waitPendingStop()
 		go w.start()
 	}
 
-	wp.heartbeater = newWorkerPoolHeartbeater(wp.namespace, wp.pool, wp.workerPoolID, wp.jobTypes, wp.concurrency, wp.workerIDs())
+	wp.heartbeater = newWorkerPoolHeartbeater(wp.namespace, wp.backend, wp.workerPoolID, wp.jobTypes, wp.concurrency, wp.workerIDs(), wp.priorities, wp.logger)
 	wp.heartbeater.start()
 	wp.startRequeuers()
-	wp.periodicEnqueuer = newPeriodicEnqueuer(wp.namespace, wp.pool, wp.periodicJobs)
-	wp.periodicEnqueuer.start()
+	if wp.pool != nil {
+		wp.periodicEnqueuer = newPeriodicEnqueuer(wp.namespace, wp.pool, wp.periodicJobs, wp.logger)
+		wp.periodicEnqueuer.start()
+		wp.jobCanceller = newJobCanceller(wp.namespace, wp.pool, wp.workers, wp.logger)
+		wp.jobCanceller.start()
+	}
 }
 
 // Stop stops the workers and associated processes.
+// It cancels the contexts of the jobs being run (see Job.Context) and waits for their handlers to return.
 func (wp *WorkerPool) Stop() {
+	wp.stop(func(w *worker) error {
+		w.stop()
+		return nil
+	})
+}
+
+// StopWithContext stops the workers and associated processes as per Stop,
+// but lets the jobs being run finish until ctx is done.
+// The workers stop fetching jobs right away.
+// Once ctx is done, the contexts of the unfinished jobs are cancelled,
+// and the jobs are put back at the front of their queues for other worker pools to run,
+// without counting as a failure. Their handlers may keep running in the background,
+// but what they return is ignored. In that case, StopWithContext returns ctx.Err(),
+// and Start waits for them to return before starting the workers again.
+func (wp *WorkerPool) StopWithContext(ctx context.Context) error {
+	return wp.stop(func(w *worker) error {
+		return w.stopWithContext(ctx)
+	})
+}
+
+func (wp *WorkerPool) stop(stopWorker func(*worker) error) error {
 	if !wp.started {
-		return
+		return nil
 	}
 	wp.started = false
 
+	var err error
+	var errMtx sync.Mutex
 	wg := sync.WaitGroup{}
 	for _, w := range wp.workers {
 		wg.Add(1)
 		go func(w *worker) {
-			w.stop()
+			if werr := stopWorker(w); werr != nil {
+				errMtx.Lock()
+				err = werr
+				errMtx.Unlock()
+			}
 			wg.Done()
 		}(w)
 	}
@@ -291,8 +396,18 @@ func (wp *WorkerPool) Stop() {
 	wp.heartbeater.stop()
 	wp.retrier.stop()
 	wp.scheduler.stop()
-	wp.deadPoolReaper.stop()
-	wp.periodicEnqueuer.stop()
+	if wp.deadPoolReaper != nil {
+		wp.deadPoolReaper.stop()
+		wp.periodicEnqueuer.stop()
+		wp.jobCanceller.stop()
+	}
+	if wp.queueSampler != nil {
+		wp.queueSampler.stop()
+	}
+	if wp.deadPruner != nil {
+		wp.deadPruner.stop()
+	}
+	return err
 }
 
 // Drain drains all jobs in the queue before returning.
@@ -2,8 +2,11 @@ package work
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -213,6 +216,167 @@ func TestWorkerPoolPauseSingleThreadedJobs(t *testing.T) {
 	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(ns, job1), wp.workerPoolID))
 }
 
+func TestWorkerPoolRateLimit(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns, job1 := "work", "job1"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	wp := setupTestWorkerPool(pool, ns, job1, 3, JobOptions{Priority: 1, RateLimit: RateLimit{Limit: 2, Interval: time.Minute}})
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 5; i++ {
+		_, err := enqueuer.Enqueue(job1, Q{"sleep": 0})
+		assert.Nil(t, err)
+	}
+
+	// Only as many jobs as the bucket holds are started, the others stay queued
+	wp.Start()
+	wp.Drain()
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobs(ns, job1)))
+
+	// Half the interval refills one token
+	setNowEpochSecondsMock(1425263409 + 30)
+	time.Sleep(30 * time.Millisecond)
+	wp.Drain()
+	wp.Stop()
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(ns, job1)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
+
+	// Without a rate limit, the bucket is ignored
+	wp = NewWorkerPool(TestContext{}, 3, ns, pool)
+	wp.JobWithOptions(job1, JobOptions{Priority: 1}, (*TestContext).SleepyJob)
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
+
+	// Intervals under a millisecond are rounded up, rather than meaning no limit
+	wp = NewWorkerPool(TestContext{}, 3, ns, pool)
+	wp.JobWithOptions(job1, JobOptions{Priority: 1, RateLimit: RateLimit{Limit: 1, Interval: time.Microsecond}}, (*TestContext).SleepyJob)
+	wp.registerJobTypes()
+	assert.EqualValues(t, 1, hgetInt64(pool, redisKeyJobsRateLimit(ns, job1), "interval_ms"))
+}
+
+func TestWorkerPoolStopWithContext(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns, job1 := "work", "job1"
+	cleanKeyspace(ns, pool)
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.JobWithOptions(job1, JobOptions{Priority: 1, MaxFails: 3}, func(job *Job) error {
+		started <- struct{}{}
+		<-release // ignores the cancellation of its context
+		return errors.New("too late")
+	})
+	wp.Start()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue(job1, Q{"a": 2})
+	assert.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, wp.StopWithContext(ctx))
+
+	// The job is back at the front of its queue, with its lock released
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(ns, job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, wp.workerPoolID, job1)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, job1)))
+	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(ns, job1), wp.workerPoolID))
+	j := jobOnQueue(pool, redisKeyJobs(ns, job1))
+	assert.EqualValues(t, 1, j.ArgInt64("a"))
+	assert.EqualValues(t, 0, j.Fails)
+
+	// What the handler returns is ignored, and no other job is fetched
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, job1)))
+}
+
+func TestWorkerPoolRestartAfterStopWithContext(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns, job1 := "work", "job1"
+	cleanKeyspace(ns, pool)
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var calls int32
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.Job(job1, func(job *Job) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			started <- struct{}{}
+			<-release // ignores the cancellation of its context
+		}
+		return nil
+	})
+	wp.Start()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue(job1, nil)
+	assert.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, wp.StopWithContext(ctx))
+
+	// Start waits for the handler left running to return
+	restarted := make(chan struct{})
+	go func() {
+		wp.Start()
+		close(restarted)
+	}()
+	select {
+	case <-restarted:
+		t.Fatal("the worker pool restarted before the handler returned")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-restarted
+
+	// The restarted worker runs the job put back on its queue
+	wp.Drain()
+	wp.Stop()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
+}
+
+func TestWorkerPoolStopWithContextFinishes(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns, job1 := "work", "job1"
+	cleanKeyspace(ns, pool)
+
+	started := make(chan struct{})
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.Job(job1, func(job *Job) error {
+		close(started)
+		time.Sleep(10 * time.Millisecond)
+		return job.Context().Err()
+	})
+	wp.Start()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue(job1, nil)
+	assert.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, wp.StopWithContext(ctx))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, job1)))
+}
+
 func setupTestWorkerPool(pool *redis.Pool, namespace, jobName string, concurrency int, jobOpts JobOptions) *WorkerPool {
 	deleteQueue(pool, namespace, jobName)
 	deleteRetryAndDead(pool, namespace)
@@ -224,3 +388,38 @@ func setupTestWorkerPool(pool *redis.Pool, namespace, jobName string, concurrenc
 	sleepBackoffsInMilliseconds = []int64{10, 10, 10, 10, 10}
 	return wp
 }
+
+func TestWorkerPoolCancelJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns, job1 := "work", "job1"
+	cleanKeyspace(ns, pool)
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool)
+	wp.JobWithOptions(job1, JobOptions{Priority: 1, MaxFails: 3}, func(job *Job) error {
+		close(started)
+		defer close(done)
+		<-job.Context().Done()
+		return job.Context().Err()
+	})
+	wp.Start()
+	defer wp.Stop()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	job, err := enqueuer.Enqueue(job1, nil)
+	assert.NoError(t, err)
+	<-started
+
+	assert.NoError(t, wp.jobCanceller.poll()) // nothing to cancel yet
+	assert.NoError(t, NewClient(ns, pool).CancelJob(job.ID))
+	assert.NoError(t, wp.jobCanceller.poll())
+	<-done
+	time.Sleep(20 * time.Millisecond)
+
+	// The job is neither retried nor dead
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, wp.workerPoolID, job1)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, job1)))
+}
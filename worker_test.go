@@ -1,6 +1,7 @@
 package work
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"sync/atomic"
@@ -62,7 +63,7 @@ func TestWorkerBasics(t *testing.T) {
 	_, err = enqueuer.Enqueue(job3, Q{"a": 3})
 	assert.Nil(t, err)
 
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, nil)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
 	w.start()
 	w.drain()
 	w.stop()
@@ -112,7 +113,7 @@ func TestWorkerInProgress(t *testing.T) {
 	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
 	assert.Nil(t, err)
 
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, nil)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
 	w.start()
 
 	// instead of w.forceIter(), we'll wait for 10 milliseconds to let the job start
@@ -163,7 +164,7 @@ func TestWorkerRetry(t *testing.T) {
 	enqueuer := NewEnqueuer(ns, pool)
 	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
 	assert.Nil(t, err)
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, nil)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
 	w.start()
 	w.drain()
 	w.stop()
@@ -215,7 +216,7 @@ func TestWorkerRetryWithCustomBackoff(t *testing.T) {
 	enqueuer := NewEnqueuer(ns, pool)
 	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
 	assert.Nil(t, err)
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, nil)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
 	w.start()
 	w.drain()
 	w.stop()
@@ -239,6 +240,56 @@ func TestWorkerRetryWithCustomBackoff(t *testing.T) {
 	assert.Equal(t, 1, calledCustom)
 }
 
+func TestWorkerRetryTypedErrors(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	job2 := "job2"
+	deleteQueue(pool, ns, job1)
+	deleteQueue(pool, ns, job2)
+	deleteRetryAndDead(pool, ns)
+
+	jobTypes := make(map[string]*jobType)
+	jobTypes[job1] = &jobType{
+		Name:       job1,
+		JobOptions: JobOptions{Priority: 1, MaxFails: 3},
+		IsGeneric:  true,
+		GenericHandler: func(job *Job) error {
+			return RetryAfter(time.Hour, errors.New("come back later"))
+		},
+	}
+	jobTypes[job2] = &jobType{
+		Name:       job2,
+		JobOptions: JobOptions{Priority: 1, MaxFails: 3},
+		IsGeneric:  true,
+		GenericHandler: func(job *Job) error {
+			return NoRetry(errors.New("never again"))
+		},
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue(job1, nil)
+	assert.Nil(t, err)
+	_, err = enqueuer.Enqueue(job2, nil)
+	assert.Nil(t, err)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(ns)))
+	ts, job := jobOnZset(pool, redisKeyRetry(ns))
+	assert.Equal(t, job1, job.Name)
+	assert.Equal(t, "come back later", job.LastErr)
+	assert.True(t, ts >= nowEpochSeconds()+3590 && ts <= nowEpochSeconds()+3600)
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(ns)))
+	_, job = jobOnZset(pool, redisKeyDead(ns))
+	assert.Equal(t, job2, job.Name)
+	assert.Equal(t, "never again", job.LastErr)
+	assert.EqualValues(t, 1, job.Fails)
+}
+
 func TestWorkerDead(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -272,7 +323,7 @@ func TestWorkerDead(t *testing.T) {
 	assert.Nil(t, err)
 	_, err = enqueuer.Enqueue(job2, nil)
 	assert.Nil(t, err)
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, nil)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
 	w.start()
 	w.drain()
 	w.stop()
@@ -325,7 +376,7 @@ func TestWorkersPaused(t *testing.T) {
 	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
 	assert.Nil(t, err)
 
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, nil)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
 	// pause the jobs prior to starting
 	err = pauseJobs(ns, job1, pool)
 	assert.Nil(t, err)
@@ -364,6 +415,79 @@ func TestWorkersPaused(t *testing.T) {
 	assert.EqualValues(t, 0, len(h))
 }
 
+func TestWorkerTimeout(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	deleteQueue(pool, ns, job1)
+	deleteRetryAndDead(pool, ns)
+	deletePausedAndLockedKeys(ns, job1, pool)
+
+	jobTypes := make(map[string]*jobType)
+	jobTypes[job1] = &jobType{
+		Name:       job1,
+		JobOptions: JobOptions{Priority: 1, MaxFails: 3, Timeout: 10 * time.Millisecond},
+		IsGeneric:  true,
+		GenericHandler: func(job *Job) error {
+			<-job.Context().Done()
+			return job.Context().Err()
+		},
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
+	assert.Nil(t, err)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	// timed out jobs are retried like any other failure
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(ns)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
+
+	_, job := jobOnZset(pool, redisKeyRetry(ns))
+	assert.EqualValues(t, 1, job.Fails)
+	assert.Equal(t, ErrJobTimeout.Error(), job.LastErr)
+}
+
+func TestWorkerStopCancelsContext(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	deleteQueue(pool, ns, job1)
+	deleteRetryAndDead(pool, ns)
+	deletePausedAndLockedKeys(ns, job1, pool)
+
+	started := make(chan struct{})
+	var cancelErr error
+	jobTypes := make(map[string]*jobType)
+	jobTypes[job1] = &jobType{
+		Name:       job1,
+		JobOptions: JobOptions{Priority: 1, MaxFails: 3},
+		IsGeneric:  true,
+		GenericHandler: func(job *Job) error {
+			close(started)
+			<-job.Context().Done()
+			cancelErr = job.Context().Err()
+			return nil
+		},
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
+	assert.Nil(t, err)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+	w.start()
+	<-started
+	w.stop()
+
+	assert.Equal(t, context.Canceled, cancelErr)
+	assert.NoError(t, w.ctx.Err()) // renewed for the next start
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
+}
+
 // Test that in the case of an unavailable Redis server,
 // the worker loop exits in the case of a WorkerPool.Stop
 func TestStop(t *testing.T) {
@@ -558,6 +682,7 @@ func hgetInt64(pool *redis.Pool, redisKey, hashKey string) int64 {
 	return v
 }
 
+// jobOnZset returns the first job of the zset at key, and its time in epoch seconds.
 func jobOnZset(pool *redis.Pool, key string) (int64, *Job) {
 	conn := pool.Get()
 	defer conn.Close()
@@ -579,7 +704,7 @@ func jobOnZset(pool *redis.Pool, key string) (int64, *Job) {
 	if err != nil {
 		panic("couldn't parse int: " + err.Error())
 	}
-	return scoreInt, job
+	return scoreToEpochSeconds(scoreInt), job
 }
 
 func pauseJobs(namespace, jobName string, pool *redis.Pool) error {
@@ -0,0 +1,190 @@
+package work
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ParentDeadAction is what happens to the jobs waiting on a job of a workflow when that job dies.
+type ParentDeadAction int
+
+const (
+	// ParkDependents moves the jobs waiting on a dead job to the dead queue.
+	// If they're retried from there, they run without waiting on their other parents.
+	ParkDependents ParentDeadAction = iota
+	// CancelDependents deletes the jobs waiting on a dead job, along with the jobs waiting on them.
+	CancelDependents
+)
+
+// WorkflowJob is a job enqueued with EnqueueChain or EnqueueWorkflow.
+type WorkflowJob struct {
+	Key       string // Identifies the job within the workflow, so that other jobs can depend on it
+	JobName   string
+	Args      map[string]interface{}
+	DependsOn []string // Keys of the jobs that must succeed before this one is enqueued
+}
+
+// defaultWorkflowWaitTTL is how long jobs wait for the jobs they depend on at most unless WorkflowOptions.WaitTTL is set.
+const defaultWorkflowWaitTTL = 30 * 24 * time.Hour
+
+// WorkflowOptions can be passed to EnqueueWorkflow.
+type WorkflowOptions struct {
+	OnParentDead ParentDeadAction // Defaults to ParkDependents
+	WaitTTL      time.Duration    // How long jobs wait for the jobs they depend on at most (default is 30 days)
+}
+
+// EnqueueChain enqueues jobs so that each of them runs after the previous one succeeded.
+// The Key and DependsOn of the jobs are ignored.
+// The first job is enqueued right away,
+// the others wait in Redis (and don't show up in their queues) until they're enqueued.
+// If a job dies, the job waiting on it is parked as per ParkDependents.
+func (e *Enqueuer) EnqueueChain(jobs ...WorkflowJob) ([]*Job, error) {
+	chain := make([]WorkflowJob, len(jobs))
+	for i, job := range jobs {
+		chain[i] = WorkflowJob{Key: strconv.Itoa(i), JobName: job.JobName, Args: job.Args}
+		if i > 0 {
+			chain[i].DependsOn = []string{strconv.Itoa(i - 1)}
+		}
+	}
+	return e.EnqueueWorkflow(chain, WorkflowOptions{})
+}
+
+// EnqueueWorkflow enqueues jobs that depend on each other as per their DependsOn keys,
+// so that a job runs once all of the jobs it depends on have succeeded.
+// A job can only depend on jobs listed before it, which keeps the workflow free of cycles.
+// Jobs without dependencies are enqueued right away,
+// the others wait in Redis (and don't show up in their queues) until they're enqueued.
+// Jobs being retried haven't succeeded yet, so the jobs depending on them keep waiting.
+// The returned jobs are in the same order as jobs.
+func (e *Enqueuer) EnqueueWorkflow(jobs []WorkflowJob, workflowOpts WorkflowOptions) ([]*Job, error) {
+	if e.redis == nil {
+		return nil, ErrUnsupportedBackend
+	}
+
+	created := make([]*Job, len(jobs))
+	parents := make([][]*Job, len(jobs))
+	keys := make(map[string]int)
+	now := nowEpochSeconds()
+	for i, wj := range jobs {
+		if wj.Key != "" {
+			if _, ok := keys[wj.Key]; ok {
+				return nil, fmt.Errorf("work: workflow has more than one job with key %q", wj.Key)
+			}
+		}
+
+		job := &Job{
+			Name:       wj.JobName,
+			ID:         makeIdentifier(),
+			EnqueuedAt: now,
+			Args:       wj.Args,
+			StatusTTL:  e.statusTTL,
+		}
+		for _, dep := range wj.DependsOn {
+			p, ok := keys[dep]
+			if !ok {
+				return nil, fmt.Errorf("work: job %q of the workflow depends on %q, which isn't listed before it", wj.Key, dep)
+			}
+			parent := created[p]
+			if len(parent.Dependents) > 0 && parent.Dependents[len(parent.Dependents)-1] == job.ID {
+				continue // depends on the same job twice
+			}
+			parent.Dependents = append(parent.Dependents, job.ID)
+			parents[i] = append(parents[i], parent)
+		}
+
+		created[i] = job
+		if wj.Key != "" {
+			keys[wj.Key] = i
+		}
+	}
+
+	onParentDead := "park"
+	if workflowOpts.OnParentDead == CancelDependents {
+		onParentDead = "cancel"
+	}
+	waitTTL := workflowOpts.WaitTTL
+	if waitTTL <= 0 {
+		waitTTL = defaultWorkflowWaitTTL
+	}
+
+	conn := e.Pool.Get()
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	for i, job := range created {
+		rawJSON, err := job.serialize()
+		if err != nil {
+			conn.Do("DISCARD")
+			return nil, err
+		}
+		sendJobStatus(conn, e.Namespace, job, JobQueued)
+
+		if len(parents[i]) == 0 {
+			conn.Send("LPUSH", e.queuePrefix+job.Name, rawJSON)
+			continue
+		}
+
+		// The job is pushed as is once it's released, with the enqueued at time spliced in
+		tStart, tEnd, err := jsonFieldOffsets(rawJSON, "t")
+		if err != nil {
+			conn.Do("DISCARD")
+			return nil, err
+		}
+
+		waitingKey := redisKeyWaitingJob(e.Namespace, job.ID)
+		args := redis.Args{waitingKey,
+			"job", rawJSON,
+			"t_start", tStart,
+			"t_end", tEnd,
+			"queue", e.queuePrefix + job.Name,
+			"pending", len(parents[i]),
+			"on_parent_dead", onParentDead,
+		}
+		for _, parent := range parents[i] {
+			args = args.Add("parent:"+parent.ID, 1)
+		}
+		conn.Send("HSET", args...)
+		conn.Send("EXPIRE", waitingKey, ceilSeconds(waitTTL))
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return nil, err
+	}
+
+	for _, job := range created {
+		if err := e.redis.addToKnownJobs(conn, job.Name); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// jsonFieldOffsets returns the offsets of the start and the end of the value of the top-level field of the JSON object raw.
+func jsonFieldOffsets(raw []byte, field string) (int64, int64, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil {
+		return 0, 0, err
+	} else if tok != json.Delim('{') {
+		return 0, 0, fmt.Errorf("work: not a JSON object")
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return 0, 0, err
+		}
+		if tok == field {
+			end := dec.InputOffset()
+			return end - int64(len(value)), end, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("work: no %q field in JSON object", field)
+}
@@ -0,0 +1,232 @@
+package work
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnqueueChain(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	jobs, err := enqueuer.EnqueueChain(
+		WorkflowJob{JobName: "a", Args: Q{"step": 1}},
+		WorkflowJob{JobName: "b", Args: Q{"step": 2}},
+		WorkflowJob{JobName: "a", Args: Q{"step": 3}},
+	)
+	assert.NoError(t, err)
+	if !assert.Equal(t, 3, len(jobs)) {
+		return
+	}
+	assert.Equal(t, []string{jobs[1].ID}, jobs[0].Dependents)
+	assert.Equal(t, []string{jobs[2].ID}, jobs[1].Dependents)
+
+	// Only the first job is queued
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "a")))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "b")))
+	assert.Equal(t, []string{"a", "b"}, knownJobs(pool, redisKeyKnownJobs(ns)))
+
+	var mtx sync.Mutex
+	var steps []int64
+	handler := func(job *Job) error {
+		mtx.Lock()
+		steps = append(steps, job.ArgInt64("step"))
+		mtx.Unlock()
+		return nil
+	}
+	jobTypes := map[string]*jobType{
+		"a": {Name: "a", JobOptions: JobOptions{Priority: 1}, IsGeneric: true, GenericHandler: handler},
+		"b": {Name: "b", JobOptions: JobOptions{Priority: 1}, IsGeneric: true, GenericHandler: handler},
+	}
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.Equal(t, []int64{1, 2, 3}, steps)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "a")))
+	assert.False(t, exists(pool, redisKeyWaitingJob(ns, jobs[1].ID)))
+	assert.False(t, exists(pool, redisKeyWaitingJob(ns, jobs[2].ID)))
+}
+
+func TestEnqueueWorkflowParentDied(t *testing.T) {
+	for _, tc := range []struct {
+		action ParentDeadAction
+		dead   int64
+	}{
+		{ParkDependents, 2},
+		{CancelDependents, 1},
+	} {
+		t.Run(fmt.Sprint(tc.action), func(t *testing.T) {
+			pool := newTestPool(":6379")
+			ns := "work"
+			cleanKeyspace(ns, pool)
+			enqueuer := NewEnqueuerWithOptions(ns, pool, EnqueuerOptions{StatusTTL: time.Hour})
+
+			// ok and broken run first, then report once both succeeded, then notify
+			jobs, err := enqueuer.EnqueueWorkflow([]WorkflowJob{
+				{Key: "ok", JobName: "ok"},
+				{Key: "broken", JobName: "broken"},
+				{Key: "report", JobName: "ok", DependsOn: []string{"ok", "broken", "ok"}},
+				{Key: "notify", JobName: "ok", DependsOn: []string{"report"}},
+			}, WorkflowOptions{OnParentDead: tc.action})
+			assert.NoError(t, err)
+			assert.EqualValues(t, 2, hgetInt64(pool, redisKeyWaitingJob(ns, jobs[2].ID), "pending"))
+
+			ran := 0
+			jobTypes := map[string]*jobType{
+				"ok": {
+					Name:           "ok",
+					JobOptions:     JobOptions{Priority: 1, MaxFails: 3},
+					IsGeneric:      true,
+					GenericHandler: func(job *Job) error { ran++; return nil },
+				},
+				"broken": {
+					Name:           "broken",
+					JobOptions:     JobOptions{Priority: 1, MaxFails: 1},
+					IsGeneric:      true,
+					GenericHandler: func(job *Job) error { return fmt.Errorf("ohno") },
+				},
+			}
+			w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+			w.start()
+			w.drain()
+			w.stop()
+
+			assert.Equal(t, 1, ran)
+			assert.EqualValues(t, tc.dead, zsetSize(pool, redisKeyDead(ns)))
+			assert.False(t, exists(pool, redisKeyWaitingJob(ns, jobs[2].ID)))
+			// notify keeps waiting on a parked report, and is cancelled along with it
+			assert.Equal(t, tc.action == ParkDependents, exists(pool, redisKeyWaitingJob(ns, jobs[3].ID)))
+
+			// The jobs parked or cancelled are dead
+			client := NewClient(ns, pool)
+			status, err := client.JobStatus(jobs[2].ID)
+			assert.NoError(t, err)
+			if assert.NotNil(t, status) {
+				assert.Equal(t, JobDead, status.State)
+				assert.Contains(t, status.LastErr, jobs[1].ID)
+			}
+			status, err = client.JobStatus(jobs[3].ID)
+			assert.NoError(t, err)
+			if assert.NotNil(t, status) {
+				if tc.action == ParkDependents {
+					assert.Equal(t, JobQueued, status.State)
+				} else {
+					assert.Equal(t, JobDead, status.State)
+				}
+			}
+		})
+	}
+}
+
+func TestEnqueueWorkflowWaitingJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	setNowEpochSecondsMock(1468359453)
+	defer resetNowEpochSecondsMock()
+
+	// The waiting jobs expire, and their args are kept as they are
+	big := Q{"big": int64(1234567890123456789), "t": 7}
+	released, err := enqueuer.EnqueueWorkflow([]WorkflowJob{
+		{Key: "ok", JobName: "ok"},
+		{Key: "next", JobName: "next", Args: big, DependsOn: []string{"ok"}},
+	}, WorkflowOptions{WaitTTL: time.Hour})
+	assert.NoError(t, err)
+	parked, err := enqueuer.EnqueueWorkflow([]WorkflowJob{
+		{Key: "broken", JobName: "broken"},
+		{Key: "next", JobName: "next", Args: big, DependsOn: []string{"broken"}},
+	}, WorkflowOptions{})
+	assert.NoError(t, err)
+
+	conn := pool.Get()
+	defer conn.Close()
+	ttl, err := redis.Int64(conn.Do("TTL", redisKeyWaitingJob(ns, released[1].ID)))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3600, ttl)
+	ttl, err = redis.Int64(conn.Do("TTL", redisKeyWaitingJob(ns, parked[1].ID)))
+	assert.NoError(t, err)
+	assert.EqualValues(t, int64(defaultWorkflowWaitTTL/time.Second), ttl)
+
+	jobTypes := map[string]*jobType{
+		"ok": {
+			Name:           "ok",
+			JobOptions:     JobOptions{Priority: 1},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { return nil },
+		},
+		"broken": {
+			Name:           "broken",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 1},
+			IsGeneric:      true,
+			GenericHandler: func(job *Job) error { return fmt.Errorf("ohno") },
+		},
+	}
+	setNowEpochSecondsMock(1468359460)
+	w := newWorker(ns, "1", newRedisBackend(ns, pool, nil), tstCtxType, nil, jobTypes, nil, nil, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	rawJSON, err := redis.Bytes(conn.Do("LINDEX", redisKeyJobs(ns, "next"), 0))
+	assert.NoError(t, err)
+	assert.Contains(t, string(rawJSON), `"args":{"big":1234567890123456789,"t":7}`)
+	job, err := newJob(rawJSON, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, released[1].ID, job.ID)
+	assert.EqualValues(t, 1468359460, job.EnqueuedAt)
+
+	values, err := redis.ByteSlices(conn.Do("ZRANGE", redisKeyDead(ns), 0, -1))
+	assert.NoError(t, err)
+	var parkedJSON []byte
+	for _, v := range values {
+		if j, err := newJob(v, nil, nil); err == nil && j.ID == parked[1].ID {
+			parkedJSON = v
+			assert.Equal(t, "parent job "+parked[0].ID+" died", j.LastErr)
+			assert.EqualValues(t, 1468359460, j.FailedAt)
+		}
+	}
+	assert.Contains(t, string(parkedJSON), `"args":{"big":1234567890123456789,"t":7}`)
+}
+
+func TestEnqueueWorkflowInvalid(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	_, err := enqueuer.EnqueueWorkflow([]WorkflowJob{
+		{Key: "b", JobName: "b", DependsOn: []string{"a"}},
+		{Key: "a", JobName: "a"},
+	}, WorkflowOptions{})
+	assert.Error(t, err)
+
+	_, err = enqueuer.EnqueueWorkflow([]WorkflowJob{
+		{Key: "a", JobName: "a"},
+		{Key: "a", JobName: "b"},
+	}, WorkflowOptions{})
+	assert.Error(t, err)
+
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "a")))
+}
+
+func exists(pool *redis.Pool, key string) bool {
+	conn := pool.Get()
+	defer conn.Close()
+
+	v, err := redis.Bool(conn.Do("EXISTS", key))
+	if err != nil {
+		panic("could not check existence: " + err.Error())
+	}
+	return v
+}